@@ -17,13 +17,19 @@
 package dgo
 
 import (
+	"context"
 	"fmt"
 	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"os"
 	"path"
+	"path/filepath"
+	"runtime"
 	"sync"
+	"text/tabwriter"
+	"time"
 )
 
 type BuildCmdArguments struct {
@@ -32,8 +38,35 @@ type BuildCmdArguments struct {
 
 	goarch     string
 	goos       string
+	platforms  []string
 	cgoEnabled bool
-	docker     bool
+
+	imageTags   []string
+	imageOutput string
+	push        bool
+
+	docker  bool
+	runtime string
+	cache   bool
+
+	jobs      int
+	failFast  bool
+	keepGoing bool
+
+	flags        tools.BuildFlags
+	replaces     []string
+	since        string
+	selection    selectArguments
+	reproducible bool
+
+	sizeReport    bool
+	sizeThreshold float64
+	sbom          bool
+	elfCheck      string
+
+	cover     bool
+	coverApps bool
+	coverPkg  string
 }
 
 var cmdArguments = &BuildCmdArguments{}
@@ -53,13 +86,92 @@ func init() {
 	buildCmd.Flags().BoolVarP(&cmdArguments.cgoEnabled,
 		"cgo", "", false, "If disabled will pass CGO_ENABLED=0 env variable to go compiler")
 
-	buildCmd.Flags().StringVarP(&cmdArguments.goos,
+	addPlatformFlags(buildCmd, cmdArguments)
+
+	buildCmd.Flags().BoolVarP(&cmdArguments.cache,
+		"cache", "", true, "If enabled will skip compile of binaries with unchanged sources and dependencies")
+
+	buildCmd.Flags().BoolVarP(&cmdArguments.reproducible,
+		"reproducible", "", false, "Build with -trimpath, empty build id and build time from SOURCE_DATE_EPOCH, rebuild every binary and fail if it differs")
+
+	buildCmd.Flags().BoolVarP(&cmdArguments.sbom,
+		"sbom", "", false, "Write CycloneDX and SPDX documents next to every binary and aggregated ones for image into output folder")
+
+	buildCmd.Flags().StringSliceVarP(&cmdArguments.platforms,
+		"platform", "", nil, "Comma separated list of os/arch pairs, every platform will be build into ${output}/${os}_${arch} folder and docker buildx will be used")
+
+	buildCmd.Flags().StringArrayVarP(&cmdArguments.imageTags,
+		"image-tag", "", nil, "Tag of image built for --platform, required with --push")
+
+	buildCmd.Flags().StringVarP(&cmdArguments.imageOutput,
+		"image-output", "", "", "Export image built for --platform, passed as buildx --output, like type=oci,dest=./image.tar")
+
+	buildCmd.Flags().BoolVarP(&cmdArguments.push,
+		"push", "", false, "Push image built for --platform to registry with --image-tag")
+
+	addBuildPoolFlags(buildCmd, cmdArguments)
+	addCompileFlags(buildCmd, cmdArguments)
+	addRuntimeFlag(buildCmd, cmdArguments)
+	addSinceFlag(buildCmd, &cmdArguments.since)
+	addSelectFlags(buildCmd, &cmdArguments.selection)
+	addSizeFlags(buildCmd, cmdArguments)
+	addCoverFlags(buildCmd, cmdArguments)
+	addELFCheckFlag(buildCmd, cmdArguments)
+}
+
+func addCompileFlags(cmd *cobra.Command, arguments *BuildCmdArguments) {
+	cmd.Flags().StringVarP(&arguments.flags.LdFlags,
+		"ldflags", "", "", "Arguments to pass on each go tool link invocation")
+
+	cmd.Flags().StringVarP(&arguments.flags.GcFlags,
+		"gcflags", "", "", "Arguments to pass on each go tool compile invocation")
+
+	cmd.Flags().StringVarP(&arguments.flags.Tags,
+		"tags", "", "", "Comma separated list of build tags")
+
+	cmd.Flags().BoolVarP(&arguments.flags.TrimPath,
+		"trimpath", "", false, "Remove all file system paths from the resulting executables")
+
+	cmd.Flags().StringArrayVarP(&arguments.flags.Stamps,
+		"stamp", "", []string{"main.version={{.Version}}", "main.commit={{.Commit}}"},
+		"Stamp a variable with -X importpath.name=value, value is a template with {{.Version}}, {{.Commit}}, {{.Dirty}} and {{.BuildTime}} fields")
+
+	cmd.Flags().StringArrayVarP(&arguments.replaces,
+		"replace", "", nil, "Override a module with module=path or module=module@version, go.mod is not changed, an alternate modfile is used")
+}
+
+func addPlatformFlags(cmd *cobra.Command, arguments *BuildCmdArguments) {
+	cmd.Flags().StringVarP(&arguments.goos,
 		"goos", "", "linux", "If passed will pass GOOS=${value} env variable")
 
-	buildCmd.Flags().StringVarP(&cmdArguments.goarch,
+	cmd.Flags().StringVarP(&arguments.goarch,
 		"goarch", "", "amd64", "If passed will pass GOARCH=${value} env variable")
 }
 
+func addBuildPoolFlags(cmd *cobra.Command, arguments *BuildCmdArguments) {
+	cmd.Flags().IntVarP(&arguments.jobs,
+		"jobs", "j", runtime.NumCPU(), "Number of build steps to run in parallel")
+
+	cmd.Flags().BoolVarP(&arguments.failFast,
+		"fail-fast", "", false, "If enabled will stop build on first failed package")
+
+	cmd.Flags().BoolVarP(&arguments.keepGoing,
+		"keep-going", "", false, "If enabled will build all packages even if some of them are failed, it is a default mode")
+}
+
+// validatePoolFlags - check only one of --fail-fast and --keep-going modes is selected.
+func validatePoolFlags(arguments *BuildCmdArguments) error {
+	if arguments.failFast && arguments.keepGoing {
+		return errors.New("--fail-fast and --keep-going could not be used together")
+	}
+	return nil
+}
+
+func addRuntimeFlag(cmd *cobra.Command, arguments *BuildCmdArguments) {
+	cmd.Flags().StringVarP(&arguments.runtime,
+		"runtime", "", tools.RuntimeAuto, "Container runtime to build images and run containers, one of: auto, docker, podman, nerdctl")
+}
+
 var buildCmd = &cobra.Command{
 	Use:   "build",
 	Short: "Perform a build of passed applications and tests CGO_ENABLED=0 GOOS=linux GOARCH=amd64",
@@ -80,7 +192,41 @@ func PerformBuild(cmd *cobra.Command, args []string, cmdArguments *BuildCmdArgum
 		return nil
 	}
 
-	env, cgoEnv := tools.RetrieveGoEnv(cmdArguments.cgoEnabled, cmdArguments.goos, cmdArguments.goarch)
+	if err := validateELFCheck(cmdArguments.elfCheck); err != nil {
+		logrus.Errorf("Failed to parse ELF check mode %v", err)
+		return err
+	}
+
+	if err := validatePoolFlags(cmdArguments); err != nil {
+		logrus.Errorf("Failed to select build mode %v", err)
+		return err
+	}
+
+	platforms, err := tools.ParsePlatforms(cmdArguments.platforms)
+	if err != nil {
+		logrus.Errorf("Failed to parse platforms %v", err)
+		return err
+	}
+	// In case no platforms are passed, we build for goos/goarch directly into output folder.
+	multiPlatform := len(platforms) > 0
+	if !multiPlatform {
+		platforms = []tools.Platform{{OS: cmdArguments.goos, Arch: cmdArguments.goarch}}
+	}
+	imageOptions := &tools.ImageBuildOptions{
+		BuildArgs: map[string]string{SkipBuildEnv: "true"},
+		Tags:      cmdArguments.imageTags,
+		Push:      cmdArguments.push,
+		Output:    cmdArguments.imageOutput,
+	}
+	if multiPlatform && cmdArguments.docker && !tools.IsDocker() {
+		// Check it before compile, since image is built after all binaries.
+		if err = tools.ValidateImageOutput(len(platforms), imageOptions); err != nil {
+			logrus.Errorf("Invalid image output %v", err)
+			return err
+		}
+	}
+
+	_, cgoEnv := tools.RetrieveGoEnv(cmdArguments.cgoEnabled, platforms[0].OS, platforms[0].Arch)
 
 	curDir, err := os.Getwd()
 	if err != nil {
@@ -88,69 +234,390 @@ func PerformBuild(cmd *cobra.Command, args []string, cmdArguments *BuildCmdArgum
 		return err
 	}
 
+	modules, err := findBuildModules(cmd.Context(), curDir, cmdArguments.outputFolder, cmdArguments.replaces, cgoEnv)
+	if err != nil {
+		logrus.Errorf("Failed to find modules %v", err)
+		return err
+	}
+
+	selected, err := newSelection(&cmdArguments.selection)
+	if err != nil {
+		logrus.Errorf("Failed to parse include/exclude patterns %v", err)
+		return err
+	}
+
+	apps, err := findModuleApps(cmd.Context(), modules, args, cgoEnv)
+	if err != nil {
+		logrus.Errorf("Failed to find applications %v", err)
+		return err
+	}
 	if len(args) == 0 {
-		args = tools.FindMainPackages(cmd.Context(), curDir, cgoEnv)
-	}
-
-	var wg sync.WaitGroup
-	var pkgError error
-	for _, root := range args {
-		rootDir := path.Clean(root)
-		_, cmdName := path.Split(path.Clean(rootDir))
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			logrus.Infof("Building: %v at %v", cmdName, rootDir)
-			buildCmd := []string{"go", "build", "-o", path.Join(cmdArguments.outputFolder, cmdName), rootDir}
-			if err := tools.Exec(cmd.Context(), curDir, buildCmd, env); err != nil {
-				logrus.Errorf("Error build: %v %v", buildCmd, err)
-				pkgError = err
+		// Applications passed explicitly are always built.
+		apps = selected.filterApps(curDir, apps)
+	}
+
+	filter, err := newChangeFilter(cmd.Context(), curDir, modules, cmdArguments.since, cgoEnv)
+	if err != nil {
+		logrus.Errorf("Failed to find changes %v", err)
+		return err
+	}
+
+	var cache *tools.BuildCache
+	if cmdArguments.cache {
+		cache = tools.LoadBuildCache(tools.StateDir(cmdArguments.outputFolder))
+	}
+
+	outDir := func(platform tools.Platform) string {
+		if multiPlatform {
+			return path.Join(cmdArguments.outputFolder, platform.Dir())
+		}
+		return cmdArguments.outputFolder
+	}
+
+	buildTime := time.Now()
+	buildFlags := cmdArguments.flags
+	var check *reproducibleCheck
+	if cmdArguments.reproducible {
+		if buildTime, err = tools.SourceDateEpoch(cmd.Context(), curDir); err != nil {
+			logrus.Errorf("Failed to resolve build time %v", err)
+			return err
+		}
+		buildFlags.Reproducible = true
+		check = &reproducibleCheck{}
+		logrus.Infof("Reproducible build, build time is %v", buildTime.Format(time.RFC3339))
+	}
+
+	versionInfo := tools.GitVersionInfo(cmd.Context(), curDir, buildTime)
+	flagArgs, err := buildFlags.Args(versionInfo)
+	if err != nil {
+		logrus.Errorf("Failed to prepare compiler flags %v", err)
+		return err
+	}
+	// Stamps are not applied to test binaries and only stamp templates are a part of build cache key.
+	testFlagArgs, _ := buildFlags.Args(nil)
+	keyArgs, _ := buildFlags.KeyArgs()
+	logrus.Infof("Version %v commit %v dirty %v", versionInfo.Version, versionInfo.Commit, versionInfo.Dirty)
+
+	manifest := &buildManifest{}
+	pool := tools.NewWorkerPool(cmd.Context(), cmdArguments.jobs, cmdArguments.failFast)
+	for _, a := range apps {
+		app := a
+		rootDir := app.dir
+		cmdName := app.name()
+
+		for _, p := range platforms {
+			if !filter.app(rootDir) {
+				break
 			}
-		}()
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			testPackages, err := tools.FindTests(cmd.Context(), rootDir, cgoEnv)
+			platform := p
+			env, _ := tools.RetrieveGoEnv(cmdArguments.cgoEnabled, platform.OS, platform.Arch)
+			env = app.module.goEnv(env)
+			outPath := path.Join(outDir(platform), cmdName)
+			compileCmd := append(append([]string{"go", "build"}, flagArgs...), coverArgs(cmdArguments, false)...)
+			keyCmd := append(append([]string{"go", "build"}, keyArgs...), coverArgs(cmdArguments, false)...)
+			check.add(&buildArtifact{moduleDir: app.module.Dir, compileCmd: compileCmd, pkgPath: rootDir, outPath: outPath, env: env})
+			pool.Go(outPath, func(ctx context.Context) (string, []string, error) {
+				logrus.Infof("Building: %v at %v for %v", cmdName, rootDir, platform)
+				status, output, err := compile(ctx, app.module.Dir, cache, compileCmd, keyCmd, rootDir, outPath, false, env)
+				if err != nil {
+					return status, output, err
+				}
+				problems, err := checkELF(outPath, platform, cmdArguments.cgoEnabled, cmdArguments.elfCheck)
+				output = append(output, problems...)
+				if err != nil {
+					return status, output, err
+				}
+				importPath, err := tools.ImportPath(ctx, rootDir, env)
+				if err != nil {
+					return status, output, err
+				}
+				return status, output, manifest.add(outPath, false, &tools.ManifestEntry{
+					Application: cmdName,
+					Folder:      relativeFolder(curDir, rootDir),
+					Package:     importPath,
+					Platform:    platform.String(),
+				})
+			})
+		}
+		pool.Go(rootDir+" tests", func(ctx context.Context) (string, []string, error) {
+			testPackages, err := tools.FindTests(ctx, rootDir, app.module.goEnv(cgoEnv))
 			if err != nil {
-				pkgError = err
-				return
+				return "", nil, err
 			}
+			found := 0
 			for k, p := range testPackages {
-				if len(p.Tests) > 0 {
-					pp := p
-					logrus.Infof("Found tests: %v for package: %v", pp.Tests, k)
-					if cmdArguments.compileTests {
-						wg.Add(1)
-						go func() {
-							defer wg.Done()
-							testPath := path.Join(rootDir, pp.RelPath)
-							buildCmd := []string{"go", "test", "-c", "-o", path.Join(cmdArguments.outputFolder, pp.OutName), testPath}
-							if err := tools.Exec(cmd.Context(), curDir, buildCmd, env); err != nil {
-								logrus.Errorf("Error build: %v %v", buildCmd, err)
-								pkgError = err
-								return
-							}
-							logrus.Infof("Compile of %v from %v complete", pp.OutName, testPath)
-						}()
-					}
+				if len(p.Tests) == 0 || !filter.test(p.Package) || !selected.test(p.Package, app.module.OutName(p.OutName)) {
+					continue
+				}
+				found++
+				pp := p
+				logrus.Infof("Found tests: %v for package: %v", pp.Tests, k)
+				if !cmdArguments.compileTests {
+					continue
+				}
+				testPath := path.Join(rootDir, pp.RelPath)
+				for _, pl := range platforms {
+					platform := pl
+					env, _ := tools.RetrieveGoEnv(cmdArguments.cgoEnabled, platform.OS, platform.Arch)
+					env = app.module.goEnv(env)
+					outPath := path.Join(outDir(platform), app.module.OutName(pp.OutName))
+					compileCmd := append(append([]string{"go", "test", "-c"}, testFlagArgs...), coverArgs(cmdArguments, true)...)
+					check.add(&buildArtifact{moduleDir: app.module.Dir, compileCmd: compileCmd, pkgPath: testPath, outPath: outPath, env: env})
+					pool.Go(outPath, func(ctx context.Context) (string, []string, error) {
+						status, output, err := compile(ctx, app.module.Dir, cache, compileCmd, compileCmd, testPath, outPath, true, env)
+						if err != nil {
+							return status, output, err
+						}
+						problems, err := checkELF(outPath, platform, cmdArguments.cgoEnabled, cmdArguments.elfCheck)
+						output = append(output, problems...)
+						if err != nil {
+							return status, output, err
+						}
+						return status, output, manifest.add(outPath, true, &tools.ManifestEntry{
+							Application: cmdName,
+							Folder:      relativeFolder(curDir, rootDir),
+							Package:     pp.Package,
+							Tests:       pp.Tests,
+							Platform:    platform.String(),
+						})
+					})
 				}
 			}
-		}()
+			return fmt.Sprintf("found %v test packages", found), nil, nil
+		})
+	}
+	results := pool.Wait()
+	failed := printBuildSummary(results)
+	printReplaces(cmdArguments.replaces)
+	if cache != nil {
+		if err = cache.Save(); err != nil {
+			logrus.Warnf("Failed to store build cache %v", err)
+		}
+	}
+	if failed > 0 {
+		err = errors.Errorf("%v of %v build steps are failed", failed, len(results))
+		logrus.Errorf("Build failed %v", err)
+		return err
+	}
+	if err = cmd.Context().Err(); err != nil {
+		return err
+	}
+	if err = check.verify(cmd.Context(), cmdArguments.jobs); err != nil {
+		logrus.Errorf("Build is not reproducible %v", err)
+		return err
+	}
+	if err = manifest.write(cmd.Context(), curDir, cmdArguments.outputFolder, platforms, multiPlatform); err != nil {
+		logrus.Errorf("Failed to write build manifest %v", err)
+		return err
 	}
-	wg.Wait()
-	if pkgError != nil {
-		logrus.Errorf("Build failed %v", pkgError)
-		return pkgError
+	if cmdArguments.sbom {
+		if err = writeSBOMs(cmdArguments.outputFolder, path.Base(curDir), buildTime); err != nil {
+			logrus.Errorf("Failed to write SBOM %v", err)
+			return err
+		}
+	}
+	if cmdArguments.sizeReport {
+		if err = reportSizes(cmdArguments.outputFolder, cmdArguments.sizeThreshold); err != nil {
+			logrus.Errorf("Size check failed %v", err)
+			return err
+		}
 	}
 
 	if cmdArguments.docker && !tools.IsDocker() {
-		logrus.Infof("Building docker container")
-		err := tools.Exec(cmd.Context(), curDir, []string{"docker", "build", "--build-arg", fmt.Sprintf("%s=true", SkipBuildEnv), "."}, env)
+		containerRuntime, err := tools.NewContainerRuntime(cmd.Context(), cmdArguments.runtime)
 		if err != nil {
-			logrus.Errorf("Failed to build docker container %v", err)
 			return err
 		}
+		logrus.Infof("Building container with %v", containerRuntime.Name())
+		if multiPlatform {
+			// Every platform has own subtree, so Dockerfile could pick it with ${TARGETOS}_${TARGETARCH}.
+			err = containerRuntime.BuildPlatforms(cmd.Context(), curDir, platforms, imageOptions)
+		} else {
+			_, err = buildTarget(cmd.Context(), containerRuntime, curDir, "")
+		}
+		if err != nil {
+			logrus.Errorf("Failed to build container %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func printReplaces(values []string) {
+	replaces, err := tools.ParseReplaces(values)
+	if err != nil || len(replaces) == 0 {
+		return
+	}
+	logrus.Infof("Active go.mod overrides:")
+	for _, r := range replaces {
+		logrus.Infof("  replace %v", r)
+	}
+}
+
+const (
+	statusCached    = "cached"
+	statusRebuilt   = "rebuilt"
+	statusUnchanged = "unchanged"
+	statusFailed    = "failed"
+)
+
+// buildManifest - collect all produced binaries to be stored into manifest.
+type buildManifest struct {
+	lock         sync.Mutex
+	applications []*tools.ManifestEntry
+	tests        []*tools.ManifestEntry
+}
+
+func (m *buildManifest) add(outPath string, test bool, entry *tools.ManifestEntry) error {
+	sha, err := tools.FileHash(outPath)
+	if err != nil {
+		return err
+	}
+	entry.Name = path.Base(outPath)
+	entry.SHA256 = sha
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if test {
+		m.tests = append(m.tests, entry)
+	} else {
+		m.applications = append(m.applications, entry)
 	}
 	return nil
 }
+
+// write - store a manifest into every platform folder, for multi platform builds an aggregated manifest
+// is also stored into output folder.
+func (m *buildManifest) write(ctx context.Context, curDir, outputFolder string, platforms []tools.Platform, multiPlatform bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	goVersion := tools.GoVersion(ctx, curDir)
+	gitCommit := tools.GitCommit(ctx, curDir)
+	newManifest := func(filter func(e *tools.ManifestEntry) (string, bool)) *tools.Manifest {
+		result := &tools.Manifest{
+			GoVersion:    goVersion,
+			GitCommit:    gitCommit,
+			Applications: []*tools.ManifestEntry{},
+			Tests:        []*tools.ManifestEntry{},
+		}
+		for _, e := range m.applications {
+			if p, ok := filter(e); ok {
+				entry := *e
+				entry.Path = p
+				result.Applications = append(result.Applications, &entry)
+			}
+		}
+		for _, e := range m.tests {
+			if p, ok := filter(e); ok {
+				entry := *e
+				entry.Path = p
+				result.Tests = append(result.Tests, &entry)
+			}
+		}
+		return result
+	}
+
+	if !multiPlatform {
+		return newManifest(func(e *tools.ManifestEntry) (string, bool) {
+			return e.Name, true
+		}).Write(outputFolder)
+	}
+	for _, p := range platforms {
+		platform := p
+		if err := newManifest(func(e *tools.ManifestEntry) (string, bool) {
+			return e.Name, e.Platform == platform.String()
+		}).Write(path.Join(outputFolder, platform.Dir())); err != nil {
+			return err
+		}
+	}
+	dirs := map[string]string{}
+	for _, p := range platforms {
+		dirs[p.String()] = p.Dir()
+	}
+	return newManifest(func(e *tools.ManifestEntry) (string, bool) {
+		return path.Join(dirs[e.Platform], e.Name), true
+	}).Write(outputFolder)
+}
+
+// printBuildSummary - print a table of all build steps, output of failed ones and warnings of succeeded ones,
+// return a number of failed steps.
+func printBuildSummary(results []*tools.TaskResult) int {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "\nSTEP\tSTATUS\tTIME")
+	counts := map[string]int{}
+	failures := []*tools.TaskResult{}
+	warnings := []*tools.TaskResult{}
+	for _, r := range results {
+		status := r.Status
+		if r.Err != nil && r.Status != tools.StatusCanceled {
+			status = statusFailed
+			failures = append(failures, r)
+		} else if r.Err == nil && len(r.Output) > 0 {
+			warnings = append(warnings, r)
+		}
+		counts[status]++
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%v\n", r.Name, status, r.Duration.Round(time.Millisecond))
+	}
+	_ = w.Flush()
+
+	for _, r := range warnings {
+		_, _ = fmt.Fprintf(os.Stdout, "\n==== %v warnings:\n", r.Name)
+		for _, line := range r.Output {
+			_, _ = fmt.Fprintln(os.Stdout, line)
+		}
+	}
+
+	for _, r := range failures {
+		_, _ = fmt.Fprintf(os.Stdout, "\n==== %v failed: %v\n", r.Name, r.Err)
+		for _, line := range r.Output {
+			_, _ = fmt.Fprintln(os.Stdout, line)
+		}
+	}
+	logrus.Infof("Build complete: %v %v, %v %v, %v %v, %v %v, %v %v, %v with warnings", counts[statusRebuilt], statusRebuilt,
+		counts[statusUnchanged], statusUnchanged, counts[statusCached], statusCached,
+		counts[statusFailed], statusFailed, counts[tools.StatusSkipped]+counts[tools.StatusCanceled], tools.StatusSkipped,
+		len(warnings))
+	return len(failures)
+}
+
+// compile - compile a package into outPath with compileCmd executed in module dir, if cache is passed and package sources and dependencies
+// are not changed since last compile, compile will be skipped. Output file is replaced only if its content is changed.
+func compile(ctx context.Context, moduleDir string, cache *tools.BuildCache, compileCmd, keyCmd []string, pkgPath, outPath string, test bool, env []string) (string, []string, error) {
+	key := ""
+	if cache != nil {
+		var err error
+		key, err = tools.PackageHash(ctx, moduleDir, pkgPath, test, env, keyCmd...)
+		if err != nil {
+			logrus.Warnf("Failed to calculate build cache key for %v: %v", pkgPath, err)
+		} else if cache.IsValid(outPath, key) {
+			return statusCached, nil, nil
+		}
+	}
+	if err := os.MkdirAll(path.Dir(outPath), os.ModePerm); err != nil {
+		return "", nil, err
+	}
+	// Compiler is executed in module dir, so output is passed with absolute path.
+	tmpPath, err := filepath.Abs(outPath + ".dgo-tmp")
+	if err != nil {
+		return "", nil, err
+	}
+	buildCmd := append(append([]string{}, compileCmd...), "-o", tmpPath, pkgPath)
+	// Compiler output of succeeded build, like cgo warnings, is returned to be printed in build summary.
+	output, err := tools.ExecReadAll(ctx, moduleDir, buildCmd, env, true)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return "", output, errors.Wrapf(err, "failed to compile %v", buildCmd)
+	}
+	changed, err := tools.ReplaceIfChanged(tmpPath, outPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if cache != nil && key != "" {
+		cache.Update(outPath, key)
+	}
+	if changed {
+		return statusRebuilt, output, nil
+	}
+	return statusUnchanged, output, nil
+}
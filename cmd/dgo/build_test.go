@@ -0,0 +1,106 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"context"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidatePoolFlags(t *testing.T) {
+	tests := []struct {
+		failFast  bool
+		keepGoing bool
+		wantErr   bool
+	}{
+		{},
+		{failFast: true},
+		{keepGoing: true},
+		{failFast: true, keepGoing: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := validatePoolFlags(&BuildCmdArguments{failFast: tt.failFast, keepGoing: tt.keepGoing})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validatePoolFlags(fail-fast=%v, keep-going=%v) = %v, wantErr %v", tt.failFast, tt.keepGoing, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBuildManifestWrite(t *testing.T) {
+	outputFolder := t.TempDir()
+	platforms := []tools.Platform{{OS: "linux", Arch: "amd64"}, {OS: "linux", Arch: "arm64"}}
+	m := &buildManifest{}
+	for _, p := range platforms {
+		for _, test := range []bool{false, true} {
+			name := "app"
+			if test {
+				name = "app_pkg.test"
+			}
+			outPath := filepath.Join(outputFolder, p.Dir(), name)
+			if err := os.MkdirAll(filepath.Dir(outPath), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(outPath, []byte(p.String()), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.add(outPath, test, &tools.ManifestEntry{Application: "app", Package: "example.com/app", Platform: p.String()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := m.write(context.Background(), outputFolder, outputFolder, platforms, true); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := func(folder string) ([]string, []string) {
+		t.Helper()
+		manifest, err := tools.ReadManifest(folder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		apps, tests := []string{}, []string{}
+		for _, e := range manifest.Applications {
+			apps = append(apps, e.Platform+"="+e.Path)
+		}
+		for _, e := range manifest.Tests {
+			tests = append(tests, e.Platform+"="+e.Path)
+		}
+		return apps, tests
+	}
+	// Every platform folder has own manifest with paths relative to it.
+	for _, p := range platforms {
+		apps, tests := paths(filepath.Join(outputFolder, p.Dir()))
+		if want := []string{p.String() + "=app"}; !reflect.DeepEqual(apps, want) {
+			t.Errorf("%v applications = %v, want %v", p, apps, want)
+		}
+		if want := []string{p.String() + "=app_pkg.test"}; !reflect.DeepEqual(tests, want) {
+			t.Errorf("%v tests = %v, want %v", p, tests, want)
+		}
+	}
+	// Aggregated manifest merges all platforms with paths relative to output folder.
+	apps, tests := paths(outputFolder)
+	if want := []string{"linux/amd64=linux_amd64/app", "linux/arm64=linux_arm64/app"}; !reflect.DeepEqual(apps, want) {
+		t.Errorf("aggregated applications = %v, want %v", apps, want)
+	}
+	if want := []string{"linux/amd64=linux_amd64/app_pkg.test", "linux/arm64=linux_arm64/app_pkg.test"}; !reflect.DeepEqual(tests, want) {
+		t.Errorf("aggregated tests = %v, want %v", tests, want)
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// ConfigFileName - a name of project configuration file stored in module root.
+	ConfigFileName = "dgo.yaml"
+	// ConfigEnv - an environment variable to pass a path to configuration file.
+	ConfigEnv = "DGO_CONFIG"
+	// ProfileEnv - an environment variable to select a configuration profile.
+	ProfileEnv = "DGO_PROFILE"
+
+	sourceDefault = "default"
+	sourceConfig  = "config"
+	sourceProfile = "profile"
+	sourceFlag    = "flag"
+)
+
+// projectConfig - a dgo.yaml content, every command section is a map of command flag names to values.
+type projectConfig struct {
+	Build    map[string]interface{}    `yaml:"build,omitempty"`
+	Test     map[string]interface{}    `yaml:"test,omitempty"`
+	List     map[string]interface{}    `yaml:"list,omitempty"`
+	Spire    map[string]interface{}    `yaml:"spire,omitempty"`
+	Do       map[string]interface{}    `yaml:"do,omitempty"`
+	Watch    map[string]interface{}    `yaml:"watch,omitempty"`
+	Profiles map[string]*projectConfig `yaml:"profiles,omitempty"`
+}
+
+func (c *projectConfig) sections() map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{
+		buildCmd.Name(): c.Build,
+		testCmd.Name():  c.Test,
+		listCmd.Name():  c.List,
+		spireCmd.Name(): c.Spire,
+		doCmd.Name():    c.Do,
+		watchCmd.Name(): c.Watch,
+	}
+}
+
+var configArguments = struct {
+	config  string
+	profile string
+}{}
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&configArguments.config,
+		"config", "", "", fmt.Sprintf("Path to configuration file, by default %s from module root is used, could be set with %s", ConfigFileName, ConfigEnv))
+
+	rootCmd.PersistentFlags().StringVarP(&configArguments.profile,
+		"profile", "", "", fmt.Sprintf("Configuration profile to use, could be set with %s", ProfileEnv))
+
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if cmd == configCmd {
+			return nil
+		}
+		config, err := loadProjectConfig()
+		if err != nil {
+			return err
+		}
+		_, err = applyProjectConfig(cmd, config)
+		return err
+	}
+
+	rootCmd.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Print an effective configuration",
+	Long:  `Print an effective configuration of all commands, merged from defaults, configuration file, selected profile and flags`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := loadProjectConfig()
+		if err != nil {
+			return err
+		}
+		out := strings.Builder{}
+		if fileName := configFileName(); fileName != "" {
+			out.WriteString(fmt.Sprintf("# config: %s\n", fileName))
+		}
+		if profile := configProfile(); profile != "" {
+			out.WriteString(fmt.Sprintf("# profile: %s\n", profile))
+		}
+		for _, c := range []*cobra.Command{buildCmd, testCmd, listCmd, spireCmd, doCmd, watchCmd} {
+			sources, err := applyProjectConfig(c, config)
+			if err != nil {
+				return err
+			}
+			out.WriteString(c.Name() + ":\n")
+			c.LocalNonPersistentFlags().VisitAll(func(f *pflag.Flag) {
+				if f.Name == "help" {
+					return
+				}
+				out.WriteString(fmt.Sprintf("  %s: %s # %s\n", f.Name, formatFlagValue(f), sources[f.Name]))
+			})
+		}
+		_, err = os.Stdout.WriteString(out.String())
+		return err
+	},
+}
+
+// configFileName - return a path to configuration file, or empty string if there is no one.
+func configFileName() string {
+	if configArguments.config != "" {
+		return configArguments.config
+	}
+	if fileName := os.Getenv(ConfigEnv); fileName != "" {
+		return fileName
+	}
+	// Look for module root, starting from current directory.
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err = os.Stat(path.Join(dir, "go.mod")); err == nil {
+			fileName := path.Join(dir, ConfigFileName)
+			if _, err = os.Stat(fileName); err == nil {
+				return fileName
+			}
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func configProfile() string {
+	if configArguments.profile != "" {
+		return configArguments.profile
+	}
+	return os.Getenv(ProfileEnv)
+}
+
+// loadProjectConfig - load a configuration file, an empty configuration is returned if there is no file.
+func loadProjectConfig() (*projectConfig, error) {
+	config := &projectConfig{}
+	fileName := configFileName()
+	if fileName == "" {
+		if profile := configProfile(); profile != "" {
+			return nil, errors.Errorf("profile %s is selected, but no %s is found", profile, ConfigFileName)
+		}
+		return config, nil
+	}
+	content, err := ioutil.ReadFile(fileName) // #nosec
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read configuration %v", fileName)
+	}
+	if err = yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse configuration %v", fileName)
+	}
+	if profile := configProfile(); profile != "" {
+		if _, ok := config.Profiles[profile]; !ok {
+			return nil, errors.Errorf("profile %s is not found in %v", profile, fileName)
+		}
+	}
+	logrus.Infof("Using configuration %v", fileName)
+	return config, nil
+}
+
+// applyProjectConfig - set command flags from configuration section and selected profile,
+// flags passed with command line are not changed. Return a source of every flag value.
+func applyProjectConfig(cmd *cobra.Command, config *projectConfig) (map[string]string, error) {
+	sources := map[string]string{}
+	cmd.LocalNonPersistentFlags().VisitAll(func(f *pflag.Flag) {
+		sources[f.Name] = sourceDefault
+		if f.Changed {
+			sources[f.Name] = sourceFlag
+		}
+	})
+
+	values := map[string]interface{}{}
+	for k, v := range config.sections()[cmd.Name()] {
+		values[k] = v
+		sources[k] = sourceConfig
+	}
+	if profile, ok := config.Profiles[configProfile()]; ok && profile != nil {
+		for k, v := range profile.sections()[cmd.Name()] {
+			values[k] = v
+			sources[k] = sourceProfile
+		}
+	}
+
+	names := []string{}
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := cmd.LocalNonPersistentFlags().Lookup(name)
+		if f == nil {
+			return nil, errors.Errorf("unknown option %v for %v command", name, cmd.Name())
+		}
+		if f.Changed {
+			// Command line flags take precedence.
+			sources[name] = sourceFlag
+			continue
+		}
+		if err := setFlagValue(f, values[name]); err != nil {
+			return nil, errors.Wrapf(err, "invalid value of option %v for %v command", name, cmd.Name())
+		}
+	}
+	return sources, nil
+}
+
+func setFlagValue(f *pflag.Flag, value interface{}) error {
+	items := []string{}
+	if list, ok := value.([]interface{}); ok {
+		for _, v := range list {
+			items = append(items, fmt.Sprint(v))
+		}
+	} else {
+		items = append(items, fmt.Sprint(value))
+	}
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		return sv.Replace(items)
+	}
+	if len(items) != 1 {
+		return errors.Errorf("a single value is expected, but %v is passed", value)
+	}
+	return f.Value.Set(items[0])
+}
+
+func formatFlagValue(f *pflag.Flag) string {
+	quote := func(value string) string {
+		out, err := yaml.Marshal(value)
+		if err != nil {
+			return value
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		items := []string{}
+		for _, v := range sv.GetSlice() {
+			items = append(items, quote(v))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	if f.Value.Type() == "string" {
+		return quote(f.Value.String())
+	}
+	return f.Value.String()
+}
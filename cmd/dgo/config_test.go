@@ -0,0 +1,90 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"github.com/spf13/cobra"
+	"reflect"
+	"testing"
+)
+
+func TestApplyProjectConfigPrecedence(t *testing.T) {
+	arguments := struct {
+		fromFlag, fromProfile, fromSection, fromDefault string
+	}{}
+	cmd := &cobra.Command{Use: "list"}
+	cmd.Flags().StringVarP(&arguments.fromFlag, "a", "", "default", "")
+	cmd.Flags().StringVarP(&arguments.fromProfile, "b", "", "default", "")
+	cmd.Flags().StringVarP(&arguments.fromSection, "c", "", "default", "")
+	cmd.Flags().StringVarP(&arguments.fromDefault, "d", "", "default", "")
+	if err := cmd.Flags().Set("a", "flag"); err != nil {
+		t.Fatal(err)
+	}
+
+	configArguments.profile = "ci"
+	defer func() { configArguments.profile = "" }()
+	config := &projectConfig{
+		List: map[string]interface{}{"a": "section", "b": "section", "c": "section"},
+		Profiles: map[string]*projectConfig{
+			"ci":    {List: map[string]interface{}{"a": "profile", "b": "profile"}},
+			"other": {List: map[string]interface{}{"c": "other"}},
+		},
+	}
+	sources, err := applyProjectConfig(cmd, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{arguments.fromFlag, arguments.fromProfile, arguments.fromSection, arguments.fromDefault}
+	if want := []string{"flag", "profile", "section", "default"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("values = %v, want %v", got, want)
+	}
+	wantSources := map[string]string{"a": sourceFlag, "b": sourceProfile, "c": sourceConfig, "d": sourceDefault}
+	if !reflect.DeepEqual(sources, wantSources) {
+		t.Errorf("sources = %v, want %v", sources, wantSources)
+	}
+}
+
+func TestApplyProjectConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		section map[string]interface{}
+	}{
+		{name: "unknown option", section: map[string]interface{}{"unknown": true}},
+		{name: "invalid value", section: map[string]interface{}{"jobs": "many"}},
+		{name: "list for single value", section: map[string]interface{}{"jobs": []interface{}{1, 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := 0
+			cmd := &cobra.Command{Use: "list"}
+			cmd.Flags().IntVarP(&jobs, "jobs", "", 1, "")
+			if _, err := applyProjectConfig(cmd, &projectConfig{List: tt.section}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestApplyProjectConfigList(t *testing.T) {
+	defer func() { listArguments.build.goarch = "amd64" }()
+	if _, err := applyProjectConfig(listCmd, &projectConfig{List: map[string]interface{}{"goarch": "arm64"}}); err != nil {
+		t.Fatal(err)
+	}
+	if listArguments.build.goarch != "arm64" || listArguments.build.goos != "linux" {
+		t.Errorf("list platform = %v/%v, want linux/arm64", listArguments.build.goos, listArguments.build.goarch)
+	}
+}
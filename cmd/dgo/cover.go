@@ -0,0 +1,122 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"context"
+	"fmt"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+const (
+	// coverContainerDir - a folder inside test container coverage data folder of host is mounted to.
+	coverContainerDir = "/dgo-cover"
+	// coverAppsDir - a folder inside coverage data folder applications started by tests write coverage data to.
+	coverAppsDir = "apps"
+)
+
+func addCoverFlags(cmd *cobra.Command, arguments *BuildCmdArguments) {
+	cmd.Flags().BoolVarP(&arguments.cover,
+		"cover", "", false, "Build test binaries with coverage instrumentation")
+
+	cmd.Flags().BoolVarP(&arguments.coverApps,
+		"cover-apps", "", false, "Build applications with coverage instrumentation, like go build -cover")
+
+	cmd.Flags().StringVarP(&arguments.coverPkg,
+		"coverpkg", "", "", "Comma separated list of package patterns to instrument, by default only packages of binary module")
+}
+
+// coverArgs - return compile arguments of application or test binary to build it with coverage instrumentation if enabled.
+func coverArgs(arguments *BuildCmdArguments, test bool) []string {
+	if (test && arguments.cover) || (!test && arguments.coverApps) {
+		return tools.CoverArgs(arguments.coverPkg)
+	}
+	return nil
+}
+
+// coverTestArgs - return arguments of test binary to write coverage data into own folder inside coverDir,
+// empty coverDir means coverage is not collected.
+func coverTestArgs(coverDir, outName string) ([]string, error) {
+	if coverDir == "" {
+		return nil, nil
+	}
+	dir := path.Join(coverDir, tools.SafeName(outName))
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return []string{"-test.gocoverdir=" + dir}, nil
+}
+
+// reportCoverage - merge coverage data written by test binaries and applications into a profile inside coverDir,
+// print a percent of covered statements per package and write HTML report.
+func reportCoverage(ctx context.Context, curDir, coverDir string) error {
+	dataDir, err := filepath.Abs(path.Join(coverDir, "data"))
+	if err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(dataDir)
+	if err != nil {
+		return err
+	}
+	dataDirs := []string{}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		if content, err := ioutil.ReadDir(path.Join(dataDir, f.Name())); err == nil && len(content) > 0 {
+			dataDirs = append(dataDirs, path.Join(dataDir, f.Name()))
+		}
+	}
+	if len(dataDirs) == 0 {
+		logrus.Warnf("No coverage data is found in %v", dataDir)
+		return nil
+	}
+	report, err := tools.MergeCoverage(ctx, curDir, dataDirs, coverDir, nil)
+	if err != nil {
+		return err
+	}
+
+	packages := []string{}
+	for pkg := range report.Statements {
+		packages = append(packages, pkg)
+	}
+	sort.Strings(packages)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "\nPACKAGE\tSTATEMENTS\tCOVERAGE")
+	for _, pkg := range packages {
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%.1f%%\n", pkg, report.Statements[pkg], report.Percent(pkg))
+	}
+	_ = w.Flush()
+	logrus.Infof("Total coverage %.1f%% of statements, profile %v", report.Percent(""), path.Join(coverDir, tools.CoverProfileName))
+
+	htmlFile := path.Join(coverDir, tools.CoverHTMLName)
+	if err = tools.CoverHTML(ctx, curDir, path.Join(coverDir, tools.CoverProfileName), htmlFile, nil); err != nil {
+		// Report requires sources, so it could fail if some packages are not resolved from current dir.
+		logrus.Warnf("Failed to write coverage HTML report %v", err)
+		return nil
+	}
+	logrus.Infof("Coverage HTML report %v", htmlFile)
+	return nil
+}
@@ -23,9 +23,16 @@ import (
 	"os"
 )
 
+var doArguments = struct {
+	dir string
+}{}
+
 func init() {
 	cmd := doCmd
 	rootCmd.AddCommand(cmd)
+
+	doCmd.Flags().StringVarP(&doArguments.dir,
+		"dir", "", "", "Working directory for command, current directory is used by default")
 }
 
 var doCmd = &cobra.Command{
@@ -38,6 +45,6 @@ var doCmd = &cobra.Command{
 			logrus.Infof("Do %v is complete on host. Success.", args)
 			return nil
 		}
-		return tools.Exec(cmd.Context(), "", args, nil)
+		return tools.Exec(cmd.Context(), doArguments.dir, args, nil)
 	},
 }
@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	elfCheckOff   = "off"
+	elfCheckWarn  = "warn"
+	elfCheckError = "error"
+)
+
+func addELFCheckFlag(cmd *cobra.Command, arguments *BuildCmdArguments) {
+	cmd.Flags().StringVarP(&arguments.elfCheck,
+		"elf-check", "", elfCheckWarn, "Verify binaries match --goarch and are statically linked if cgo is disabled, one of: off, warn, error")
+}
+
+func validateELFCheck(mode string) error {
+	switch mode {
+	case elfCheckOff, elfCheckWarn, elfCheckError:
+		return nil
+	}
+	return errors.Errorf("invalid --elf-check %q, expected one of: off, warn, error", mode)
+}
+
+// checkELF - verify compiled binary according to mode, found problems are returned as build step output,
+// in error mode an error is returned as well, so step is failed.
+func checkELF(outPath string, platform tools.Platform, cgoEnabled bool, mode string) ([]string, error) {
+	if mode == elfCheckOff {
+		return nil, nil
+	}
+	problems, err := tools.CheckELF(outPath, platform.Arch, !cgoEnabled)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 && mode == elfCheckError {
+		return problems, errors.Errorf("%v failed ELF checks", outPath)
+	}
+	return problems, nil
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	templateMinimal    = "minimal"
+	templateSpire      = "spire"
+	templateDistroless = "distroless"
+	// minGoVersion - dgo could not be installed with older go versions.
+	minGoVersion = "1.20"
+)
+
+var initArguments = struct {
+	template     string
+	force        bool
+	goVersion    string
+	spireVersion string
+}{}
+
+func init() {
+	cmd := initCmd
+	rootCmd.AddCommand(cmd)
+
+	initCmd.Flags().StringVarP(&initArguments.template,
+		"template", "t", templateSpire, "Dockerfile template to use, one of: minimal, spire, distroless")
+
+	initCmd.Flags().BoolVarP(&initArguments.force,
+		"force", "f", false, "If enabled will overwrite existing Dockerfile and .dockerignore")
+
+	initCmd.Flags().StringVarP(&initArguments.goVersion,
+		"go-version", "", "", "Version of golang docker image, by default version of local go compiler is used")
+
+	initCmd.Flags().StringVarP(&initArguments.spireVersion,
+		"spire-version", "", "0.10.0", "Version of spire to put into test image")
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a Dockerfile with build and test targets for current module",
+	Long: `Create a Dockerfile with build and test targets and .dockerignore for current module.
+Templates:
+	minimal - test target with dgo and dlv, tests are running without spire, alpine based application image.
+	spire - test target with dgo, dlv and spire, alpine based application image.
+	distroless - test target with dgo, dlv and spire, distroless based application image.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logrus.Infof("dgo.init target...")
+		curDir, err := os.Getwd()
+		if err != nil {
+			logrus.Errorf("Failed to receive current dir %v", err)
+			return err
+		}
+
+		files, err := generateInitFiles(cmd, curDir)
+		if err != nil {
+			return err
+		}
+
+		names := []string{}
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if !initArguments.force {
+			for _, name := range names {
+				if _, err = os.Stat(path.Join(curDir, name)); err == nil {
+					return errors.Errorf("%v already exists, use --force to overwrite it", name)
+				}
+			}
+		}
+		for _, name := range names {
+			if err = ioutil.WriteFile(path.Join(curDir, name), []byte(files[name]), 0644); err != nil {
+				logrus.Errorf("Failed to write %v %v", name, err)
+				return err
+			}
+			logrus.Infof("%v is created", name)
+		}
+		return nil
+	},
+}
+
+type initTemplateData struct {
+	GoVersion    string
+	SpireVersion string
+	Spire        bool
+	// SpireArch - spire release asset name of every supported TARGETARCH.
+	SpireArch    map[string]string
+	SpireLibc    string
+	BaseImage    string
+	Apps         []string
+	SkipBuildEnv string
+}
+
+func generateInitFiles(cmd *cobra.Command, curDir string) (map[string]string, error) {
+	data := &initTemplateData{
+		GoVersion:    initArguments.goVersion,
+		SpireVersion: initArguments.spireVersion,
+		SkipBuildEnv: SkipBuildEnv,
+	}
+	switch initArguments.template {
+	case templateMinimal:
+		data.BaseImage = "alpine"
+	case templateSpire:
+		data.BaseImage = "alpine"
+		data.Spire = true
+	case templateDistroless:
+		data.BaseImage = "gcr.io/distroless/static"
+		data.Spire = true
+	default:
+		return nil, errors.Errorf("unknown template %q, expected one of: minimal, spire, distroless", initArguments.template)
+	}
+	if data.GoVersion == "" {
+		data.GoVersion = strings.TrimPrefix(tools.GoVersion(cmd.Context(), curDir), "go")
+		// Use only major.minor, docker images are published for them.
+		if parts := strings.Split(data.GoVersion, "."); len(parts) > 2 {
+			data.GoVersion = strings.Join(parts[:2], ".")
+		}
+		if data.GoVersion == "" {
+			data.GoVersion = minGoVersion
+		}
+	}
+	if !versionAtLeast(data.GoVersion, minGoVersion) {
+		return nil, errors.Errorf("go %v is not supported, dgo requires go %v or newer, please use --go-version", data.GoVersion, minGoVersion)
+	}
+	data.SpireArch, data.SpireLibc = spireAssets(data.SpireVersion)
+
+	_, cgoEnv := tools.RetrieveGoEnv(false, "linux", "amd64")
+	modules, err := findBuildModules(cmd.Context(), curDir, "", nil, cgoEnv)
+	if err != nil {
+		return nil, err
+	}
+	apps, err := findModuleApps(cmd.Context(), modules, nil, cgoEnv)
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range apps {
+		rel, err := filepath.Rel(curDir, app.dir)
+		if err != nil || rel == "." {
+			rel = app.dir
+		}
+		logrus.Infof("Found application %v at %v", app.name(), rel)
+		data.Apps = append(data.Apps, app.name())
+	}
+
+	result := map[string]string{}
+	for name, text := range map[string]string{"Dockerfile": dockerfileTemplate, ".dockerignore": dockerignoreTemplate} {
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		content := strings.Builder{}
+		if err = tmpl.Execute(&content, data); err != nil {
+			return nil, err
+		}
+		result[name] = content.String()
+	}
+	return result, nil
+}
+
+// spireAssets - return spire release asset architecture names by TARGETARCH and libc suffix,
+// releases before 1.6.0 are published only for x86_64 with glibc.
+func spireAssets(version string) (map[string]string, string) {
+	if versionAtLeast(version, "1.6") {
+		return map[string]string{"amd64": "amd64", "arm64": "arm64"}, "musl"
+	}
+	return map[string]string{"amd64": "x86_64"}, "glibc"
+}
+
+// versionAtLeast - compare major.minor part of versions like 1.20, 1.20.3 or v1.6.0,
+// a version which could not be parsed is considered as an old one.
+func versionAtLeast(version, min string) bool {
+	parse := func(v string) (int, int, bool) {
+		parts := strings.Split(strings.TrimPrefix(strings.TrimPrefix(v, "go"), "v"), ".")
+		if len(parts) < 2 {
+			return 0, 0, false
+		}
+		major, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return 0, 0, false
+		}
+		minor, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, 0, false
+		}
+		return major, minor, true
+	}
+	major, minor, ok := parse(version)
+	minMajor, minMinor, _ := parse(min)
+	if !ok {
+		return false
+	}
+	return major > minMajor || major == minMajor && minor >= minMinor
+}
+
+const dockerfileTemplate = `FROM golang:{{.GoVersion}} as go
+ENV GO111MODULE=on
+ENV CGO_ENABLED=0
+ENV GOBIN=/bin
+ENV DGO_CONTAINER=true
+RUN go install github.com/go-delve/delve/cmd/dlv@latest
+RUN go install github.com/haiodo/dgo@latest
+{{- if .Spire}}
+ARG TARGETARCH
+RUN case "${TARGETARCH:-amd64}" in \
+{{- range $arch, $name := .SpireArch}}
+      {{$arch}}) spire_arch={{$name}} ;; \
+{{- end}}
+      *) echo "spire {{.SpireVersion}} is not published for ${TARGETARCH}" && exit 1 ;; \
+    esac && \
+    mkdir -p /opt/spire && \
+    curl -sL https://github.com/spiffe/spire/releases/download/v{{.SpireVersion}}/spire-{{.SpireVersion}}-linux-${spire_arch}-{{.SpireLibc}}.tar.gz | \
+    tar -xz -C /opt/spire --strip-components=1 && \
+    cp /opt/spire/bin/spire-server /opt/spire/bin/spire-agent /bin/
+{{- end}}
+
+FROM go as build
+# If {{.SkipBuildEnv}}=true, binaries are taken from ./dist folder compiled on host with dgo build
+ARG {{.SkipBuildEnv}}=false
+ARG TARGETOS
+ARG TARGETARCH
+WORKDIR /build
+COPY go.* ./
+RUN go mod download
+COPY . .
+RUN dgo build --docker=false --output ./dist && \
+    mkdir -p /dgo-bin && \
+    if [ -d "./dist/${TARGETOS}_${TARGETARCH}" ]; then cp -r "./dist/${TARGETOS}_${TARGETARCH}/." /dgo-bin/; else cp -r ./dist/. /dgo-bin/; fi && \
+    rm -rf /dgo-bin/.dgo
+
+FROM build as test
+RUN cp -r /dgo-bin/. /bin/
+{{- if .Spire}}
+CMD dgo test
+{{- else}}
+CMD dgo test --spire=false
+{{- end}}
+
+FROM {{.BaseImage}} as runtime
+{{- range .Apps}}
+COPY --from=build /dgo-bin/{{.}} /bin/{{.}}
+{{- end}}
+{{- if eq (len .Apps) 1}}
+ENTRYPOINT ["/bin/{{index .Apps 0}}"]
+{{- end}}
+`
+
+const dockerignoreTemplate = `.git
+.idea
+.vscode
+Dockerfile
+.dockerignore
+dist/.dgo
+`
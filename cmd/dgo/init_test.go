@@ -0,0 +1,82 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{version: "1.20", want: true},
+		{version: "1.20.3", want: true},
+		{version: "go1.21", want: true},
+		{version: "2.0", want: true},
+		{version: "1.19", want: false},
+		{version: "1.14", want: false},
+		{version: "", want: false},
+		{version: "latest", want: false},
+	}
+	for _, tt := range tests {
+		if got := versionAtLeast(tt.version, minGoVersion); got != tt.want {
+			t.Errorf("versionAtLeast(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestSpireAssets(t *testing.T) {
+	tests := []struct {
+		version  string
+		wantArch map[string]string
+		wantLibc string
+	}{
+		{version: "0.10.0", wantArch: map[string]string{"amd64": "x86_64"}, wantLibc: "glibc"},
+		{version: "1.5.4", wantArch: map[string]string{"amd64": "x86_64"}, wantLibc: "glibc"},
+		{version: "1.6.0", wantArch: map[string]string{"amd64": "amd64", "arm64": "arm64"}, wantLibc: "musl"},
+	}
+	for _, tt := range tests {
+		arch, libc := spireAssets(tt.version)
+		if !reflect.DeepEqual(arch, tt.wantArch) || libc != tt.wantLibc {
+			t.Errorf("spireAssets(%q) = %v %v, want %v %v", tt.version, arch, libc, tt.wantArch, tt.wantLibc)
+		}
+	}
+}
+
+func TestDockerfileTemplateSpire(t *testing.T) {
+	data := &initTemplateData{GoVersion: "1.20", SpireVersion: "1.6.0", Spire: true, BaseImage: "alpine", SkipBuildEnv: SkipBuildEnv}
+	data.SpireArch, data.SpireLibc = spireAssets(data.SpireVersion)
+	content := strings.Builder{}
+	if err := template.Must(template.New("Dockerfile").Parse(dockerfileTemplate)).Execute(&content, data); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"RUN go install github.com/haiodo/dgo@latest",
+		"amd64) spire_arch=amd64 ;;",
+		"arm64) spire_arch=arm64 ;;",
+		"spire-1.6.0-linux-${spire_arch}-musl.tar.gz",
+	} {
+		if !strings.Contains(content.String(), want) {
+			t.Errorf("Dockerfile doesn't contain %q:\n%v", want, content.String())
+		}
+	}
+}
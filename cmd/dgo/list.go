@@ -25,24 +25,35 @@ import (
 	"github.com/spf13/cobra"
 	"os"
 	"path"
-	"path/filepath"
-	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 var listArguments = struct {
-	spire       bool
-	cgo_enabled bool
+	spire        bool
+	build        BuildCmdArguments
+	outputFolder string
+	since        string
+	selection    selectArguments
 }{}
 
 func init() {
 	cmd := listCmd
 	rootCmd.AddCommand(cmd)
 
-	listCmd.Flags().BoolVarP(&testArguments.cgoEnabled,
+	listCmd.Flags().BoolVarP(&listArguments.build.cgoEnabled,
 		"cgo", "", false, "If disabled will pass CGO_ENABLED=0 env variable to go compiler")
 
-	listCmd.Flags().BoolVarP(&testArguments.spire,
+	listCmd.Flags().BoolVarP(&listArguments.spire,
 		"spire", "s", true, "If enabled will run spire")
+
+	addPlatformFlags(listCmd, &listArguments.build)
+
+	listCmd.Flags().StringVarP(&listArguments.outputFolder,
+		"output", "o", "./dist", "Output folder, if it contains a build manifest it will be used to list tests")
+
+	addSinceFlag(listCmd, &listArguments.since)
+	addSelectFlags(listCmd, &listArguments.selection)
 }
 
 var listCmd = &cobra.Command{
@@ -59,60 +70,120 @@ var listCmd = &cobra.Command{
 			return err
 		}
 
-		_, cgoEnv := tools.RetrieveGoEnv(cmdArguments.cgoEnabled, cmdArguments.goos, cmdArguments.goarch)
+		if isDocker {
+			listArguments.selection.loadEnv()
+		}
+		selected, err := newSelection(&listArguments.selection)
+		if err != nil {
+			return err
+		}
+
+		if isDocker {
+			// Inside docker all tests are already compiled into /bin
+			packages, err := findTestBinaries(cmd.Context(), curDir, "/bin")
+			if err != nil {
+				return err
+			}
+			selected.filterTests(packages)
+			printTestBinaries(packages, "/bin")
+			return nil
+		}
+		if len(args) == 0 && listArguments.since == "" {
+			if packages, err := findManifestTests(listArguments.outputFolder); err == nil {
+				logrus.Infof("Using build manifest %v", path.Join(listArguments.outputFolder, tools.ManifestFileName))
+				selected.filterTests(packages)
+				printTestBinaries(packages, listArguments.outputFolder)
+				return nil
+			}
+		}
+
+		_, cgoEnv := tools.RetrieveGoEnv(listArguments.build.cgoEnabled, listArguments.build.goos, listArguments.build.goarch)
+
+		modules, err := findBuildModules(cmd.Context(), curDir, listArguments.outputFolder, nil, cgoEnv)
+		if err != nil {
+			return err
+		}
+
+		filter, err := newChangeFilter(cmd.Context(), curDir, modules, listArguments.since, cgoEnv)
+		if err != nil {
+			return err
+		}
 
-		if len(args) == 0 && !isDocker {
-			//We look for packages only in docker env, else we run only /bin/*.test applications.
-			args = tools.FindMainPackages(cmd.Context(), curDir, cgoEnv)
+		//We look for packages only in docker env, else we run only /bin/*.test applications.
+		apps, err := findModuleApps(cmd.Context(), modules, args, cgoEnv)
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			apps = selected.filterApps(curDir, apps)
 		}
 
 		// Final All test packages
 		packages := map[string]map[string]*tools.PackageInfo{}
-		for _, rootDir := range args {
-			sourceRoot := rootDir
-			rootDir, err = filepath.Abs(rootDir)
-			if err != nil {
-				logrus.Errorf("Failed to make absolute path for %v", sourceRoot)
-			}
+		for _, app := range apps {
 			// We in state to run tests,
-			var pkgs map[string]*tools.PackageInfo
-			pkgs, err = tools.FindTests(cmd.Context(), rootDir, cgoEnv)
+			pkgs, err := tools.FindTests(cmd.Context(), app.dir, app.module.goEnv(cgoEnv))
 			if err != nil {
 				logrus.Errorf("failed to find tests %v", err)
 			}
-			// Add spire entries for every appliction and test application we found.
-			_, cmdName := path.Split(path.Clean(rootDir))
-			packages[cmdName] = pkgs
-		}
-		for _, testApp := range packages {
-			for _, testPkg := range testApp {
-				if len(testPkg.Tests) > 0 {
-					// Print test info
-					testExecName := path.Join("/bin", testPkg.OutName)
-					logrus.Infof("Test binary: %v tests: %v", testExecName, testPkg.Tests)
+			for k, p := range pkgs {
+				p.OutName = app.module.OutName(p.OutName)
+				if !filter.test(p.Package) || !selected.test(p.Package, p.OutName) {
+					delete(pkgs, k)
 				}
 			}
+			packages[app.name()] = pkgs
 		}
+		printTestBinaries(packages, "/bin")
 		return nil
 	},
 }
 
-func buildTarget(ctx context.Context, curDir, target string, env []string) (containerId string, err error) {
-	logrus.Infof("Build target %v with docker...", target)
+func printTestBinaries(packages map[string]map[string]*tools.PackageInfo, binFolder string) {
+	for _, testApp := range packages {
+		for _, testPkg := range testApp {
+			if len(testPkg.Tests) > 0 {
+				// Print test info
+				testExecName := path.Join(binFolder, testPkg.OutName)
+				logrus.Infof("Test binary: %v package: %v tests: %v", testExecName, testPkg.Package, testPkg.Tests)
+			}
+		}
+	}
+}
 
-	var output []string
-	output, err = tools.ExecRead(ctx, curDir, []string{"docker", "build", "--build-arg", fmt.Sprintf("%s=true", SkipBuildEnv), ".", "--target", target}, env, true)
+// buildTarget - build container image target and return its id, if target is empty a final stage is built.
+func buildTarget(ctx context.Context, containerRuntime tools.ContainerRuntime, curDir, target string) (string, error) {
+	logrus.Infof("Build target %v with %v...", target, containerRuntime.Name())
 
+	imageID, steps, err := containerRuntime.BuildImage(ctx, curDir, &tools.ImageBuildOptions{
+		Target:    target,
+		BuildArgs: map[string]string{SkipBuildEnv: "true"},
+	})
+	if len(steps) > 0 {
+		printImageBuildSummary(steps)
+	}
 	if err != nil {
-		return "", err
+		return "", errors.Wrapf(err, "failed to build target %v", target)
 	}
-	lastLine := output[len(output)-1]
-	prefix := "Successfully built "
-	if strings.HasPrefix(lastLine, prefix) {
-		containerId = strings.TrimSpace(lastLine[len(prefix):len(lastLine)])
-	} else {
-		err = errors.Errorf("Failed to parse container id %v", lastLine)
-		return
+	logrus.Infof("Target %v image is %v", target, imageID)
+	return imageID, nil
+}
+
+func printImageBuildSummary(steps []*tools.BuildStep) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "\nIMAGE STEP\tSTATUS\tTIME")
+	cached := 0
+	for _, s := range steps {
+		status := "done"
+		switch {
+		case s.Error != "":
+			status = statusFailed
+		case s.Cached:
+			status = statusCached
+			cached++
+		}
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%v\n", s.Name, status, s.Duration.Round(time.Millisecond))
 	}
-	return
+	_ = w.Flush()
+	logrus.Infof("Image build complete: %v steps, %v %v", len(steps), cached, statusCached)
 }
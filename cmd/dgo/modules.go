@@ -0,0 +1,157 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"context"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// buildModule - a module with an environment go commands are executed with inside of it.
+type buildModule struct {
+	*tools.Module
+	// env - a module specific environment, like an alternate modfile with replace overrides.
+	env []string
+}
+
+// goEnv - return env extended with module specific environment.
+func (m *buildModule) goEnv(env []string) []string {
+	return append(append([]string{}, env...), m.env...)
+}
+
+// moduleApp - an application main package and a module it belongs to.
+type moduleApp struct {
+	module *buildModule
+	dir    string
+}
+
+// name - return an application name used for output binary, prefixed with module name.
+func (a *moduleApp) name() string {
+	return a.module.OutName(path.Base(path.Clean(filepath.ToSlash(a.dir))))
+}
+
+// findBuildModules - find all modules of workspace or under curDir and generate alternate modfiles with replace
+// overrides for them into output folder.
+func findBuildModules(ctx context.Context, curDir, outputFolder string, replaceValues, env []string) ([]*buildModule, error) {
+	modules, err := tools.FindModules(ctx, curDir, env)
+	if err != nil {
+		return nil, err
+	}
+	if len(modules) == 0 {
+		return nil, errors.Errorf("no go modules are found in %v", curDir)
+	}
+	result := []*buildModule{}
+	for _, m := range modules {
+		if m.Name != "" {
+			logrus.Infof("Found module %v at %v", m.Path, m.Dir)
+		}
+		result = append(result, &buildModule{Module: m})
+	}
+	if len(replaceValues) == 0 {
+		return result, nil
+	}
+
+	replaces, err := tools.ParseReplaces(replaceValues)
+	if err != nil {
+		return nil, err
+	}
+	printReplaces(replaceValues)
+	if modules[0].Workspace {
+		// All workspace modules share one go.work, so overrides are added into alternate go.work.
+		workEnv, err := tools.WriteWorkFile(ctx, curDir, tools.StateDir(outputFolder), replaces, env)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range result {
+			m.env = workEnv
+		}
+		return result, nil
+	}
+	for _, m := range result {
+		fileName := tools.ModFileName
+		if m.Name != "" {
+			fileName = "dgo-" + m.Name + ".mod"
+		}
+		if m.env, err = tools.WriteModFile(ctx, m.Dir, tools.StateDir(outputFolder), fileName, replaces, env); err != nil {
+			return nil, errors.Wrapf(err, "failed to apply replace overrides to %v", m.Path)
+		}
+	}
+	return result, nil
+}
+
+// findModuleApps - find applications passed as arguments or all main packages of all modules.
+func findModuleApps(ctx context.Context, modules []*buildModule, args, env []string) ([]*moduleApp, error) {
+	result := []*moduleApp{}
+	if len(args) > 0 {
+		for _, a := range args {
+			dir, err := filepath.Abs(a)
+			if err != nil {
+				return nil, err
+			}
+			m := moduleOf(modules, dir)
+			if m == nil {
+				return nil, errors.Errorf("application %v is outside of all modules", a)
+			}
+			result = append(result, &moduleApp{module: m, dir: dir})
+		}
+		return result, nil
+	}
+	for _, m := range modules {
+		for _, dir := range tools.FindMainPackages(ctx, m.Dir, m.goEnv(env)) {
+			result = append(result, &moduleApp{module: m, dir: dir})
+		}
+	}
+	return result, nil
+}
+
+// loadModulesGraph - load an import graph of packages of all modules.
+func loadModulesGraph(ctx context.Context, modules []*buildModule, env []string) (*tools.PackageGraph, error) {
+	var result *tools.PackageGraph
+	for _, m := range modules {
+		graph, err := tools.LoadPackageGraph(ctx, m.Dir, m.goEnv(env))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load packages of %v", m.Dir)
+		}
+		if result == nil {
+			result = graph
+		} else {
+			result.Merge(graph)
+		}
+	}
+	return result, nil
+}
+
+// moduleOf - return the most specific module containing dir, nil if dir is outside of all modules.
+func moduleOf(modules []*buildModule, dir string) *buildModule {
+	var result *buildModule
+	for _, m := range modules {
+		rel, err := filepath.Rel(m.Dir, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		// Nested module is more specific.
+		if result == nil || len(m.Dir) > len(result.Dir) {
+			result = m
+		}
+	}
+	return result
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"context"
+	"fmt"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	statusReproducible = "reproducible"
+	statusDiffers      = "differs"
+)
+
+// buildArtifact - a binary and a command it was compiled with, used to rebuild it.
+type buildArtifact struct {
+	moduleDir  string
+	compileCmd []string
+	pkgPath    string
+	outPath    string
+	env        []string
+}
+
+// reproducibleCheck - collect all compiled binaries to verify they are reproducible, nil check collects nothing.
+type reproducibleCheck struct {
+	lock      sync.Mutex
+	artifacts []*buildArtifact
+}
+
+func (c *reproducibleCheck) add(artifact *buildArtifact) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.artifacts = append(c.artifacts, artifact)
+}
+
+// verify - rebuild every binary into a temporary folder with an empty go build cache and compare it with original one.
+// An error listing all binaries with different content is returned.
+func (c *reproducibleCheck) verify(ctx context.Context, jobs int) error {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	tmpDir, err := ioutil.TempDir("", "dgo-reproducible-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	// Separate go cache, so no compiled package of first build is reused.
+	cacheEnv := "GOCACHE=" + filepath.Join(tmpDir, "cache")
+	logrus.Infof("Verifying %v binaries are reproducible, rebuilding into %v", len(c.artifacts), tmpDir)
+
+	pool := tools.NewWorkerPool(ctx, jobs, false)
+	for i, a := range c.artifacts {
+		artifact := a
+		rebuildPath := filepath.Join(tmpDir, fmt.Sprintf("%d-%s", i, filepath.Base(artifact.outPath)))
+		pool.Go(artifact.outPath, func(ctx context.Context) (string, []string, error) {
+			buildCmd := append(append([]string{}, artifact.compileCmd...), "-o", rebuildPath, artifact.pkgPath)
+			output, err := tools.ExecRead(ctx, artifact.moduleDir, buildCmd, append(append([]string{}, artifact.env...), cacheEnv), true)
+			if err != nil {
+				return "", output, errors.Wrapf(err, "failed to rebuild %v", buildCmd)
+			}
+			return compareArtifacts(artifact.outPath, rebuildPath)
+		})
+	}
+	results := pool.Wait()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "\nBINARY\tSTATUS\tTIME")
+	differs := []string{}
+	for _, r := range results {
+		status := r.Status
+		if r.Err != nil {
+			status = statusFailed
+			differs = append(differs, r.Name)
+		}
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%v\n", r.Name, status, r.Duration.Round(time.Millisecond))
+	}
+	_ = w.Flush()
+	for _, r := range results {
+		if r.Err != nil {
+			_, _ = fmt.Fprintf(os.Stdout, "\n==== %v: %v\n", r.Name, r.Err)
+			for _, line := range r.Output {
+				_, _ = fmt.Fprintln(os.Stdout, line)
+			}
+		}
+	}
+	sort.Strings(differs)
+	if len(differs) > 0 {
+		return errors.Errorf("%v of %v binaries are not reproducible: %v", len(differs), len(results), strings.Join(differs, ", "))
+	}
+	logrus.Infof("All %v binaries are reproducible", len(results))
+	return nil
+}
+
+// compareArtifacts - compare hashes of binaries, if they differ return a table of different ELF sections as output.
+func compareArtifacts(outPath, rebuildPath string) (string, []string, error) {
+	sha, err := tools.FileHash(outPath)
+	if err != nil {
+		return "", nil, err
+	}
+	rebuildSha, err := tools.FileHash(rebuildPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if sha == rebuildSha {
+		return statusReproducible, nil, nil
+	}
+	err = errors.Errorf("sha256 %v differs from rebuilt %v", sha, rebuildSha)
+	diffs, diffErr := tools.CompareSections(outPath, rebuildPath)
+	if diffErr != nil {
+		return statusDiffers, []string{diffErr.Error()}, err
+	}
+	output := strings.Builder{}
+	w := tabwriter.NewWriter(&output, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "SECTION\tSIZE\tREBUILT SIZE\tFIRST DIFFERENT BYTE")
+	size := func(value int64) string {
+		if value < 0 {
+			return "-"
+		}
+		return fmt.Sprint(value)
+	}
+	for _, d := range diffs {
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", d.Name, size(d.Size), size(d.OtherSize), size(d.Offset))
+	}
+	_ = w.Flush()
+	return statusDiffers, strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n"), err
+}
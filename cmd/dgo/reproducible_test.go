@@ -0,0 +1,102 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildFixture - compile a small application, every version has own code, so binaries have different .text section.
+func buildFixture(t *testing.T, dir, version string) string {
+	t.Helper()
+	srcDir := filepath.Join(dir, "src")
+	if err := os.MkdirAll(srcDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.20\n",
+		"main.go": "package main\n\nfunc main() {\n" + strings.Repeat("\tprintln(\""+version+"\")\n", len(version)) + "}\n",
+	} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outPath := filepath.Join(dir, "app-"+version)
+	cmd := exec.Command("go", "build", "-trimpath", "-o", outPath, ".")
+	cmd.Dir = srcDir
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0", "GOOS=linux", "GOFLAGS=")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build fixture: %v %s", err, output)
+	}
+	return outPath
+}
+
+// copyFixture - a compile command which copies fixture into -o path instead of compiling a package.
+func copyFixture(fixture string) []string {
+	return []string{"sh", "-c", `cp "$0" "$2"`, fixture}
+}
+
+func TestCompareArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	v1 := buildFixture(t, dir, "v1")
+	v2 := buildFixture(t, dir, "v1.1")
+
+	status, output, err := compareArtifacts(v1, v1)
+	if err != nil || status != statusReproducible || len(output) != 0 {
+		t.Errorf("compareArtifacts() of same binary = %v %v %v", status, output, err)
+	}
+
+	status, output, err = compareArtifacts(v1, v2)
+	if err == nil || status != statusDiffers {
+		t.Fatalf("compareArtifacts() of different binaries = %v %v", status, err)
+	}
+	if len(output) < 2 || !strings.HasPrefix(output[0], "SECTION") {
+		t.Fatalf("expected a table of different sections, got %q", output)
+	}
+	if !strings.Contains(strings.Join(output, "\n"), ".text") {
+		t.Errorf("expected .text to differ, got %q", output)
+	}
+}
+
+func TestReproducibleCheckVerify(t *testing.T) {
+	dir := t.TempDir()
+	v1 := buildFixture(t, dir, "v1")
+	v2 := buildFixture(t, dir, "v2")
+
+	check := &reproducibleCheck{}
+	check.add(&buildArtifact{moduleDir: dir, compileCmd: copyFixture(v1), pkgPath: ".", outPath: v1})
+	if err := check.verify(context.Background(), 2); err != nil {
+		t.Errorf("expected binaries to be reproducible, got %v", err)
+	}
+
+	check.add(&buildArtifact{moduleDir: dir, compileCmd: copyFixture(v2), pkgPath: ".", outPath: v1})
+	err := check.verify(context.Background(), 2)
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 binaries are not reproducible") {
+		t.Errorf("expected one binary to differ, got %v", err)
+	}
+
+	var noCheck *reproducibleCheck
+	noCheck.add(&buildArtifact{outPath: v1})
+	if err = noCheck.verify(context.Background(), 1); err != nil {
+		t.Errorf("nil check should verify nothing, got %v", err)
+	}
+}
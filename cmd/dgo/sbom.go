@@ -0,0 +1,78 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// sbomDir - a folder inside state folder of output folder SBOM documents are stored into.
+const sbomDir = "sbom"
+
+// writeSBOMs - store CycloneDX and SPDX documents of every binary from build manifest, and aggregated documents
+// of all applications of image for every folder with applications, like every platform folder. Documents are stored
+// into dist/.dgo/sbom with same layout as binaries, so they are not copied into image together with binaries.
+func writeSBOMs(outputFolder, imageName string, created time.Time) error {
+	manifest, err := tools.ReadManifest(outputFolder)
+	if err != nil {
+		return err
+	}
+	images := map[string][]*tools.SBOMBinary{}
+	for _, group := range []struct {
+		entries []*tools.ManifestEntry
+		test    bool
+	}{{manifest.Applications, false}, {manifest.Tests, true}} {
+		for _, e := range group.entries {
+			binaryPath := path.Join(outputFolder, e.Path)
+			binary, err := tools.ReadSBOMBinary(binaryPath)
+			if err != nil {
+				return err
+			}
+			folder := path.Join(tools.StateDir(outputFolder), sbomDir, path.Dir(e.Path))
+			if err = os.MkdirAll(folder, os.ModePerm); err != nil {
+				return err
+			}
+			if err = tools.WriteSBOM(folder, binary.Name, binary.Name, []*tools.SBOMBinary{binary}, false, created); err != nil {
+				return errors.Wrapf(err, "failed to write SBOM of %v", e.Path)
+			}
+			if !group.test {
+				// Only applications are shipped with image.
+				images[folder] = append(images[folder], binary)
+			}
+		}
+	}
+	folders := []string{}
+	for folder := range images {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+	for _, folder := range folders {
+		binaries := images[folder]
+		sort.Slice(binaries, func(i, j int) bool { return binaries[i].Name < binaries[j].Name })
+		if err = tools.WriteSBOM(folder, tools.ImageSBOMName, imageName, binaries, true, created); err != nil {
+			return errors.Wrapf(err, "failed to write image SBOM into %v", folder)
+		}
+		logrus.Infof("SBOM of %v applications is stored into %v", len(binaries), path.Join(folder, tools.ImageSBOMName+"{"+tools.CycloneDXSuffix+","+tools.SPDXSuffix+"}"))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestWriteSBOMs(t *testing.T) {
+	dir := t.TempDir()
+	// Test binary has build info embedded by go test.
+	content, err := ioutil.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(path.Join(dir, "linux_amd64"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path.Join(dir, "linux_amd64", "app"), content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	manifest := &tools.Manifest{Applications: []*tools.ManifestEntry{{Name: "app", Path: "linux_amd64/app"}}}
+	if err = manifest.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err = writeSBOMs(dir, "image", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"app.cdx.json", "app.spdx.json", "dgo-sbom.cdx.json", "dgo-sbom.spdx.json"} {
+		if _, err = os.Stat(path.Join(dir, ".dgo", "sbom", "linux_amd64", name)); err != nil {
+			t.Errorf("SBOM %v is not written: %v", name, err)
+		}
+	}
+	files, err := ioutil.ReadDir(path.Join(dir, "linux_amd64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("only binary is expected in binaries folder, got %v files", len(files))
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"fmt"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// selectArguments - include and exclude patterns of applications and test packages.
+type selectArguments struct {
+	includeApps  []string
+	excludeApps  []string
+	includeTests []string
+	excludeTests []string
+}
+
+func addSelectFlags(cmd *cobra.Command, arguments *selectArguments) {
+	cmd.Flags().StringArrayVarP(&arguments.includeApps,
+		"include-app", "", nil, "Select only discovered applications with name or folder matching glob or re:regexp pattern")
+
+	cmd.Flags().StringArrayVarP(&arguments.excludeApps,
+		"exclude-app", "", nil, "Skip discovered applications with name or folder matching glob or re:regexp pattern")
+
+	cmd.Flags().StringArrayVarP(&arguments.includeTests,
+		"include-test", "", nil, "Select only test packages with import path or binary name matching glob or re:regexp pattern")
+
+	cmd.Flags().StringArrayVarP(&arguments.excludeTests,
+		"exclude-test", "", nil, "Skip test packages with import path or binary name matching glob or re:regexp pattern")
+}
+
+// env - return environment to pass patterns into test container, patterns are separated with new lines.
+func (a *selectArguments) env() []string {
+	result := []string{}
+	for _, e := range []struct {
+		name   string
+		values []string
+	}{
+		{IncludeAppsEnv, a.includeApps},
+		{ExcludeAppsEnv, a.excludeApps},
+		{IncludeTestsEnv, a.includeTests},
+		{ExcludeTestsEnv, a.excludeTests},
+	} {
+		if len(e.values) > 0 {
+			result = append(result, fmt.Sprintf("%s=%s", e.name, strings.Join(e.values, "\n")))
+		}
+	}
+	return result
+}
+
+// loadEnv - override patterns with values passed with environment.
+func (a *selectArguments) loadEnv() {
+	for name, values := range map[string]*[]string{
+		IncludeAppsEnv:  &a.includeApps,
+		ExcludeAppsEnv:  &a.excludeApps,
+		IncludeTestsEnv: &a.includeTests,
+		ExcludeTestsEnv: &a.excludeTests,
+	} {
+		if value := os.Getenv(name); value != "" {
+			*values = strings.Split(value, "\n")
+		}
+	}
+}
+
+// selection - filters of applications and test packages, nil selection selects everything.
+type selection struct {
+	apps  *tools.NameFilter
+	tests *tools.NameFilter
+}
+
+func newSelection(arguments *selectArguments) (*selection, error) {
+	apps, err := tools.NewNameFilter(arguments.includeApps, arguments.excludeApps)
+	if err != nil {
+		return nil, err
+	}
+	tests, err := tools.NewNameFilter(arguments.includeTests, arguments.excludeTests)
+	if err != nil {
+		return nil, err
+	}
+	if apps.IsEmpty() && tests.IsEmpty() {
+		return nil, nil
+	}
+	return &selection{apps: apps, tests: tests}, nil
+}
+
+// relativeFolder - return a slash separated folder of dir relative to curDir, or empty if dir is not passed.
+func relativeFolder(curDir, dir string) string {
+	if dir == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(curDir, dir)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// app - tells if application is selected by its name or folder relative to curDir.
+func (s *selection) app(curDir, name, dir string) bool {
+	return s.appFolder(name, relativeFolder(curDir, dir))
+}
+
+// appFolder - tells if application is selected by its name or its slash separated relative folder.
+func (s *selection) appFolder(name, folder string) bool {
+	if s == nil || s.apps.Match(name, folder) {
+		return true
+	}
+	logrus.Infof("Skipping application %v, it is not selected by include/exclude patterns", name)
+	return false
+}
+
+// filterApps - remove discovered applications not selected by patterns.
+func (s *selection) filterApps(curDir string, apps []*moduleApp) []*moduleApp {
+	result := []*moduleApp{}
+	for _, a := range apps {
+		if s.app(curDir, a.name(), a.dir) {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// test - tells if test package is selected by its import path or binary name.
+func (s *selection) test(importPath, outName string) bool {
+	return s == nil || s.tests.Match(importPath, outName)
+}
+
+// filterTests - remove applications and test packages not selected by patterns from packages grouped by application.
+// Applications are matched by folder recorded in build manifest, if folder is not known, like for binaries found
+// without manifest, application patterns are not applied, since applications are already selected by build.
+func (s *selection) filterTests(packages map[string]map[string]*tools.PackageInfo) {
+	if s == nil {
+		return
+	}
+	for cmdName, pkgs := range packages {
+		folder := ""
+		for _, p := range pkgs {
+			folder = p.AppFolder
+		}
+		if folder != "" && !s.appFolder(cmdName, folder) {
+			delete(packages, cmdName)
+			continue
+		}
+		for k, p := range pkgs {
+			if !s.test(p.Package, p.OutName) {
+				logrus.Infof("Skipping tests of %v, they are not selected by include/exclude patterns", p.OutName)
+				delete(pkgs, k)
+			}
+		}
+	}
+}
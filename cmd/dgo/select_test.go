@@ -0,0 +1,109 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSelectionFilterTests(t *testing.T) {
+	packages := func() map[string]map[string]*tools.PackageInfo {
+		return map[string]map[string]*tools.PackageInfo{
+			"app": {
+				"example.com/app/cmd/app": {OutName: "app.test", Package: "example.com/app/cmd/app", AppFolder: "cmd/app"},
+				"example.com/app/pkg":     {OutName: "app-pkg.test", Package: "example.com/app/pkg", AppFolder: "cmd/app"},
+			},
+			"tool": {
+				"example.com/app/tools/tool": {OutName: "tool.test", Package: "example.com/app/tools/tool", AppFolder: "tools/tool"},
+			},
+			"legacy": {
+				"legacy": {OutName: "legacy.test"},
+			},
+		}
+	}
+	tests := []struct {
+		name      string
+		arguments selectArguments
+		want      []string
+	}{
+		{
+			name: "no patterns",
+			want: []string{"app-pkg.test", "app.test", "legacy.test", "tool.test"},
+		},
+		{
+			name:      "include app folder",
+			arguments: selectArguments{includeApps: []string{"cmd/*"}},
+			want:      []string{"app-pkg.test", "app.test", "legacy.test"},
+		},
+		{
+			name:      "exclude app name",
+			arguments: selectArguments{excludeApps: []string{"tool"}},
+			want:      []string{"app-pkg.test", "app.test", "legacy.test"},
+		},
+		{
+			name:      "exclude test package",
+			arguments: selectArguments{excludeTests: []string{"**/pkg"}},
+			want:      []string{"app.test", "legacy.test", "tool.test"},
+		},
+		{
+			name:      "include test binary",
+			arguments: selectArguments{includeTests: []string{"*-pkg.test"}},
+			want:      []string{"app-pkg.test"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newSelection(&tt.arguments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := packages()
+			s.filterTests(result)
+			got := []string{}
+			for _, pkgs := range result {
+				for _, p := range pkgs {
+					got = append(got, p.OutName)
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterTests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelativeFolder(t *testing.T) {
+	tests := []struct {
+		curDir string
+		dir    string
+		want   string
+	}{
+		{curDir: "/src/app", dir: "/src/app/cmd/app", want: "cmd/app"},
+		{curDir: "/src/app", dir: "/src/app", want: "."},
+		{curDir: "/src/app", dir: "", want: ""},
+		{curDir: "/src/app", dir: "/src/lib/cmd", want: "../lib/cmd"},
+	}
+	for _, tt := range tests {
+		if got := relativeFolder(tt.curDir, tt.dir); got != tt.want {
+			t.Errorf("relativeFolder(%q, %q) = %q, want %q", tt.curDir, tt.dir, got, tt.want)
+		}
+	}
+}
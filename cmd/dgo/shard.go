@@ -0,0 +1,352 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	shardByBinary = "binary"
+	shardByTest   = "test"
+
+	// shardItemSeparator - a separator of test binary and test name of shard item.
+	shardItemSeparator = ":"
+)
+
+// shardItem - a test binary or one top level test of it executed by shard.
+type shardItem struct {
+	binary string
+	test   string
+	// duration - an expected duration in seconds.
+	duration float64
+}
+
+func (i *shardItem) String() string {
+	if i.test == "" {
+		return i.binary
+	}
+	return i.binary + shardItemSeparator + i.test
+}
+
+// parseShard - parse a shard passed as i/N, where i is from 1 to N.
+func parseShard(value string) (index, count int, err error) {
+	parts := strings.Split(value, "/")
+	if len(parts) == 2 {
+		index, err = strconv.Atoi(parts[0])
+		if err == nil {
+			count, err = strconv.Atoi(parts[1])
+		}
+		if err == nil && index >= 1 && index <= count {
+			return index, count, nil
+		}
+	}
+	return 0, 0, errors.Errorf("invalid shard %q, expected i/N where i is from 1 to N", value)
+}
+
+func validateShardBy(value string) error {
+	if value != shardByBinary && value != shardByTest {
+		return errors.Errorf("invalid --shard-by %q, expected one of: binary, test", value)
+	}
+	return nil
+}
+
+// readTestHistory - read test report of previous run stored inside reportDir, nil is returned if there is no report.
+func readTestHistory(reportDir string) *tools.TestReport {
+	if reportDir == "" {
+		return nil
+	}
+	history, err := tools.ReadTestReport(path.Join(reportDir, tools.TestReportName))
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			logrus.Warnf("Failed to read test durations of previous run %v", err)
+		}
+		return nil
+	}
+	return history
+}
+
+// shardHistory - return durations of previous run used to balance shards. Every machine running own --shard i/N has to
+// compute the same plan, so local history is not used with --shard, only a shared report passed with --shard-history.
+func shardHistory(reportDir string) (*tools.TestReport, error) {
+	if testArguments.shard == "" {
+		return readTestHistory(reportDir), nil
+	}
+	if testArguments.shardHistory == "" {
+		return nil, nil
+	}
+	history, err := tools.ReadTestReport(testArguments.shardHistory)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read shard history %v", testArguments.shardHistory)
+	}
+	return history, nil
+}
+
+// planShards - split test binaries, or top level tests of them if byTest is passed, into count shards balanced by
+// durations of previous run. Items are assigned from longest to shortest one to shard with smallest total duration,
+// items without known duration are expected to take an average time, so same inputs always produce same plan.
+func planShards(binaries []*tools.PackageInfo, count int, byTest bool, history *tools.TestReport) [][]*shardItem {
+	durations := map[string]float64{}
+	if history != nil {
+		for _, p := range history.Packages {
+			durations[p.Binary] = p.Elapsed
+			for _, t := range p.Tests {
+				durations[p.Binary+shardItemSeparator+t.Name] = t.Elapsed
+			}
+		}
+	}
+	items := []*shardItem{}
+	for _, b := range binaries {
+		binary := testBinaryName(b.OutName)
+		if !byTest || len(b.Tests) == 0 {
+			item := &shardItem{binary: b.OutName, duration: -1}
+			if d, ok := durations[binary]; ok {
+				item.duration = d
+			}
+			items = append(items, item)
+			continue
+		}
+		for _, t := range b.Tests {
+			item := &shardItem{binary: b.OutName, test: t, duration: -1}
+			if d, ok := durations[binary+shardItemSeparator+t]; ok {
+				item.duration = d
+			}
+			items = append(items, item)
+		}
+	}
+	total, known := 0.0, 0
+	for _, item := range items {
+		if item.duration >= 0 {
+			total += item.duration
+			known++
+		}
+	}
+	average := 1.0
+	if known > 0 {
+		average = total / float64(known)
+	}
+	for _, item := range items {
+		if item.duration < 0 {
+			item.duration = average
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].duration != items[j].duration {
+			return items[i].duration > items[j].duration
+		}
+		return items[i].String() < items[j].String()
+	})
+
+	shards := make([][]*shardItem, count)
+	loads := make([]float64, count)
+	for _, item := range items {
+		target := 0
+		for i := range loads {
+			if loads[i] < loads[target] {
+				target = i
+			}
+		}
+		shards[target] = append(shards[target], item)
+		loads[target] += item.duration
+	}
+	return shards
+}
+
+// planHostShards - split test binaries from build manifest of output folder matching filter into shards, only shard passed with --shard
+// is returned if it is set, else all --shards are returned. Shards are returned by index starting with 1.
+func planHostShards(outputFolder, reportDir string, filter *testFilter) (map[int][]*shardItem, int, error) {
+	index, count := 0, testArguments.shards
+	if testArguments.shard != "" {
+		var err error
+		if index, count, err = parseShard(testArguments.shard); err != nil {
+			return nil, 0, err
+		}
+	}
+	if err := validateShardBy(testArguments.shardBy); err != nil {
+		return nil, 0, err
+	}
+	if testArguments.debugTests && index == 0 && count > 1 {
+		return nil, 0, errors.New("debug of tests is not supported with several shards")
+	}
+	packages, err := findManifestTests(outputFolder)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to read test binaries from build manifest")
+	}
+	binaries := filter.selectBinaries(selectTestBinaries(packages, testArguments.testPackage))
+	history, err := shardHistory(reportDir)
+	if err != nil {
+		return nil, 0, err
+	}
+	plan := planShards(binaries, count, testArguments.shardBy == shardByTest, history)
+	shards := map[int][]*shardItem{}
+	for i, items := range plan {
+		if index == 0 || index == i+1 {
+			shards[i+1] = items
+		}
+	}
+	return shards, count, nil
+}
+
+// shardEnv - return environment to pass a shard and its items into test container, items are separated with new lines.
+func shardEnv(index, count int, items []*shardItem) []string {
+	lines := []string{}
+	for _, item := range items {
+		lines = append(lines, item.String())
+	}
+	return []string{
+		fmt.Sprintf("%s=%d/%d", TestShardEnv, index, count),
+		fmt.Sprintf("%s=%s", TestShardItemsEnv, strings.Join(lines, "\n")),
+	}
+}
+
+// applyShard - return binaries included into shard items and tests to select for binaries split between shards.
+func applyShard(binaries []*tools.PackageInfo, items []*shardItem) (selected []*tools.PackageInfo, tests map[string][]string) {
+	tests = map[string][]string{}
+	whole := map[string]bool{}
+	for _, item := range items {
+		if item.test == "" {
+			whole[item.binary] = true
+		} else {
+			tests[item.binary] = append(tests[item.binary], item.test)
+		}
+	}
+	for _, b := range binaries {
+		if whole[b.OutName] {
+			delete(tests, b.OutName)
+			selected = append(selected, b)
+		} else if _, ok := tests[b.OutName]; ok {
+			selected = append(selected, b)
+		}
+	}
+	return selected, tests
+}
+
+// parseShardItems - parse shard items passed with environment.
+func parseShardItems(value string) []*shardItem {
+	items := []*shardItem{}
+	for _, line := range strings.Split(value, "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, shardItemSeparator, 2)
+		item := &shardItem{binary: parts[0]}
+		if len(parts) == 2 {
+			item.test = parts[1]
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// runShards - start a test container for every shard concurrently, every line of container output is prefixed with
+// its shard. An error is returned if any container is failed.
+func runShards(ctx context.Context, containerRuntime tools.ContainerRuntime, config *tools.ContainerConfig,
+	count int, shards map[int][]*shardItem) error {
+	indexes := []int{}
+	for index := range shards {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	lock := &sync.Mutex{}
+	pool := tools.NewWorkerPool(ctx, len(indexes), false)
+	for _, i := range indexes {
+		index := i
+		if len(shards[index]) == 0 {
+			logrus.Infof("Shard %v/%v has no tests, container is not started", index, count)
+			continue
+		}
+		shardConfig := *config
+		shardConfig.Env = append(append([]string{}, config.Env...), shardEnv(index, count, shards[index])...)
+		if shardConfig.Name == "" {
+			// Containers are started at once, so generated names could collide.
+			shardConfig.Name = fmt.Sprintf("dgo-test-%d-shard-%d", time.Now().UnixNano(), index)
+		}
+		name := fmt.Sprintf("shard %v/%v", index, count)
+		pool.Go(name, func(ctx context.Context) (string, []string, error) {
+			logrus.Infof("Starting %v with %v test items", name, len(shards[index]))
+			stdout := &prefixWriter{prefix: "[" + name + "] ", out: os.Stdout, lock: lock}
+			stderr := &prefixWriter{prefix: "[" + name + "] ", out: os.Stderr, lock: lock}
+			exitCode, err := containerRuntime.RunContainer(ctx, &shardConfig, stdout, stderr)
+			stdout.flush()
+			stderr.flush()
+			if err != nil {
+				return "", nil, err
+			}
+			if exitCode != 0 {
+				return "", nil, errors.Errorf("container exit code %v", exitCode)
+			}
+			return "", nil, nil
+		})
+	}
+	failed := []string{}
+	for _, r := range pool.Wait() {
+		if r.Err != nil {
+			logrus.Errorf("Tests of %v are failed: %v", r.Name, r.Err)
+			failed = append(failed, r.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("tests are failed in %v", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// prefixWriter - write complete lines with prefix, so output of several containers is not mixed inside one line.
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	lock   *sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buffer.Write(p)
+	for {
+		pos := bytes.IndexByte(w.buffer.Bytes(), '\n')
+		if pos == -1 {
+			return len(p), nil
+		}
+		line := w.buffer.Next(pos + 1)
+		w.lock.Lock()
+		_, err := fmt.Fprintf(w.out, "%s%s", w.prefix, line)
+		w.lock.Unlock()
+		if err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// flush - write an incomplete last line.
+func (w *prefixWriter) flush() {
+	if w.buffer.Len() > 0 {
+		_, _ = w.Write([]byte("\n"))
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"fmt"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	tests := []struct {
+		value   string
+		index   int
+		count   int
+		wantErr bool
+	}{
+		{value: "1/1", index: 1, count: 1},
+		{value: "2/4", index: 2, count: 4},
+		{value: "4/4", index: 4, count: 4},
+		{value: "0/4", wantErr: true},
+		{value: "5/4", wantErr: true},
+		{value: "-1/4", wantErr: true},
+		{value: "2", wantErr: true},
+		{value: "a/4", wantErr: true},
+		{value: "1/b", wantErr: true},
+		{value: "1/2/3", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		index, count, err := parseShard(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseShard(%q) expected an error, got %v/%v", tt.value, index, count)
+			}
+			continue
+		}
+		if err != nil || index != tt.index || count != tt.count {
+			t.Errorf("parseShard(%q) = %v, %v, %v, want %v, %v", tt.value, index, count, err, tt.index, tt.count)
+		}
+	}
+}
+
+func TestPlanShards(t *testing.T) {
+	binaries := []*tools.PackageInfo{
+		{OutName: "app/a.test", Tests: []string{"TestA1", "TestA2", "ExampleA", "FuzzA"}},
+		{OutName: "app/b.test", Tests: []string{"TestB"}},
+		{OutName: "app/c.test", Tests: []string{}},
+	}
+	history := &tools.TestReport{Packages: []*tools.TestPackage{
+		{Binary: "app_a.test", Elapsed: 10, Tests: []*tools.TestCase{
+			{Name: "TestA1", Elapsed: 6}, {Name: "TestA2", Elapsed: 1}, {Name: "ExampleA", Elapsed: 1},
+		}},
+		{Binary: "app_b.test", Elapsed: 4, Tests: []*tools.TestCase{{Name: "TestB", Elapsed: 4}}},
+	}}
+	tests := []struct {
+		name    string
+		count   int
+		byTest  bool
+		history *tools.TestReport
+		want    [][]string
+	}{
+		{
+			name:  "binaries without history",
+			count: 2,
+			want:  [][]string{{"app/a.test", "app/c.test"}, {"app/b.test"}},
+		},
+		{
+			name:    "binaries by durations",
+			count:   2,
+			history: history,
+			// c.test has no duration and takes an average 7 seconds.
+			want: [][]string{{"app/a.test"}, {"app/c.test", "app/b.test"}},
+		},
+		{
+			name:    "tests by durations",
+			count:   2,
+			byTest:  true,
+			history: history,
+			// FuzzA and c.test have no duration and take an average 3 seconds, c.test has no tests and runs as a whole.
+			want: [][]string{
+				{"app/a.test:TestA1", "app/c.test"},
+				{"app/b.test:TestB", "app/a.test:FuzzA", "app/a.test:ExampleA", "app/a.test:TestA2"},
+			},
+		},
+		{
+			name:   "more shards than items",
+			count:  4,
+			byTest: false,
+			want:   [][]string{{"app/a.test"}, {"app/b.test"}, {"app/c.test"}, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planShards(binaries, tt.count, tt.byTest, tt.history)
+			got := [][]string{}
+			for _, items := range plan {
+				var names []string
+				for _, item := range items {
+					names = append(names, item.String())
+				}
+				got = append(got, names)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planShards() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShardItems(t *testing.T) {
+	items := []*shardItem{
+		{binary: "linux_amd64/app.test"},
+		{binary: "linux_amd64/app-pkg.test", test: "TestA"},
+		{binary: "linux_amd64/app-pkg.test", test: "ExampleB"},
+	}
+	env := shardEnv(2, 3, items)
+	if len(env) != 2 || env[0] != TestShardEnv+"=2/3" {
+		t.Fatalf("unexpected shard environment %v", env)
+	}
+	parsed := parseShardItems(strings.TrimPrefix(env[1], TestShardItemsEnv+"="))
+	if len(parsed) != len(items) {
+		t.Fatalf("parseShardItems() returned %v items, want %v", len(parsed), len(items))
+	}
+	for i, item := range parsed {
+		if item.binary != items[i].binary || item.test != items[i].test {
+			t.Errorf("item %v = %v, want %v", i, item, items[i])
+		}
+	}
+}
+
+func TestApplyShard(t *testing.T) {
+	binaries := []*tools.PackageInfo{{OutName: "a.test"}, {OutName: "b.test"}, {OutName: "c.test"}}
+	tests := []struct {
+		name     string
+		items    string
+		selected []string
+		tests    map[string][]string
+	}{
+		{
+			name:     "whole binaries",
+			items:    "a.test\nc.test\n",
+			selected: []string{"a.test", "c.test"},
+			tests:    map[string][]string{},
+		},
+		{
+			name:     "tests of binary",
+			items:    "b.test:TestB1\nb.test:ExampleB",
+			selected: []string{"b.test"},
+			tests:    map[string][]string{"b.test": {"TestB1", "ExampleB"}},
+		},
+		{
+			name:     "whole binary wins over its tests",
+			items:    "a.test:TestA\na.test",
+			selected: []string{"a.test"},
+			tests:    map[string][]string{},
+		},
+		{
+			name:     "unknown binary",
+			items:    "d.test",
+			selected: nil,
+			tests:    map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, selectedTests := applyShard(binaries, parseShardItems(tt.items))
+			var names []string
+			for _, b := range selected {
+				names = append(names, b.OutName)
+			}
+			if !reflect.DeepEqual(names, tt.selected) {
+				t.Errorf("selected = %v, want %v", names, tt.selected)
+			}
+			if !reflect.DeepEqual(selectedTests, tt.tests) {
+				t.Errorf("tests = %v, want %v", selectedTests, tt.tests)
+			}
+		})
+	}
+}
+
+func TestPlanHostShardsIgnoresLocalHistory(t *testing.T) {
+	outputFolder := t.TempDir()
+	manifest := &tools.Manifest{}
+	names := []string{"a.test", "b.test", "c.test", "d.test", "e.test"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(outputFolder, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+		manifest.Tests = append(manifest.Tests, &tools.ManifestEntry{Name: name, Path: name, Application: "app", Package: "app/" + name, Tests: []string{"TestA"}})
+	}
+	if err := manifest.Write(outputFolder); err != nil {
+		t.Fatal(err)
+	}
+	// Every machine has own history with opposite durations.
+	reportDirs := []string{t.TempDir(), t.TempDir()}
+	for i, dir := range reportDirs {
+		report := &tools.TestReport{}
+		for j, name := range names {
+			elapsed := float64(j + 1)
+			if i == 1 {
+				elapsed = float64(len(names) - j)
+			}
+			report.Packages = append(report.Packages, &tools.TestPackage{Binary: name, Elapsed: elapsed})
+		}
+		if err := report.WriteJSON(filepath.Join(dir, tools.TestReportName)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := testArguments
+	defer func() { testArguments = saved }()
+	testArguments.shardBy = shardByBinary
+	testArguments.testPackage = ""
+	testArguments.debugTests = false
+
+	seen := map[string]int{}
+	for i, dir := range reportDirs {
+		testArguments.shard = fmt.Sprintf("%v/2", i+1)
+		shards, count, err := planHostShards(outputFolder, dir, &testFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 2 || len(shards) != 1 {
+			t.Fatalf("expected only shard %v of 2, got %v of %v", i+1, len(shards), count)
+		}
+		for _, item := range shards[i+1] {
+			seen[item.binary]++
+		}
+	}
+	for _, name := range names {
+		if seen[name] != 1 {
+			t.Errorf("%v is executed %v times, want exactly once: %v", name, seen[name], seen)
+		}
+	}
+
+	// A shared history is used by every machine.
+	testArguments.shard = "1/2"
+	testArguments.shardHistory = filepath.Join(reportDirs[0], tools.TestReportName)
+	shards, _, err := planHostShards(outputFolder, reportDirs[1], &testFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, item := range shards[1] {
+		got = append(got, item.binary)
+	}
+	if want := []string{"e.test", "b.test", "a.test"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("shard 1/2 with shared history = %v, want %v", got, want)
+	}
+
+	testArguments.shardHistory = filepath.Join(outputFolder, "missing.json")
+	if _, _, err = planHostShards(outputFolder, reportDirs[1], &testFilter{}); err == nil {
+		t.Error("expected an error for missing shard history")
+	}
+}
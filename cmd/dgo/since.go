@@ -0,0 +1,92 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"context"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"path/filepath"
+)
+
+func addSinceFlag(cmd *cobra.Command, since *string) {
+	cmd.Flags().StringVarP(since,
+		"since", "", "", "Build and test only applications and packages affected by changes since git ref, like origin/master")
+}
+
+// changeFilter - select applications and test packages affected by changes since git ref, nil filter selects all.
+type changeFilter struct {
+	since    string
+	graph    *tools.PackageGraph
+	affected *tools.AffectedSet
+}
+
+// newChangeFilter - find files changed since git ref and packages affected by them, nil is returned if since is empty.
+func newChangeFilter(ctx context.Context, curDir string, modules []*buildModule, since string, env []string) (*changeFilter, error) {
+	if since == "" {
+		return nil, nil
+	}
+	files, err := tools.GitChangedFiles(ctx, curDir, since)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := loadModulesGraph(ctx, modules, env)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load import graph")
+	}
+	f := &changeFilter{since: since, graph: graph, affected: graph.AffectedBy(files)}
+	logrus.Infof("Changed since %v: %v files, %v affected applications, %v affected test packages", since, len(files),
+		f.count(f.affected.Apps, false), f.count(f.affected.Tests, true))
+	return f, nil
+}
+
+func (f *changeFilter) count(set map[string]bool, tests bool) interface{} {
+	if set == nil {
+		return "all"
+	}
+	result := 0
+	for id := range set {
+		if p, ok := f.graph.Packages[id]; ok && ((tests && p.HasTests) || (!tests && p.Name == "main")) {
+			result++
+		}
+	}
+	return result
+}
+
+// app - tells if application located in dir is affected by changes.
+func (f *changeFilter) app(dir string) bool {
+	if f == nil {
+		return true
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	ids := f.graph.PackagesInDirs([]string{abs})
+	if len(ids) == 0 || f.affected.App(ids[0]) {
+		return true
+	}
+	logrus.Infof("Skipping %v, it is not affected by changes since %v", dir, f.since)
+	return false
+}
+
+// test - tells if tests of package are affected by changes.
+func (f *changeFilter) test(importPath string) bool {
+	return f == nil || f.affected.Test(importPath)
+}
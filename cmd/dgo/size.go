@@ -0,0 +1,159 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"fmt"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// sizeTopEntries - a number of biggest packages and dependencies printed for every application.
+const sizeTopEntries = 10
+
+func addSizeFlags(cmd *cobra.Command, arguments *BuildCmdArguments) {
+	cmd.Flags().BoolVarP(&arguments.sizeReport,
+		"size-report", "", true, "Print size of binaries with biggest packages and dependencies, compared with previous build")
+
+	cmd.Flags().Float64VarP(&arguments.sizeThreshold,
+		"size-threshold", "", 0, "Fail build if any binary grows by more than passed percent since previous build, 0 to disable")
+}
+
+// reportSizes - print sizes of all binaries from build manifest compared with a baseline stored by previous build,
+// and store a new baseline. If threshold is passed and any binary grows by more than threshold percent, an error is
+// returned and baseline is kept.
+func reportSizes(outputFolder string, threshold float64) error {
+	manifest, err := tools.ReadManifest(outputFolder)
+	if err != nil {
+		return err
+	}
+	baseline, err := tools.ReadSizeReport(tools.StateDir(outputFolder))
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			logrus.Warnf("Failed to read size baseline %v", err)
+		}
+		baseline = &tools.SizeReport{}
+	}
+	report := &tools.SizeReport{Binaries: map[string]*tools.BinarySize{}}
+	for _, e := range append(append([]*tools.ManifestEntry{}, manifest.Applications...), manifest.Tests...) {
+		size, err := tools.ReadBinarySize(path.Join(outputFolder, e.Path))
+		if err != nil {
+			return errors.Wrapf(err, "failed to read size of %v", e.Path)
+		}
+		report.Binaries[e.Path] = size
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "\nBINARY\tSIZE\tBASELINE\tCHANGE")
+	names := []string{}
+	for name := range report.Binaries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	grown := []string{}
+	for _, name := range names {
+		size := report.Binaries[name].Size
+		old, ok := baseline.Binaries[name]
+		if !ok || old.Size == 0 {
+			// Growth of binary without known size could not be calculated, so it is reported as a new one.
+			_, _ = fmt.Fprintf(w, "%v\t%v\t-\tnew\n", name, formatSize(size))
+			continue
+		}
+		growth := sizeGrowth(old.Size, size)
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%v\t%+.2f%%\n", name, formatSize(size), formatSize(old.Size), growth)
+		if threshold > 0 && growth > threshold {
+			grown = append(grown, fmt.Sprintf("%v +%.2f%%", name, growth))
+		}
+	}
+	_ = w.Flush()
+
+	for _, e := range manifest.Applications {
+		size := report.Binaries[e.Path]
+		if len(size.Packages) == 0 {
+			continue
+		}
+		old := &tools.BinarySize{}
+		if b, ok := baseline.Binaries[e.Path]; ok {
+			old = b
+		}
+		printSizeBreakdown(e.Path+" packages", "PACKAGE", size.Packages, old.Packages)
+		printSizeBreakdown(e.Path+" dependencies", "MODULE", size.Modules, old.Modules)
+	}
+
+	if len(grown) > 0 {
+		return errors.Errorf("binaries grow by more than %v%%: %v", threshold, strings.Join(grown, ", "))
+	}
+	return report.Write(tools.StateDir(outputFolder))
+}
+
+// sizeGrowth - return a change of size in percent of old size, old size should not be 0.
+func sizeGrowth(oldSize, size int64) float64 {
+	return float64(size-oldSize) * 100 / float64(oldSize)
+}
+
+// printSizeBreakdown - print biggest entries of sizes with change since baseline, nil baseline means it is not known.
+func printSizeBreakdown(title, column string, sizes, baseline map[string]int64) {
+	names := []string{}
+	for name := range sizes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if sizes[names[i]] != sizes[names[j]] {
+			return sizes[names[i]] > sizes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > sizeTopEntries {
+		names = names[:sizeTopEntries]
+	}
+	_, _ = fmt.Fprintf(os.Stdout, "\n==== %v\n", title)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "%v\tSIZE\tCHANGE\n", column)
+	for _, name := range names {
+		change := "-"
+		if baseline != nil {
+			change = formatSizeChange(sizes[name] - baseline[name])
+		}
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%v\n", name, formatSize(sizes[name]), change)
+	}
+	_ = w.Flush()
+}
+
+// formatSize - format a number of bytes with KB or MB units.
+func formatSize(size int64) string {
+	switch {
+	case size >= 1024*1024 || size <= -1024*1024:
+		return fmt.Sprintf("%.2f MB", float64(size)/(1024*1024))
+	case size >= 1024 || size <= -1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+func formatSizeChange(delta int64) string {
+	if delta > 0 {
+		return "+" + formatSize(delta)
+	}
+	return formatSize(delta)
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func TestSizeGrowth(t *testing.T) {
+	tests := []struct {
+		oldSize, size int64
+		want          float64
+	}{
+		{100, 100, 0},
+		{100, 150, 50},
+		{200, 100, -50},
+		{1, 3, 200},
+	}
+	for _, tt := range tests {
+		if got := sizeGrowth(tt.oldSize, tt.size); got != tt.want {
+			t.Errorf("sizeGrowth(%v, %v) = %v, want %v", tt.oldSize, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{-2048, "-2.0 KB"},
+		{3 * 1024 * 1024, "3.00 MB"},
+	}
+	for _, tt := range tests {
+		if got := formatSize(tt.size); got != tt.want {
+			t.Errorf("formatSize(%v) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+	if got := formatSizeChange(1024); got != "+1.0 KB" {
+		t.Errorf("formatSizeChange(1024) = %q", got)
+	}
+}
+
+func TestReportSizesZeroBaseline(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(path.Join(dir, "app"), []byte("not an ELF binary"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&tools.Manifest{Applications: []*tools.ManifestEntry{{Name: "app", Path: "app"}}}).Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	baseline := &tools.SizeReport{Binaries: map[string]*tools.BinarySize{"app": {Size: 0}}}
+	if err := baseline.Write(tools.StateDir(dir)); err != nil {
+		t.Fatal(err)
+	}
+	// A binary with empty baseline is a new one, so threshold is not applied.
+	if err := reportSizes(dir, 5); err != nil {
+		t.Fatalf("reportSizes() error = %v", err)
+	}
+	report, err := tools.ReadSizeReport(tools.StateDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Binaries["app"].Size != int64(len("not an ELF binary")) {
+		t.Errorf("baseline is not updated: %v", report.Binaries["app"].Size)
+	}
+	// Growth over threshold fails and keeps baseline.
+	if err = ioutil.WriteFile(path.Join(dir, "app"), []byte("not an ELF binary, much bigger now"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = reportSizes(dir, 5); err == nil {
+		t.Errorf("reportSizes() should fail when binary grows by more than threshold")
+	}
+}
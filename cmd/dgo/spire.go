@@ -25,14 +25,24 @@ import (
 	"os"
 )
 
-var spireRoot string
+var spireArguments = struct {
+	root        string
+	trustDomain string
+	port        int
+}{}
 
 func init() {
 	cmd := spireCmd
 	rootCmd.AddCommand(cmd)
 
-	spireCmd.Flags().StringVarP(&spireRoot,
+	spireCmd.Flags().StringVarP(&spireArguments.root,
 		"root", "r", "", "Spire root folder(if not defined temporary folder will be used)")
+
+	spireCmd.Flags().StringVarP(&spireArguments.trustDomain,
+		"trust-domain", "", spire.DefaultTrustDomain, "Spire trust domain")
+
+	spireCmd.Flags().IntVarP(&spireArguments.port,
+		"port", "", spire.DefaultServerPort, "Spire server port")
 }
 
 var spireCmd = &cobra.Command{
@@ -42,16 +52,17 @@ var spireCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		logrus.Infof("NSM.Spire target...")
 
-		agentID := "spiffe://example.org/myagent"
+		agentID := fmt.Sprintf("spiffe://%s/myagent", spireArguments.trustDomain)
 
-		if spireRoot != "" {
-			if err := os.MkdirAll(spireRoot, os.ModePerm); err != nil {
-				logrus.Errorf("Failed to create root folder: %v %v", spireRoot, err)
+		if spireArguments.root != "" {
+			if err := os.MkdirAll(spireArguments.root, os.ModePerm); err != nil {
+				logrus.Errorf("Failed to create root folder: %v %v", spireArguments.root, err)
 				return err
 			}
 		}
 
-		spireContext, err := spire.New(spireRoot, agentID)
+		spireContext, err := spire.New(spireArguments.root, agentID,
+			spire.WithTrustDomain(spireArguments.trustDomain), spire.WithServerPort(spireArguments.port))
 		if err != nil {
 			logrus.Errorf("Error: %v", err)
 			return err
@@ -65,7 +76,7 @@ var spireCmd = &cobra.Command{
 		var curUserId []string
 		curUserId, err = tools.ExecRead(cmd.Context(), "", []string{"id", "-u"}, nil, false)
 
-		if err = spireContext.AddEntry(agentID, fmt.Sprintf("spiffe://example.org/test"), fmt.Sprintf("unix:uid:%s", curUserId[0])); err != nil {
+		if err = spireContext.AddEntry(agentID, fmt.Sprintf("spiffe://%s/test", spireArguments.trustDomain), fmt.Sprintf("unix:uid:%s", curUserId[0])); err != nil {
 			logrus.Fatalf("failed to add entry to spire: %+v", err)
 		}
 
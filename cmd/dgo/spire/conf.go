@@ -19,10 +19,16 @@ package spire
 import (
 	"fmt"
 	"path"
+	"strconv"
 	"strings"
 )
 
-const SocketEnv = "SPIFFE_ENDPOINT_SOCKET"
+const (
+	SocketEnv = "SPIFFE_ENDPOINT_SOCKET"
+
+	DefaultTrustDomain = "example.org"
+	DefaultServerPort  = 8081
+)
 
 func conf(name string, options ...string) string {
 	result := name + " {"
@@ -81,16 +87,16 @@ const (
 	spireServerRegSock      = "spire-registration.sock"
 )
 
-func genSpireConfig(basePath, socketName string) string {
+func genSpireConfig(basePath, socketName, trustDomain string, serverPort int) string {
 	dataPath := path.Join(basePath, ".data")
 	return conf("agent",
 		optS("data_dir", dataPath),
 		optS("log_level", "WARN"),
 		optS("server_address", "127.0.0.1"),
-		optS("server_port", "8081"),
+		optS("server_port", strconv.Itoa(serverPort)),
 		optS("socket_path", path.Join(basePath, socketName)),
 		opt("insecure_bootstrap", "true"),
-		optS("trust_domain", "example.org"),
+		optS("trust_domain", trustDomain),
 	) +
 		conf("plugins",
 			confN("NodeAttestor", "join_token",
@@ -106,13 +112,13 @@ func genSpireConfig(basePath, socketName string) string {
 		)
 }
 
-func genServerConf(basePath, socketName string) string {
+func genServerConf(basePath, socketName, trustDomain string, serverPort int) string {
 	dataPath := path.Join(basePath, ".data")
 	return conf("server",
 		optS("bind_address", "127.0.0.1"),
-		optS("bind_port", "8081"),
+		optS("bind_port", strconv.Itoa(serverPort)),
 		optS("registration_uds_path", socketName),
-		optS("trust_domain", "example.org"),
+		optS("trust_domain", trustDomain),
 		optS("data_dir", path.Join(basePath, ".data")),
 		optS("log_level", "DEBUG"),
 		optS("ca_key_type", "rsa-2048"),
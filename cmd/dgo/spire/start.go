@@ -37,7 +37,26 @@ type SpireContext interface {
 	Start(ctx context.Context) error
 }
 
+// Option - a spire context option.
+type Option func(sc *spireContext)
+
+// WithTrustDomain - set a trust domain, default is example.org
+func WithTrustDomain(trustDomain string) Option {
+	return func(sc *spireContext) {
+		sc.trustDomain = trustDomain
+	}
+}
+
+// WithServerPort - set a spire server port, default is 8081
+func WithServerPort(port int) Option {
+	return func(sc *spireContext) {
+		sc.serverPort = port
+	}
+}
+
 type spireContext struct {
+	trustDomain     string
+	serverPort      int
 	spireRoot       string
 	ctx             context.Context
 	cancel          context.CancelFunc
@@ -49,7 +68,7 @@ type spireContext struct {
 }
 
 // New - contruct a new spire context
-func New(spireRoot string, agentID string) (SpireContext, error) {
+func New(spireRoot string, agentID string, options ...Option) (SpireContext, error) {
 	needClean := false
 	if spireRoot == "" {
 		var err error
@@ -62,11 +81,17 @@ func New(spireRoot string, agentID string) (SpireContext, error) {
 	_ = os.RemoveAll(spireRoot)
 	_ = os.MkdirAll(spireRoot, os.ModePerm)
 
-	return &spireContext{
-		spireRoot: spireRoot,
-		needClean: needClean,
-		agentID:   agentID,
-	}, nil
+	sc := &spireContext{
+		trustDomain: DefaultTrustDomain,
+		serverPort:  DefaultServerPort,
+		spireRoot:   spireRoot,
+		needClean:   needClean,
+		agentID:     agentID,
+	}
+	for _, o := range options {
+		o(sc)
+	}
+	return sc, nil
 }
 
 // AddEntry - adds an entry to the spire server for parentID, spiffeID, and selector
@@ -89,7 +114,7 @@ func (sc *spireContext) Start(ctx context.Context) error {
 
 	// Write the config files (if not present)
 	var err error
-	sc.spireSocketPath, sc.regSocket, err = writeDefaultConfigFiles(ctx, sc.spireRoot)
+	sc.spireSocketPath, sc.regSocket, err = writeDefaultConfigFiles(ctx, sc.spireRoot, sc.trustDomain, sc.serverPort)
 
 	if err != nil {
 		sc.Stop()
@@ -188,12 +213,12 @@ func (sc *spireContext) Stop() {
 }
 
 // writeDefaultConfigFiles - write config files into configRoot and return a spire socket file to use
-func writeDefaultConfigFiles(ctx context.Context, spireRoot string) (spireSocketName string, regSocket string, err error) {
+func writeDefaultConfigFiles(ctx context.Context, spireRoot, trustDomain string, serverPort int) (spireSocketName string, regSocket string, err error) {
 	spireSocketName = path.Join(spireRoot, spireEndpointSocket)
 	regSocket = path.Join(spireRoot, spireServerRegSock)
 	configFiles := map[string]string{
-		spireServerConfFileName: genServerConf(spireRoot, spireServerRegSock),
-		spireAgentConfFilename:  genSpireConfig(spireRoot, spireEndpointSocket),
+		spireServerConfFileName: genServerConf(spireRoot, spireServerRegSock, trustDomain, serverPort),
+		spireAgentConfFilename:  genSpireConfig(spireRoot, spireEndpointSocket, trustDomain, serverPort),
 	}
 	for configName, contents := range configFiles {
 		filename := path.Join(spireRoot, configName)
@@ -17,6 +17,7 @@
 package dgo
 
 import (
+	"context"
 	"fmt"
 	"github.com/haiodo/dgo/cmd/dgo/spire"
 	"github.com/haiodo/dgo/cmd/dgo/tools"
@@ -27,7 +28,11 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -35,16 +40,74 @@ const (
 	DebugEnv       = "DGO_TEST_DEBUG"
 	TestPackageEnv = "DGO_TEST_PACKAGE"
 	SkipBuildEnv   = "DGO_SKIP_BUILD"
+
+	SpireTrustDomainEnv = "DGO_SPIRE_TRUST_DOMAIN"
+	SpirePortEnv        = "DGO_SPIRE_PORT"
+
+	// CoverDirEnv - a folder inside test container to write coverage data to, coverage is collected only if passed.
+	CoverDirEnv = "DGO_COVER_DIR"
+	// ReportDirEnv - a folder inside test container to write test events of every test binary to.
+	ReportDirEnv = "DGO_REPORT_DIR"
+
+	// TestParallelEnv - a number of test binaries executed at once inside test container.
+	TestParallelEnv = "DGO_TEST_PARALLEL"
+	// TestSerialEnv - patterns of test binaries never executed together with other ones, separated with new lines.
+	TestSerialEnv = "DGO_TEST_SERIAL"
+
+	// TestRunEnv, TestSkipEnv - patterns of tests passed to every test binary with -test.run and -test.skip.
+	TestRunEnv  = "DGO_TEST_RUN"
+	TestSkipEnv = "DGO_TEST_SKIP"
+	// TestRetriesEnv - a number of times failed tests are executed again inside test container.
+	TestRetriesEnv = "DGO_TEST_RETRIES"
+
+	// TestShardEnv - a shard executed by test container, like 2/4.
+	TestShardEnv = "DGO_TEST_SHARD"
+	// TestShardItemsEnv - test binaries and binary:test items executed by shard, separated with new lines.
+	TestShardItemsEnv = "DGO_TEST_SHARD_ITEMS"
+
+	// Include and exclude patterns of applications and test packages, separated with new lines.
+	IncludeAppsEnv  = "DGO_INCLUDE_APPS"
+	ExcludeAppsEnv  = "DGO_EXCLUDE_APPS"
+	IncludeTestsEnv = "DGO_INCLUDE_TESTS"
+	ExcludeTestsEnv = "DGO_EXCLUDE_TESTS"
+
+	// testLabel - a label of test containers, used to kill containers left from previous runs.
+	testLabel = "dgo.test"
 )
 
 var testArguments = struct {
 	outputFolder string
+	build        BuildCmdArguments
 
 	spire      bool
 	cgoEnabled bool
+	cache      bool
 
 	debugTests  bool
+	debugPort   int
 	testPackage string
+	run         string
+	skip        string
+	retries     int
+
+	target      string
+	trustDomain string
+	spirePort   int
+
+	watch    bool
+	interval time.Duration
+
+	coverDir  string
+	reportDir string
+
+	parallel int
+	serial   []string
+
+	shards  int
+	shard   string
+	shardBy string
+	// shardHistory - a test report shared by all machines running own --shard.
+	shardHistory string
 }{}
 
 func init() {
@@ -57,14 +120,75 @@ func init() {
 	testCmd.Flags().BoolVarP(&testArguments.cgoEnabled,
 		"cgo", "", false, "If disabled will pass CGO_ENABLED=0 env variable to go compiler")
 
+	testCmd.Flags().BoolVarP(&testArguments.cache,
+		"cache", "", true, "If enabled will skip compile of binaries with unchanged sources and dependencies")
+
 	testCmd.Flags().BoolVarP(&testArguments.spire,
 		"spire", "s", true, "If enabled will run spire")
 
 	testCmd.Flags().BoolVarP(&testArguments.debugTests,
 		"debug", "d", false, "If enabled will start debug for every test we run with dlv")
 
+	testCmd.Flags().IntVarP(&testArguments.debugPort,
+		"debug-port", "", 40000, "A port dlv will listen to if debug is enabled")
+
 	testCmd.Flags().StringVarP(&testArguments.testPackage,
 		"test", "t", "", "Run tests only for specified package")
+
+	testCmd.Flags().StringVarP(&testArguments.run,
+		"run", "", "", "Run only tests matching regular expression, passed as -test.run to every test binary, binaries without matching tests are skipped")
+
+	testCmd.Flags().StringVarP(&testArguments.skip,
+		"skip", "", "", "Do not run tests matching regular expression, passed as -test.skip to every test binary")
+
+	testCmd.Flags().IntVarP(&testArguments.retries,
+		"retries", "", 0, "Run failed tests again up to passed number of times, tests passed by a retry are reported as flaky")
+
+	testCmd.Flags().StringVarP(&testArguments.target,
+		"target", "", "test", "Dockerfile target used to run tests")
+
+	testCmd.Flags().StringVarP(&testArguments.trustDomain,
+		"trust-domain", "", spire.DefaultTrustDomain, "Spire trust domain")
+
+	testCmd.Flags().IntVarP(&testArguments.spirePort,
+		"spire-port", "", spire.DefaultServerPort, "Spire server port")
+
+	testCmd.Flags().BoolVarP(&testArguments.watch,
+		"watch", "w", false, "If enabled will watch sources and re-run affected tests on host, same as dgo watch")
+
+	addWatchIntervalFlag(testCmd, &testArguments.interval)
+	addPlatformFlags(testCmd, &testArguments.build)
+	addBuildPoolFlags(testCmd, &testArguments.build)
+	addCompileFlags(testCmd, &testArguments.build)
+	addRuntimeFlag(testCmd, &testArguments.build)
+	addSinceFlag(testCmd, &testArguments.build.since)
+	addSelectFlags(testCmd, &testArguments.build.selection)
+	addCoverFlags(testCmd, &testArguments.build)
+	addELFCheckFlag(testCmd, &testArguments.build)
+
+	testCmd.Flags().StringVarP(&testArguments.coverDir,
+		"cover-dir", "", "", "Folder to store coverage data, merged profile and HTML report into, default is ${output}/.dgo/coverage")
+
+	testCmd.Flags().StringVarP(&testArguments.reportDir,
+		"report-dir", "", "", "Folder to write JSON and JUnit XML test reports into, reports are not written if empty")
+
+	testCmd.Flags().IntVarP(&testArguments.parallel,
+		"parallel", "p", 1, "Number of test binaries to run at once inside test container, output of every binary is printed after it completes")
+
+	testCmd.Flags().StringArrayVarP(&testArguments.serial,
+		"serial", "", nil, "Never run test packages with import path or binary name matching glob or re:regexp pattern together with other ones")
+
+	testCmd.Flags().IntVarP(&testArguments.shards,
+		"shards", "", 1, "Split tests into passed number of test containers started at once, balanced by durations of previous run")
+
+	testCmd.Flags().StringVarP(&testArguments.shard,
+		"shard", "", "", "Run only one slice i/N of tests, like 2/4, so every CI machine could run own slice")
+
+	testCmd.Flags().StringVarP(&testArguments.shardBy,
+		"shard-by", "", shardByBinary, "Split tests between shards by test binaries or by top level test functions, one of: binary, test")
+
+	testCmd.Flags().StringVarP(&testArguments.shardHistory,
+		"shard-history", "", "", "A test report of previous run shared by all machines to balance --shard, by default --shard is split by names")
 }
 
 var testCmd = &cobra.Command{
@@ -78,6 +202,17 @@ var testCmd = &cobra.Command{
 		if isDocker {
 			return testOnDocker(cmd, args)
 		}
+		if testArguments.watch {
+			return runWatch(cmd, args, &watchOptions{
+				outputFolder: testArguments.outputFolder,
+				cgoEnabled:   testArguments.cgoEnabled,
+				interval:     testArguments.interval,
+				spire:        testArguments.spire,
+				trustDomain:  testArguments.trustDomain,
+				spirePort:    testArguments.spirePort,
+				build:        &testArguments.build,
+			})
+		}
 		return testOnHost(cmd, args)
 	},
 }
@@ -88,69 +223,175 @@ func testOnHost(cmd *cobra.Command, args []string) error {
 		logrus.Errorf("Failed to receive current dir %v", err)
 		return err
 	}
-
-	_, cgoEnv := tools.RetrieveGoEnv(cmdArguments.cgoEnabled, cmdArguments.goos, cmdArguments.goarch)
-
-	if len(args) == 0 {
-		//We look for packages only in docker env, else we run only /bin/*.test applications.
-		args = tools.FindMainPackages(cmd.Context(), curDir, cgoEnv)
+	filter, err := newTestFilter(testArguments.run, testArguments.skip)
+	if err != nil {
+		return err
 	}
 
 	// we need to perform local build before we will start testing in docker container.
 	if err = PerformBuild(cmd, args, &BuildCmdArguments{
 		cgoEnabled:   testArguments.cgoEnabled,
-		goos:         cmdArguments.goos,
-		goarch:       cmdArguments.goarch,
+		goos:         testArguments.build.goos,
+		goarch:       testArguments.build.goarch,
 		docker:       false,
 		outputFolder: testArguments.outputFolder,
 		compileTests: true,
+		cache:        testArguments.cache,
+		jobs:         testArguments.build.jobs,
+		failFast:     testArguments.build.failFast,
+		keepGoing:    testArguments.build.keepGoing,
+		flags:        testArguments.build.flags,
+		replaces:     testArguments.build.replaces,
+		since:        testArguments.build.since,
+		selection:    testArguments.build.selection,
+		cover:        testArguments.build.cover,
+		coverApps:    testArguments.build.coverApps,
+		coverPkg:     testArguments.build.coverPkg,
+		elfCheck:     testArguments.build.elfCheck,
 	}); err != nil {
 		logrus.Errorf("Failed to build %v", err)
 		return err
 	}
 
-	containerId := ""
-	containerId, err = buildTarget(cmd.Context(), curDir, "test", cgoEnv)
+	containerRuntime, err := tools.NewContainerRuntime(cmd.Context(), testArguments.build.runtime)
+	if err != nil {
+		return err
+	}
+
+	imageID := ""
+	imageID, err = buildTarget(cmd.Context(), containerRuntime, curDir, testArguments.target)
 	if err != nil {
 		return err
 	}
 
 	// Remove running containers
-	var containers []string
-	containers, err = tools.ExecRead(cmd.Context(), curDir, []string{"docker", "ps", "--filter", "label=dgo.test"}, nil, false)
+	var containers []*tools.Container
+	containers, err = containerRuntime.ListContainers(cmd.Context(), testLabel)
 	if err != nil {
 		return err
 	}
 	for _, c := range containers {
-		if !strings.HasPrefix(c, "CONTAINER") {
-			killId := strings.Split(c, " ")[0]
-			if len(killId) > 0 {
-				logrus.Infof("Killing container %s", killId)
-				if err := tools.Exec(cmd.Context(), curDir, []string{"docker", "kill", killId}, nil); err != nil {
-					return err
-				}
-			}
+		logrus.Infof("Killing container %s", c.ID)
+		if err = containerRuntime.KillContainer(cmd.Context(), c.ID); err != nil {
+			return err
 		}
 	}
 
-	runCmd := []string{"docker", "run"}
+	config := &tools.ContainerConfig{
+		Image:      imageID,
+		Labels:     map[string]string{testLabel: ""},
+		Ports:      map[int]int{},
+		Mounts:     map[string]string{},
+		AutoRemove: true,
+		// Test container is detected by the marker with any container runtime.
+		Env: []string{fmt.Sprintf("%s=true", tools.ContainerEnv)},
+	}
 
 	if testArguments.testPackage != "" {
-		runCmd = append(runCmd, "-e", fmt.Sprintf("%s=%s", TestPackageEnv, testArguments.testPackage))
+		config.Env = append(config.Env, fmt.Sprintf("%s=%s", TestPackageEnv, testArguments.testPackage))
+	}
+	config.Env = append(config.Env, filter.env()...)
+	if testArguments.retries > 0 {
+		config.Env = append(config.Env, fmt.Sprintf("%s=%d", TestRetriesEnv, testArguments.retries))
 	}
 
 	if testArguments.debugTests {
-		runCmd = append(runCmd, "-e", DebugEnv+"=:40000", "-p", "40000:40000")
+		config.Env = append(config.Env, fmt.Sprintf("%s=:%d", DebugEnv, testArguments.debugPort))
+		config.Ports[testArguments.debugPort] = testArguments.debugPort
 	}
 
-	runCmd = append(runCmd, "--label", "dgo.test", "--rm", containerId)
+	config.Env = append(config.Env, fmt.Sprintf("%s=%s", SpireTrustDomainEnv, testArguments.trustDomain),
+		fmt.Sprintf("%s=%d", SpirePortEnv, testArguments.spirePort))
+	config.Env = append(config.Env, testArguments.build.selection.env()...)
+	config.Env = append(config.Env, parallelEnv(testArguments.parallel, testArguments.serial)...)
+
+	sharded := testArguments.shards > 1 || testArguments.shard != ""
+	reportDir := testArguments.reportDir
+	var shards map[int][]*shardItem
+	shardCount := 1
+	if sharded {
+		if reportDir == "" {
+			// Results of shards are merged from test events, durations of previous run are used to balance shards.
+			reportDir = path.Join(tools.StateDir(testArguments.outputFolder), "reports")
+		}
+		if shards, shardCount, err = planHostShards(testArguments.outputFolder, reportDir, filter); err != nil {
+			logrus.Errorf("Failed to split tests into shards %v", err)
+			return err
+		}
+	}
 
-	err = tools.Exec(cmd.Context(), curDir, runCmd, nil)
+	coverDir := ""
+	if testArguments.build.cover || testArguments.build.coverApps {
+		coverDir = testArguments.coverDir
+		if coverDir == "" {
+			coverDir = path.Join(tools.StateDir(testArguments.outputFolder), "coverage")
+		}
+		dataDir, err := prepareMountDir(path.Join(coverDir, "data"))
+		if err != nil {
+			logrus.Errorf("Failed to prepare coverage folder %v", err)
+			return err
+		}
+		config.Mounts[dataDir] = coverContainerDir
+		config.Env = append(config.Env, fmt.Sprintf("%s=%s", CoverDirEnv, coverContainerDir))
+	}
+	if reportDir != "" {
+		eventsDir, err := prepareMountDir(path.Join(reportDir, testEventsDir))
+		if err != nil {
+			logrus.Errorf("Failed to prepare report folder %v", err)
+			return err
+		}
+		config.Mounts[eventsDir] = reportContainerDir
+		config.Env = append(config.Env, fmt.Sprintf("%s=%s", ReportDirEnv, reportContainerDir))
+	}
+
+	var testErr error
+	if sharded {
+		testErr = runShards(cmd.Context(), containerRuntime, config, shardCount, shards)
+	} else {
+		exitCode, err := containerRuntime.RunContainer(cmd.Context(), config, os.Stdout, os.Stderr)
+		if err != nil {
+			logrus.Errorf("Failed to run container of %v cause: %v", imageID, err)
+			return err
+		}
+		if exitCode != 0 {
+			testErr = errors.Errorf("tests are failed, container exit code %v", exitCode)
+		}
+	}
+	if coverDir != "" {
+		// Coverage of failed tests is reported as well.
+		if err = reportCoverage(cmd.Context(), curDir, coverDir); err != nil {
+			logrus.Errorf("Failed to report coverage %v", err)
+			return err
+		}
+	}
+	if reportDir != "" {
+		report, err := writeTestReports(reportDir)
+		if err != nil {
+			logrus.Errorf("Failed to write test reports %v", err)
+			return err
+		}
+		if sharded {
+			printTestSummary(report)
+		}
+	}
+	return testErr
+}
+
+// prepareMountDir - create an empty folder to be mounted into test container and return its absolute path,
+// content of previous run is removed.
+func prepareMountDir(dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
 	if err != nil {
-		logrus.Errorf("Failed to run docker run %v cause: %v", containerId, err)
-		return err
+		return "", err
+	}
+	if err = os.RemoveAll(absDir); err != nil {
+		return "", err
 	}
-	return nil
+	if err = os.MkdirAll(absDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	// Tests could be executed by any user inside container.
+	return absDir, os.Chmod(absDir, os.ModePerm)
 }
 
 // DEBUG:
@@ -165,56 +406,35 @@ func testOnDocker(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	packages := map[string]map[string]*tools.PackageInfo{}
-	files, err := ioutil.ReadDir("/bin")
+	packages, err := findTestBinaries(cmd.Context(), curDir, "/bin")
 	if err != nil {
 		logrus.Fatalf("failed to list /bin cause: %v", err)
 	}
+	testArguments.build.selection.loadEnv()
+	if err = loadParallelEnv(&testArguments.parallel, &testArguments.serial); err != nil {
+		return errors.Wrapf(err, "invalid %s", TestParallelEnv)
+	}
+	selected, err := newSelection(&testArguments.build.selection)
+	if err != nil {
+		return err
+	}
+	selected.filterTests(packages)
 
-	for _, f := range files {
-		fName := f.Name()
-		const testSuffix = ".test"
-		if strings.HasSuffix(fName, testSuffix) {
-			// This is probable go test, let's find out a tests inside and extract cmdName.
-			cmdName := fName[0 : len(fName)-len(testSuffix)]
-			relPath := ""
-			// Remove .test and put into
-			sepPos := strings.Index(cmdName, testSuffix)
-			if sepPos != -1 {
-				relPath = fName[sepPos+1 : len(fName)]
-				cmdName = fName[0:sepPos]
-			}
-			pkgRoot, ok := packages[cmdName]
-			if !ok {
-				pkgRoot = map[string]*tools.PackageInfo{}
-				packages[cmdName] = pkgRoot
-			}
-			pkgInfo := &tools.PackageInfo{
-				OutName: f.Name(),
-				RelPath: strings.ReplaceAll(relPath, "-", "/"),
-			}
-
-			lines, err := tools.ExecRead(cmd.Context(), curDir, []string{"/bin/" + pkgInfo.OutName, "-test.list", ".*"}, nil, false)
-			if err != nil {
-				logrus.Errorf("Failed to list test for %v cause: %v", pkgInfo.OutName, err)
-			}
-			for _, t := range lines {
-				t = strings.TrimSpace(t)
-				if len(t) > 0 {
-					pkgInfo.Tests = append(pkgInfo.Tests, t)
-				}
-			}
-			logrus.Infof("Found tests for %v %v", pkgInfo.OutName, pkgInfo.Tests)
-
-			pkgRoot[relPath] = pkgInfo
+	if trustDomain := os.Getenv(SpireTrustDomainEnv); trustDomain != "" {
+		testArguments.trustDomain = trustDomain
+	}
+	if spirePort := os.Getenv(SpirePortEnv); spirePort != "" {
+		if testArguments.spirePort, err = strconv.Atoi(spirePort); err != nil {
+			return errors.Wrapf(err, "invalid %s=%s", SpirePortEnv, spirePort)
 		}
 	}
 
 	if testArguments.spire {
 		// We are inside docker, so spire should be available and we just need to run it.
 		// Run spire
-		agentID := "spiffe://example.org/myagent"
-		spireCtx, err := spire.New("", agentID)
+		trustDomain := testArguments.trustDomain
+		agentID := fmt.Sprintf("spiffe://%s/myagent", trustDomain)
+		spireCtx, err := spire.New("", agentID, spire.WithTrustDomain(trustDomain), spire.WithServerPort(testArguments.spirePort))
 		if err != nil {
 			logrus.Errorf("failed to start spire: %v", err)
 		}
@@ -223,17 +443,17 @@ func testOnDocker(cmd *cobra.Command, args []string) error {
 			logrus.Fatalf("failed to run spire: %+v", err)
 		}
 		for _, pkgs := range packages {
-			if err = spireCtx.AddEntry(agentID, fmt.Sprintf("spiffe://example.org/dlv"), fmt.Sprintf("unix:path:/bin/dlv")); err != nil {
+			if err = spireCtx.AddEntry(agentID, fmt.Sprintf("spiffe://%s/dlv", trustDomain), fmt.Sprintf("unix:path:/bin/dlv")); err != nil {
 				logrus.Fatalf("failed to add entry to spire: %+v", err)
 			}
 
-			if err = spireCtx.AddEntry(agentID, fmt.Sprintf("spiffe://example.org/any-test"), fmt.Sprintf("unix:uid:0")); err != nil {
+			if err = spireCtx.AddEntry(agentID, fmt.Sprintf("spiffe://%s/any-test", trustDomain), fmt.Sprintf("unix:uid:0")); err != nil {
 				logrus.Fatalf("failed to add entry to spire: %+v", err)
 			}
 
 			for _, info := range pkgs {
 				if len(info.Tests) > 0 {
-					if err = spireCtx.AddEntry(agentID, fmt.Sprintf("spiffe://example.org/%s", info.OutName),
+					if err = spireCtx.AddEntry(agentID, fmt.Sprintf("spiffe://%s/%s", trustDomain, info.OutName),
 						fmt.Sprintf("unix:path:/bin/%s", info.OutName)); err != nil {
 						logrus.Fatalf("failed to add entry to spire: %+v", err)
 					}
@@ -261,28 +481,192 @@ func testOnDocker(cmd *cobra.Command, args []string) error {
 	if len(testPkg) > 0 {
 		testArguments.testPackage = testPkg
 	}
+	loadTestFilterEnv(&testArguments.run, &testArguments.skip)
+	if retries := os.Getenv(TestRetriesEnv); retries != "" {
+		if testArguments.retries, err = strconv.Atoi(retries); err != nil {
+			return errors.Wrapf(err, "invalid %s=%s", TestRetriesEnv, retries)
+		}
+	}
+	filter, err := newTestFilter(testArguments.run, testArguments.skip)
+	if err != nil {
+		return err
+	}
+
+	// Applications started by tests write coverage data if they are built with coverage instrumentation.
+	coverDir := os.Getenv(CoverDirEnv)
+	var testEnv []string
+	if coverDir != "" {
+		appsDir := path.Join(coverDir, coverAppsDir)
+		if err = os.MkdirAll(appsDir, os.ModePerm); err != nil {
+			return err
+		}
+		testEnv = append(testEnv, "GOCOVERDIR="+appsDir)
+	}
+
+	// Test events are written into folder mounted by host, or into --report-dir if tests are started inside container directly.
+	eventsDir := os.Getenv(ReportDirEnv)
+	if eventsDir == "" && testArguments.reportDir != "" {
+		if eventsDir, err = prepareMountDir(path.Join(testArguments.reportDir, testEventsDir)); err != nil {
+			return err
+		}
+	}
+
+	serial, err := tools.NewNameFilter(testArguments.serial, nil)
+	if err != nil {
+		return err
+	}
 
 	// Ok we are ready to run tests
-	var lastError error
+	binaries := filter.selectBinaries(selectTestBinaries(packages, testArguments.testPackage))
+
+	// Shard items are passed by host, or shard is planned here if --shard is passed to test started inside container directly.
+	var shardTests map[string][]string
+	shard := os.Getenv(TestShardEnv)
+	var items []*shardItem
+	if shard != "" {
+		items = parseShardItems(os.Getenv(TestShardItemsEnv))
+	} else if testArguments.shard != "" {
+		index, count, err := parseShard(testArguments.shard)
+		if err != nil {
+			return err
+		}
+		if err = validateShardBy(testArguments.shardBy); err != nil {
+			return err
+		}
+		history, err := shardHistory(testArguments.reportDir)
+		if err != nil {
+			return err
+		}
+		shard = testArguments.shard
+		items = planShards(binaries, count, testArguments.shardBy == shardByTest, history)[index-1]
+	}
+	if shard != "" {
+		logrus.Infof("Running shard %v with %v test items", shard, len(items))
+		binaries, shardTests = applyShard(binaries, items)
+	}
+
+	run := &testRun{
+		curDir:    curDir,
+		binDir:    "/bin",
+		debugCmd:  debugCmd,
+		env:       testEnv,
+		coverDir:  coverDir,
+		eventsDir: eventsDir,
+		parallel:  testArguments.parallel,
+		serial:    serial,
+		// Only index of shard is used, since it is a part of test events file name.
+		shard:      strings.SplitN(shard, "/", 2)[0],
+		shardTests: shardTests,
+		filter:     filter,
+		retries:    testArguments.retries,
+	}
+	lastError := run.run(cmd.Context(), binaries)
+	if os.Getenv(ReportDirEnv) == "" && testArguments.reportDir != "" {
+		if _, err = writeTestReports(testArguments.reportDir); err != nil {
+			return err
+		}
+	}
+	return lastError
+}
+
+// selectTestBinaries - return test binaries with tests, if testPackage is passed only binary with this name is returned.
+func selectTestBinaries(packages map[string]map[string]*tools.PackageInfo, testPackage string) []*tools.PackageInfo {
+	binaries := []*tools.PackageInfo{}
 	for cmdName, testApp := range packages {
-		logrus.Infof("Running tests for %v", cmdName)
+		logrus.Infof("Found tests for %v", cmdName)
 		for _, testPkg := range testApp {
 			if len(testPkg.Tests) > 0 {
-				if testArguments.testPackage != "" && testArguments.testPackage != testPkg.OutName {
-					logrus.Infof("Testing of %s is skipped since package are selected %v", testPkg.OutName, testArguments.testPackage)
+				if testPackage != "" && testPackage != testPkg.OutName {
+					logrus.Infof("Testing of %s is skipped since package are selected %v", testPkg.OutName, testPackage)
 					continue
 				}
-				// Run the test
-				testExecName := path.Join("/bin", testPkg.OutName)
-
-				execName := append(debugCmd, testExecName)
-				// Run the test
-				if err := tools.Exec(cmd.Context(), curDir, execName, nil); err != nil {
-					logrus.Errorf("Error running test Executable: %q err: %q", testExecName, err)
-					lastError = err
+				binaries = append(binaries, testPkg)
+			}
+		}
+	}
+	sort.Slice(binaries, func(i, j int) bool { return binaries[i].OutName < binaries[j].OutName })
+	return binaries
+}
+
+// findTestBinaries - find all test binaries inside binFolder, grouped by application name and package.
+// If folder contains a build manifest, it is used, else test binaries are detected by name and asked for a list of tests.
+func findTestBinaries(ctx context.Context, curDir, binFolder string) (map[string]map[string]*tools.PackageInfo, error) {
+	if packages, err := findManifestTests(binFolder); err == nil {
+		logrus.Infof("Using build manifest %v", path.Join(binFolder, tools.ManifestFileName))
+		return packages, nil
+	}
+
+	packages := map[string]map[string]*tools.PackageInfo{}
+	files, err := ioutil.ReadDir(binFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		fName := f.Name()
+		const testSuffix = ".test"
+		if strings.HasSuffix(fName, testSuffix) {
+			// This is probable go test, let's find out a tests inside and extract cmdName.
+			cmdName := fName[0 : len(fName)-len(testSuffix)]
+			relPath := ""
+			// Remove .test and put into
+			sepPos := strings.Index(cmdName, testSuffix)
+			if sepPos != -1 {
+				relPath = fName[sepPos+1 : len(fName)]
+				cmdName = fName[0:sepPos]
+			}
+			pkgRoot, ok := packages[cmdName]
+			if !ok {
+				pkgRoot = map[string]*tools.PackageInfo{}
+				packages[cmdName] = pkgRoot
+			}
+			pkgInfo := &tools.PackageInfo{
+				OutName: f.Name(),
+				RelPath: strings.ReplaceAll(relPath, "-", "/"),
+			}
+
+			lines, err := tools.ExecRead(ctx, curDir, []string{path.Join(binFolder, pkgInfo.OutName), "-test.list", ".*"}, nil, false)
+			if err != nil {
+				logrus.Errorf("Failed to list test for %v cause: %v", pkgInfo.OutName, err)
+			}
+			for _, t := range lines {
+				t = strings.TrimSpace(t)
+				if tools.IsTestName(t) {
+					pkgInfo.Tests = append(pkgInfo.Tests, t)
 				}
 			}
+			logrus.Infof("Found tests for %v %v", pkgInfo.OutName, pkgInfo.Tests)
+
+			pkgRoot[relPath] = pkgInfo
 		}
 	}
-	return lastError
+	return packages, nil
+}
+
+// findManifestTests - read test binaries from build manifest stored in binFolder.
+func findManifestTests(binFolder string) (map[string]map[string]*tools.PackageInfo, error) {
+	manifest, err := tools.ReadManifest(binFolder)
+	if err != nil {
+		return nil, err
+	}
+	packages := map[string]map[string]*tools.PackageInfo{}
+	for _, e := range manifest.Tests {
+		if _, err := os.Stat(path.Join(binFolder, e.Path)); err != nil {
+			logrus.Warnf("Test binary %v from manifest is not found: %v", e.Path, err)
+			continue
+		}
+		pkgRoot, ok := packages[e.Application]
+		if !ok {
+			pkgRoot = map[string]*tools.PackageInfo{}
+			packages[e.Application] = pkgRoot
+		}
+		pkgRoot[e.Package] = &tools.PackageInfo{
+			OutName:   e.Path,
+			Package:   e.Package,
+			Tests:     e.Tests,
+			AppFolder: e.Folder,
+		}
+		logrus.Infof("Found tests for %v %v", e.Path, e.Tests)
+	}
+	return packages, nil
 }
@@ -0,0 +1,178 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"fmt"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// testFilter - -test.run and -test.skip patterns passed to every test binary.
+type testFilter struct {
+	run  string
+	skip string
+	// runTop, skipTop - patterns of top level tests, skipTop is set only if skip pattern matches whole top level tests.
+	runTop  *regexp.Regexp
+	skipTop *regexp.Regexp
+}
+
+// newTestFilter - create a filter of run and skip patterns, patterns are split by '/' into top level test and subtest
+// elements like go test does.
+func newTestFilter(run, skip string) (*testFilter, error) {
+	f := &testFilter{run: run, skip: skip}
+	var err error
+	if run != "" {
+		if f.runTop, err = compileTestElement(run); err != nil {
+			return nil, errors.Wrapf(err, "invalid --run %q", run)
+		}
+	}
+	if skip != "" {
+		skipTop, err := compileTestElement(skip)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid --skip %q", skip)
+		}
+		// A skip pattern with subtest elements skips only subtests, so top level tests are still executed.
+		if len(splitTestPattern(skip)) == 1 {
+			f.skipTop = skipTop
+		}
+	}
+	return f, nil
+}
+
+// compileTestElement - validate every element of pattern and return a regexp of its top level test element.
+func compileTestElement(pattern string) (*regexp.Regexp, error) {
+	elements := splitTestPattern(pattern)
+	for _, e := range elements {
+		if _, err := regexp.Compile(e); err != nil {
+			return nil, err
+		}
+	}
+	return regexp.Compile(elements[0])
+}
+
+// splitTestPattern - split pattern by '/' outside of brackets and parentheses, same as testing package does.
+func splitTestPattern(pattern string) []string {
+	elements := []string{}
+	cs, cp := 0, 0
+	start := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '[':
+			cs++
+		case ']':
+			if cs--; cs < 0 {
+				cs = 0
+			}
+		case '(':
+			if cs == 0 {
+				cp++
+			}
+		case ')':
+			if cs == 0 {
+				cp--
+			}
+		case '\\':
+			i++
+		case '/':
+			if cs == 0 && cp == 0 {
+				elements = append(elements, pattern[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(elements, pattern[start:])
+}
+
+// loadTestFilterEnv - override patterns with values passed with environment.
+func loadTestFilterEnv(run, skip *string) {
+	if value, ok := os.LookupEnv(TestRunEnv); ok {
+		*run = value
+	}
+	if value, ok := os.LookupEnv(TestSkipEnv); ok {
+		*skip = value
+	}
+}
+
+// env - return environment to pass patterns into test container.
+func (f *testFilter) env() []string {
+	result := []string{}
+	if f.run != "" {
+		result = append(result, fmt.Sprintf("%s=%s", TestRunEnv, f.run))
+	}
+	if f.skip != "" {
+		result = append(result, fmt.Sprintf("%s=%s", TestSkipEnv, f.skip))
+	}
+	return result
+}
+
+// match - check if top level test is executed with patterns.
+func (f *testFilter) match(test string) bool {
+	if f.runTop != nil && !f.runTop.MatchString(test) {
+		return false
+	}
+	return f.skipTop == nil || !f.skipTop.MatchString(test)
+}
+
+// selectBinaries - return binaries having top level tests matching patterns, tests of returned binaries are
+// restricted to matching ones, so binaries could be split between shards by selected tests only.
+func (f *testFilter) selectBinaries(binaries []*tools.PackageInfo) []*tools.PackageInfo {
+	if f.runTop == nil && f.skipTop == nil {
+		return binaries
+	}
+	selected := []*tools.PackageInfo{}
+	for _, b := range binaries {
+		tests := []string{}
+		for _, t := range b.Tests {
+			if f.match(t) {
+				tests = append(tests, t)
+			}
+		}
+		if len(tests) == 0 {
+			logrus.Infof("Testing of %s is skipped since it has no tests matching --run %q --skip %q", b.OutName, f.run, f.skip)
+			continue
+		}
+		info := *b
+		info.Tests = tests
+		selected = append(selected, &info)
+	}
+	return selected
+}
+
+// args - return -test.run and -test.skip arguments of test binary, if tests are passed only these top level tests
+// are executed, with subtests still selected by --run pattern.
+func (f *testFilter) args(tests []string) []string {
+	result := []string{}
+	run := f.run
+	if tests != nil {
+		run = exactTestsPattern(tests)
+		if elements := splitTestPattern(f.run); f.run != "" && len(elements) > 1 {
+			run += "/" + strings.Join(elements[1:], "/")
+		}
+	}
+	if run != "" {
+		result = append(result, "-test.run="+run)
+	}
+	if f.skip != "" {
+		result = append(result, "-test.skip="+f.skip)
+	}
+	return result
+}
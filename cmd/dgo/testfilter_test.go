@@ -0,0 +1,204 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"reflect"
+	"testing"
+)
+
+func TestSplitTestPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "", want: []string{""}},
+		{pattern: "TestA", want: []string{"TestA"}},
+		{pattern: "TestA/sub", want: []string{"TestA", "sub"}},
+		{pattern: "TestA/sub/deep", want: []string{"TestA", "sub", "deep"}},
+		{pattern: "TestA/", want: []string{"TestA", ""}},
+		{pattern: "Test[/]A/sub", want: []string{"Test[/]A", "sub"}},
+		{pattern: "(TestA/b|TestC)/d", want: []string{"(TestA/b|TestC)", "d"}},
+		{pattern: `Test\/A/sub`, want: []string{`Test\/A`, "sub"}},
+		{pattern: "Test]A/sub", want: []string{"Test]A", "sub"}},
+	}
+	for _, tt := range tests {
+		if got := splitTestPattern(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitTestPattern(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestNewTestFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		run     string
+		skip    string
+		match   map[string]bool
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			match: map[string]bool{"TestA": true, "ExampleA": true},
+		},
+		{
+			name:  "run",
+			run:   "TestA|ExampleB",
+			match: map[string]bool{"TestA": true, "TestAB": true, "ExampleB": true, "TestC": false, "FuzzA": false},
+		},
+		{
+			name:  "run subtests",
+			run:   "^TestA$/sub",
+			match: map[string]bool{"TestA": true, "TestAB": false},
+		},
+		{
+			name:  "skip",
+			skip:  "^TestSlow$",
+			match: map[string]bool{"TestSlow": false, "TestFast": true},
+		},
+		{
+			name:  "skip subtests keeps top level test",
+			skip:  "TestSlow/case",
+			match: map[string]bool{"TestSlow": true},
+		},
+		{
+			name:  "run and skip",
+			run:   "Test",
+			skip:  "TestB",
+			match: map[string]bool{"TestA": true, "TestB": false, "ExampleA": false},
+		},
+		{
+			name:    "invalid run",
+			run:     "Test(",
+			wantErr: true,
+		},
+		{
+			name:    "invalid run subtest",
+			run:     "TestA/[",
+			wantErr: true,
+		},
+		{
+			name:    "invalid skip",
+			skip:    "*",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newTestFilter(tt.run, tt.skip)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for test, want := range tt.match {
+				if got := f.match(test); got != want {
+					t.Errorf("match(%q) = %v, want %v", test, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectBinaries(t *testing.T) {
+	binaries := []*tools.PackageInfo{
+		{OutName: "a.test", Tests: []string{"TestA", "ExampleA"}},
+		{OutName: "b.test", Tests: []string{"TestB", "FuzzB"}},
+	}
+	tests := []struct {
+		name string
+		run  string
+		skip string
+		want map[string][]string
+	}{
+		{
+			name: "no patterns",
+			want: map[string][]string{"a.test": {"TestA", "ExampleA"}, "b.test": {"TestB", "FuzzB"}},
+		},
+		{
+			name: "example",
+			run:  "ExampleA",
+			want: map[string][]string{"a.test": {"ExampleA"}},
+		},
+		{
+			name: "fuzz",
+			run:  "^FuzzB$",
+			want: map[string][]string{"b.test": {"FuzzB"}},
+		},
+		{
+			name: "skip",
+			skip: "^Test",
+			want: map[string][]string{"a.test": {"ExampleA"}, "b.test": {"FuzzB"}},
+		},
+		{
+			name: "nothing",
+			run:  "TestC",
+			want: map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newTestFilter(tt.run, tt.skip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string][]string{}
+			for _, b := range f.selectBinaries(binaries) {
+				got[b.OutName] = b.Tests
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectBinaries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if len(binaries[0].Tests) != 2 {
+		t.Errorf("selectBinaries() should not modify passed binaries, got %v", binaries[0].Tests)
+	}
+}
+
+func TestTestFilterArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		run   string
+		skip  string
+		tests []string
+		want  []string
+	}{
+		{name: "empty", want: []string{}},
+		{name: "run", run: "TestA", want: []string{"-test.run=TestA"}},
+		{name: "run and skip", run: "TestA", skip: "TestA/slow", want: []string{"-test.run=TestA", "-test.skip=TestA/slow"}},
+		{name: "shard tests", tests: []string{"TestA", "Example_b"}, want: []string{"-test.run=^(TestA|Example_b)$"}},
+		{name: "shard tests with subtests", run: "Test.*/fast", tests: []string{"TestA"}, want: []string{"-test.run=^(TestA)$/fast"}},
+		{name: "shard tests are quoted", tests: []string{"TestA.B"}, want: []string{`-test.run=^(TestA\.B)$`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newTestFilter(tt.run, tt.skip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.args(tt.tests); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("args() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
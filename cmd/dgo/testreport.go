@@ -0,0 +1,159 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"context"
+	"fmt"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// reportContainerDir - a folder inside test container test events folder of host is mounted to.
+	reportContainerDir = "/dgo-reports"
+	// testEventsDir - a folder inside report folder test events of every test binary are written to.
+	testEventsDir = "events"
+	// testEventsSuffix - a suffix of test events file of test binary.
+	testEventsSuffix = ".json"
+	// testEventsShardSeparator - a separator of test binary name and shard in test events file name, since
+	// tests of one binary could be executed by several shards.
+	testEventsShardSeparator = "@"
+)
+
+// runTestBinary - run test binary with test2json output and return test events of package, if live is passed
+// output is logged as soon as it is printed.
+func runTestBinary(ctx context.Context, curDir string, execName []string, name, pkg string, env []string, live bool) ([]*tools.TestEvent, error) {
+	events := []*tools.TestEvent{}
+	converter := tools.NewTestEventConverter(pkg, func(e *tools.TestEvent) {
+		if live && e.Action == tools.TestActionOutput {
+			logrus.Infof("%v ==> %v", name, strings.TrimSuffix(e.Output, "\n"))
+		}
+		events = append(events, e)
+	})
+	err := tools.ExecLines(ctx, curDir, execName, env, converter.Line)
+	converter.Exit(err)
+	return events, err
+}
+
+// testBinaryName - return a name of test binary used in reports and as a name of its test events file.
+func testBinaryName(outName string) string {
+	return strings.ReplaceAll(outName, "/", "_")
+}
+
+// writeTestEvents - store test events of test binary executed by shard into eventsDir, shard is empty if tests are not
+// sharded. Nothing is stored if eventsDir is empty.
+func writeTestEvents(eventsDir, binary, shard string, events []*tools.TestEvent) error {
+	if eventsDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(eventsDir, os.ModePerm); err != nil {
+		return err
+	}
+	if shard != "" {
+		binary += testEventsShardSeparator + shard
+	}
+	return tools.WriteTestEvents(path.Join(eventsDir, binary+testEventsSuffix), events)
+}
+
+// readTestReport - read test events of all test binaries stored inside eventsDir into a report,
+// events of same binary written by different shards are merged.
+func readTestReport(eventsDir string) (*tools.TestReport, error) {
+	files, err := ioutil.ReadDir(eventsDir)
+	if err != nil {
+		return nil, err
+	}
+	binaries := []string{}
+	events := map[string][]*tools.TestEvent{}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), testEventsSuffix) {
+			continue
+		}
+		binaryEvents, err := tools.ReadTestEvents(path.Join(eventsDir, f.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read test events %v", f.Name())
+		}
+		binary := strings.SplitN(strings.TrimSuffix(f.Name(), testEventsSuffix), testEventsShardSeparator, 2)[0]
+		if _, ok := events[binary]; !ok {
+			binaries = append(binaries, binary)
+		}
+		events[binary] = append(events[binary], binaryEvents...)
+	}
+	report := &tools.TestReport{}
+	for _, binary := range binaries {
+		report.Add(binary, events[binary])
+	}
+	return report, nil
+}
+
+// writeTestReports - write JSON and JUnit XML reports of test events stored inside events folder of reportDir
+// and return the report.
+func writeTestReports(reportDir string) (*tools.TestReport, error) {
+	report, err := readTestReport(path.Join(reportDir, testEventsDir))
+	if err != nil {
+		return nil, err
+	}
+	jsonFile := path.Join(reportDir, tools.TestReportName)
+	if err = report.WriteJSON(jsonFile); err != nil {
+		return nil, errors.Wrapf(err, "failed to write %v", jsonFile)
+	}
+	junitFile := path.Join(reportDir, tools.JUnitReportName)
+	if err = report.WriteJUnit(junitFile); err != nil {
+		return nil, errors.Wrapf(err, "failed to write %v", junitFile)
+	}
+	logrus.Infof("Test reports %v and %v: %v passed, %v failed, %v skipped, %v flaky", jsonFile, junitFile,
+		report.Passed, report.Failed, report.Skipped, report.Flaky)
+	return report, nil
+}
+
+// printTestSummary - print a table of test binaries with a number of passed, failed, skipped and flaky tests
+// and names of flaky and failed tests.
+func printTestSummary(report *tools.TestReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "\nBINARY\tSTATUS\tPASSED\tFAILED\tSKIPPED\tFLAKY\tTIME")
+	failed, flaky := []string{}, []string{}
+	for _, p := range report.Packages {
+		counts := map[string]int{}
+		for _, t := range p.Tests {
+			counts[t.Status]++
+			switch t.Status {
+			case tools.TestActionFail:
+				failed = append(failed, p.Binary+" "+t.Name)
+			case tools.TestStatusFlaky:
+				flaky = append(flaky, p.Binary+" "+t.Name)
+			}
+		}
+		elapsed := time.Duration(p.Elapsed * float64(time.Second)).Round(time.Millisecond)
+		_, _ = fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", p.Binary, p.Status, counts[tools.TestActionPass],
+			counts[tools.TestActionFail], counts[tools.TestActionSkip], counts[tools.TestStatusFlaky], elapsed)
+	}
+	_ = w.Flush()
+	for _, name := range flaky {
+		_, _ = fmt.Fprintf(os.Stdout, "--- FLAKY: %v\n", name)
+	}
+	for _, name := range failed {
+		_, _ = fmt.Fprintf(os.Stdout, "--- FAIL: %v\n", name)
+	}
+	logrus.Infof("Tests complete: %v passed, %v failed, %v skipped, %v flaky", report.Passed, report.Failed, report.Skipped, report.Flaky)
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"context"
+	"fmt"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// testRun - execution of test binaries inside test container.
+type testRun struct {
+	curDir string
+	// binDir - a folder with test binaries, /bin inside test container.
+	binDir   string
+	debugCmd []string
+	env      []string
+	// coverDir, eventsDir - folders to write coverage data and test events to, empty if they are not collected.
+	coverDir  string
+	eventsDir string
+	// parallel - a number of test binaries executed at once.
+	parallel int
+	// serial - binaries matching patterns are never executed together with other ones.
+	serial *tools.NameFilter
+	// shard - an index of shard executed, empty if tests are not sharded.
+	shard string
+	// shardTests - top level tests to select for binaries split between shards.
+	shardTests map[string][]string
+	// filter - -test.run and -test.skip patterns passed to every binary.
+	filter *testFilter
+	// retries - a number of times failed top level tests of binary are executed again.
+	retries int
+
+	lock   sync.Mutex
+	report *tools.TestReport
+}
+
+// loadParallelEnv - override a number of parallel test binaries and serial patterns with values passed with environment.
+func loadParallelEnv(parallel *int, serial *[]string) error {
+	if value := os.Getenv(TestParallelEnv); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*parallel = n
+	}
+	if value := os.Getenv(TestSerialEnv); value != "" {
+		*serial = strings.Split(value, "\n")
+	}
+	return nil
+}
+
+// parallelEnv - return environment to pass a number of parallel test binaries and serial patterns into test container.
+func parallelEnv(parallel int, serial []string) []string {
+	result := []string{fmt.Sprintf("%s=%d", TestParallelEnv, parallel)}
+	if len(serial) > 0 {
+		result = append(result, fmt.Sprintf("%s=%s", TestSerialEnv, strings.Join(serial, "\n")))
+	}
+	return result
+}
+
+// run - execute test binaries, binaries not matching serial patterns are executed up to parallel at once, with output
+// of every binary printed at once after it completes, serial ones are executed one by one after them.
+// A combined summary of all binaries is printed at the end and an error of last failed binary is returned.
+func (r *testRun) run(ctx context.Context, binaries []*tools.PackageInfo) error {
+	r.report = &tools.TestReport{}
+	sort.Slice(binaries, func(i, j int) bool { return binaries[i].OutName < binaries[j].OutName })
+	parallel := r.parallel
+	if parallel > 1 && len(r.debugCmd) > 0 {
+		logrus.Warnf("Test binaries are executed one by one, since debug is enabled")
+		parallel = 1
+	}
+
+	var lastError error
+	serial := binaries
+	if parallel > 1 {
+		serial = []*tools.PackageInfo{}
+		pool := tools.NewWorkerPool(ctx, parallel, false)
+		for _, b := range binaries {
+			if !r.serial.IsEmpty() && r.serial.Match(b.Package, b.OutName) {
+				serial = append(serial, b)
+				continue
+			}
+			binary := b
+			pool.Go(binary.OutName, func(ctx context.Context) (string, []string, error) {
+				return "", nil, r.runBinary(ctx, binary, true)
+			})
+		}
+		logrus.Infof("Running %v test binaries, %v at once", len(binaries)-len(serial), parallel)
+		for _, result := range pool.Wait() {
+			if result.Err != nil {
+				lastError = result.Err
+			}
+		}
+	}
+	for _, binary := range serial {
+		if err := r.runBinary(ctx, binary, false); err != nil {
+			lastError = err
+		}
+	}
+	printTestSummary(r.report)
+	return lastError
+}
+
+// runBinary - execute test binary and add its results to report, if output is buffered it is printed after binary completes.
+// Failed top level tests are executed again up to retries times, an error of last execution is returned.
+func (r *testRun) runBinary(ctx context.Context, testPkg *tools.PackageInfo, buffered bool) error {
+	testExecName := path.Join(r.binDir, testPkg.OutName)
+	coverArgs, err := coverTestArgs(r.coverDir, testPkg.OutName)
+	if err != nil {
+		return err
+	}
+	pkgName := testPkg.Package
+	if pkgName == "" {
+		pkgName = testPkg.OutName
+	}
+	binary := testBinaryName(testPkg.OutName)
+
+	events := []*tools.TestEvent{}
+	tests := r.shardTests[testPkg.OutName]
+	var runErr error
+	for attempt := 0; attempt <= r.retries; attempt++ {
+		testArgs := append([]string{"-test.v=test2json"}, coverArgs...)
+		testArgs = append(testArgs, r.filter.args(tests)...)
+		if len(r.debugCmd) > 0 {
+			// dlv passes arguments after -- to debugged binary.
+			testArgs = append([]string{"--"}, testArgs...)
+		}
+		execName := append(append(append([]string{}, r.debugCmd...), testExecName), testArgs...)
+
+		var attemptEvents []*tools.TestEvent
+		if attempt == 0 {
+			logrus.Infof("Running tests of %v", binary)
+		} else {
+			logrus.Warnf("Retrying failed tests of %v %v, attempt %v of %v", binary, tests, attempt, r.retries)
+		}
+		attemptEvents, runErr = runTestBinary(ctx, r.curDir, execName, binary, pkgName, r.env, !buffered)
+		events = append(events, attemptEvents...)
+		if runErr == nil {
+			break
+		}
+		logrus.Errorf("Error running test Executable: %q err: %q", testExecName, runErr)
+		if tests = failedTopLevelTests(binary, attemptEvents); len(tests) == 0 {
+			// Binary is failed outside of tests, like panic in TestMain, so there is nothing to retry.
+			break
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if buffered {
+		_, _ = fmt.Fprintf(os.Stdout, "\n==== %v\n", binary)
+		for _, e := range events {
+			if e.Action == tools.TestActionOutput {
+				_, _ = fmt.Fprint(os.Stdout, e.Output)
+			}
+		}
+	}
+	r.report.Add(binary, events)
+	if err = writeTestEvents(r.eventsDir, binary, r.shard, events); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// failedTopLevelTests - return top level tests failed by execution of test binary.
+func failedTopLevelTests(binary string, events []*tools.TestEvent) []string {
+	failed := []string{}
+	for _, t := range (&tools.TestReport{}).Add(binary, events).Tests {
+		if t.Status == tools.TestActionFail && !strings.Contains(t.Name, "/") {
+			failed = append(failed, t.Name)
+		}
+	}
+	return failed
+}
+
+// exactTestsPattern - return a -test.run pattern matching only passed top level tests.
+func exactTestsPattern(tests []string) string {
+	quoted := []string{}
+	for _, t := range tests {
+		quoted = append(quoted, regexp.QuoteMeta(t))
+	}
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
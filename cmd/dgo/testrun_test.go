@@ -0,0 +1,139 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestBinary - write a script acting as test binary, it logs its start and end into log file.
+func writeTestBinary(t *testing.T, binDir, name, logFile string) {
+	t.Helper()
+	script := fmt.Sprintf(`#!/bin/sh
+echo "start %[1]s" >> %[2]s
+echo "=== RUN   TestA"
+echo "first line of %[1]s"
+sleep 0.2
+echo "second line of %[1]s"
+echo "--- PASS: TestA (0.20s)"
+echo "PASS"
+echo "end %[1]s" >> %[2]s
+`, name, logFile)
+	fileName := filepath.Join(binDir, name)
+	if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fileName, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// captureStdout - return everything written into stdout by f.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+	output := make(chan string)
+	go func() {
+		content, _ := io.ReadAll(reader)
+		output <- string(content)
+	}()
+	f()
+	_ = writer.Close()
+	return <-output
+}
+
+func TestTestRunParallel(t *testing.T) {
+	binDir := t.TempDir()
+	logFile := filepath.Join(binDir, "run.log")
+	binaries := []*tools.PackageInfo{}
+	for _, name := range []string{"app/a.test", "app/b.test", "app/c.test", "app/d.test", "app/e.test", "app/serial.test"} {
+		writeTestBinary(t, binDir, name, logFile)
+		binaries = append(binaries, &tools.PackageInfo{OutName: name, Package: "example.com/" + strings.TrimSuffix(name, ".test")})
+	}
+	serial, err := tools.NewNameFilter([]string{"app/serial.test"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &testRun{curDir: binDir, binDir: binDir, parallel: 2, serial: serial, filter: &testFilter{}}
+	var runErr error
+	output := captureStdout(t, func() { runErr = r.run(context.Background(), binaries) })
+	if runErr != nil {
+		t.Fatal(runErr)
+	}
+
+	// At most parallel binaries are running at once, serial one is running alone after all other ones.
+	content, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running, maxRunning, finished := 0, 0, 0
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		if strings.HasPrefix(line, "start ") {
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			if line == "start app/serial.test" && (running != 1 || finished != len(binaries)-1) {
+				t.Errorf("serial binary is started together with other ones:\n%s", content)
+			}
+		} else {
+			running--
+			finished++
+		}
+	}
+	if maxRunning != r.parallel || finished != len(binaries) {
+		t.Errorf("expected %v binaries running at once, got %v, %v of %v finished:\n%s", r.parallel, maxRunning, finished, len(binaries), content)
+	}
+
+	// Output of every binary executed in parallel is printed at once after a header.
+	binary := ""
+	lines := map[string][]string{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "==== ") {
+			binary = strings.TrimPrefix(line, "==== ")
+			continue
+		}
+		if binary != "" && strings.Contains(line, " line of ") {
+			lines[binary] = append(lines[binary], line)
+		}
+	}
+	for _, b := range binaries[:len(binaries)-1] {
+		want := fmt.Sprintf("first line of %[1]v,second line of %[1]v", b.OutName)
+		if got := strings.Join(lines[testBinaryName(b.OutName)], ","); got != want {
+			t.Errorf("output of %v = %q, want %q", b.OutName, got, want)
+		}
+	}
+	if r.report.Passed != len(binaries) {
+		t.Errorf("expected %v passed tests, got %v", len(binaries), r.report.Passed)
+	}
+}
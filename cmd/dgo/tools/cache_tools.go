@@ -0,0 +1,241 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StateDirName - a folder inside output folder for dgo own files, like build cache, it is not a part of binaries
+// copied into images, so it should be excluded from docker build context.
+const StateDirName = ".dgo"
+
+// CacheFileName - a name of build cache file stored inside state folder.
+const CacheFileName = "cache.json"
+
+// StateDir - return a folder for dgo own files inside output folder.
+func StateDir(outputFolder string) string {
+	return path.Join(outputFolder, StateDirName)
+}
+
+// BuildCache - a content addressed cache of compiled binaries, every output file is associated with a key
+// calculated from package sources and all its transitive dependencies.
+type BuildCache struct {
+	fileName string
+	lock     sync.Mutex
+	Entries  map[string]string `json:"entries"`
+}
+
+// LoadBuildCache - load a build cache from folder, if no cache exists an empty one will be returned.
+func LoadBuildCache(folder string) *BuildCache {
+	cache := &BuildCache{
+		fileName: path.Join(folder, CacheFileName),
+		Entries:  map[string]string{},
+	}
+	content, err := ioutil.ReadFile(cache.fileName)
+	if err != nil {
+		return cache
+	}
+	if err = json.Unmarshal(content, cache); err != nil {
+		logrus.Warnf("Failed to parse build cache %v, cache will be ignored: %v", cache.fileName, err)
+		cache.Entries = map[string]string{}
+	}
+	if cache.Entries == nil {
+		cache.Entries = map[string]string{}
+	}
+	return cache
+}
+
+// IsValid - tells if output file exists and was produced from sources with same key.
+func (c *BuildCache) IsValid(outPath, key string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.Entries[outPath] != key {
+		return false
+	}
+	_, err := os.Stat(outPath)
+	return err == nil
+}
+
+// Update - remember a key output file was produced from.
+func (c *BuildCache) Update(outPath, key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.Entries[outPath] = key
+}
+
+// Save - store build cache into output folder.
+func (c *BuildCache) Save() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(path.Dir(c.fileName), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.fileName, content, 0600)
+}
+
+type listModule struct {
+	Path    string
+	Version string
+	Sum     string
+	Main    bool
+	Replace *listModule
+}
+
+// listPackage - a subset of go list -json output.
+type listPackage struct {
+	Dir          string
+	ImportPath   string
+	Name         string
+	ForTest      string
+	Standard     bool
+	Module       *listModule
+	Imports      []string
+	GoFiles      []string
+	CgoFiles     []string
+	CFiles       []string
+	CXXFiles     []string
+	HFiles       []string
+	SFiles       []string
+	SysoFiles    []string
+	EmbedFiles   []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+}
+
+// PackageHash - calculate a content hash of package and all its transitive dependencies.
+//
+// Standard library packages are identified by go version, versioned modules by their sum,
+// and all other packages by content of their source files. Extra values, like compiler flags, are mixed into hash.
+func PackageHash(ctx context.Context, dir, pkg string, test bool, env []string, extra ...string) (string, error) {
+	listCmd := []string{"go", "list", "-deps", "-json"}
+	if test {
+		listCmd = append(listCmd, "-test")
+	}
+	listCmd = append(listCmd, pkg)
+	lines, err := ExecRead(ctx, dir, listCmd, env, false)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to list dependencies of %v: %v", pkg, strings.Join(lines, "\n"))
+	}
+	version, err := ExecRead(ctx, dir, []string{"go", "version"}, env, false)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to retrieve go version")
+	}
+
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "go:%s\n", strings.Join(version, ""))
+	for _, e := range append(append([]string{}, env...), extra...) {
+		_, _ = fmt.Fprintf(hash, "extra:%s\n", e)
+	}
+
+	packages, err := decodePackages(lines)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse dependencies of %v", pkg)
+	}
+	for _, p := range packages {
+		if err = hashPackage(hash, p, test); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashPackage - hash package files, _test.go files are hashed only for test binaries.
+func hashPackage(hash io.Writer, p *listPackage, test bool) error {
+	if p.Standard {
+		_, _ = fmt.Fprintf(hash, "std:%s\n", p.ImportPath)
+		return nil
+	}
+	if m := p.Module; m != nil {
+		if m.Replace != nil {
+			m = m.Replace
+		}
+		if m.Version != "" {
+			_, _ = fmt.Fprintf(hash, "mod:%s:%s@%s:%s\n", p.ImportPath, m.Path, m.Version, m.Sum)
+			return nil
+		}
+	}
+	_, _ = fmt.Fprintf(hash, "pkg:%s\n", p.ImportPath)
+	files := []string{}
+	groups := [][]string{p.GoFiles, p.CgoFiles, p.CFiles, p.CXXFiles, p.HFiles, p.SFiles, p.SysoFiles, p.EmbedFiles}
+	if test {
+		groups = append(groups, p.TestGoFiles, p.XTestGoFiles)
+	}
+	for _, group := range groups {
+		files = append(files, group...)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		if path.IsAbs(f) {
+			// Generated files, like test main, are stored in go build cache with content addressed names.
+			_, _ = fmt.Fprintf(hash, "gen:%s\n", f)
+			continue
+		}
+		fileHash, err := FileHash(path.Join(p.Dir, f))
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(hash, "file:%s:%s\n", f, fileHash)
+	}
+	return nil
+}
+
+// FileHash - calculate sha256 of file content.
+func FileHash(fileName string) (string, error) {
+	f, err := os.Open(fileName) // #nosec
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ReplaceIfChanged - move newFile to target if content is different, else newFile is removed and
+// target is kept untouched, so it modification time stay stable.
+func ReplaceIfChanged(newFile, target string) (changed bool, err error) {
+	newContent, err := ioutil.ReadFile(newFile) // #nosec
+	if err != nil {
+		return false, err
+	}
+	oldContent, err := ioutil.ReadFile(target) // #nosec
+	if err == nil && bytes.Equal(newContent, oldContent) {
+		return false, os.Remove(newFile)
+	}
+	return true, os.Rename(newFile, target)
+}
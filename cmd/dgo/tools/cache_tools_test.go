@@ -0,0 +1,175 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPackageHash(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOPROXY", "off")
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":            "module example.com/app\n\ngo 1.20\n",
+		"main.go":           "package main\n\nimport (\n\t_ \"embed\"\n\n\t\"example.com/app/util\"\n)\n\n//go:embed data.txt\nvar data string\n\nfunc main() { util.Print(data) }\n",
+		"data.txt":          "data",
+		"util/util.go":      "package util\n\n// Print - print a value.\nfunc Print(value string) { println(value) }\n",
+		"other/other.go":    "package other\n",
+		"readme.md":         "readme",
+		"util/util_test.go": "package util\n",
+	})
+	hash := func(test bool, extra ...string) string {
+		t.Helper()
+		key, err := PackageHash(context.Background(), dir, ".", test, nil, extra...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	update := func(name, content string) {
+		t.Helper()
+		writeTestFiles(t, dir, map[string]string{name: content})
+	}
+
+	key := hash(false, "go", "build")
+	if hash(false, "go", "build") != key {
+		t.Error("key is not stable")
+	}
+	update("other/other.go", "package other\n\n// Other - a package not imported by application.\nvar Other = 1\n")
+	update("readme.md", "changed")
+	update("util/util_test.go", "package util\n\nimport \"testing\"\n\nfunc TestPrint(t *testing.T) {}\n")
+	if hash(false, "go", "build") != key {
+		t.Error("key is changed by files which are not a part of application")
+	}
+
+	for _, change := range []struct {
+		name, content, restore string
+	}{
+		{name: "util/util.go", content: "package util\n\n// Print - print a value.\nfunc Print(value string) { println(value, 1) }\n",
+			restore: "package util\n\n// Print - print a value.\nfunc Print(value string) { println(value) }\n"},
+		{name: "data.txt", content: "changed data", restore: "data"},
+	} {
+		update(change.name, change.content)
+		if hash(false, "go", "build") == key {
+			t.Errorf("key is not changed by %v", change.name)
+		}
+		update(change.name, change.restore)
+		if hash(false, "go", "build") != key {
+			t.Errorf("key is not restored with %v", change.name)
+		}
+	}
+	if hash(false, "go", "build", "-trimpath") == key {
+		t.Error("key is not changed by compiler flags")
+	}
+	if hash(true, "go", "build") == key {
+		t.Error("key of test binary is same as application one")
+	}
+}
+
+func TestBuildCache(t *testing.T) {
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "app")
+	if err := os.WriteFile(outPath, []byte("binary"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := LoadBuildCache(dir)
+	if cache.IsValid(outPath, "key") {
+		t.Error("empty cache should not contain entries")
+	}
+	cache.Update(outPath, "key")
+	cache.Update(filepath.Join(dir, "removed"), "key")
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	cache = LoadBuildCache(dir)
+	if !cache.IsValid(outPath, "key") {
+		t.Error("saved entry is not valid")
+	}
+	if cache.IsValid(outPath, "other") {
+		t.Error("entry with other key is valid")
+	}
+	if cache.IsValid(filepath.Join(dir, "removed"), "key") {
+		t.Error("entry of removed binary is valid")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, CacheFileName), []byte("{\"entries\": [1, 2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cache = LoadBuildCache(dir)
+	if len(cache.Entries) != 0 || cache.IsValid(outPath, "key") {
+		t.Errorf("corrupted cache should be ignored, got %v", cache.Entries)
+	}
+	cache.Update(outPath, "key")
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if !LoadBuildCache(dir).IsValid(outPath, "key") {
+		t.Error("corrupted cache is not replaced")
+	}
+}
+
+func TestReplaceIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app")
+	newFile := filepath.Join(dir, "app.dgo-tmp")
+	if err := os.WriteFile(target, []byte("binary"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(target, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(newFile, []byte("binary"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := ReplaceIfChanged(newFile, target)
+	if err != nil || changed {
+		t.Fatalf("ReplaceIfChanged() of same content = %v, %v", changed, err)
+	}
+	if info, err := os.Stat(target); err != nil || !info.ModTime().Equal(modTime) {
+		t.Errorf("modification time of unchanged file is updated: %v %v", info.ModTime(), err)
+	}
+	if _, err = os.Stat(newFile); !os.IsNotExist(err) {
+		t.Errorf("new file is not removed: %v", err)
+	}
+
+	if err = os.WriteFile(newFile, []byte("changed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err = ReplaceIfChanged(newFile, target); err != nil || !changed {
+		t.Fatalf("ReplaceIfChanged() of changed content = %v, %v", changed, err)
+	}
+	if content, err := os.ReadFile(target); err != nil || string(content) != "changed" {
+		t.Errorf("target is not replaced: %q %v", content, err)
+	}
+
+	// Target is created if it doesn't exist.
+	if err = os.WriteFile(newFile, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err = ReplaceIfChanged(newFile, filepath.Join(dir, "new")); err != nil || !changed {
+		t.Errorf("ReplaceIfChanged() of new target = %v, %v", changed, err)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"archive/tar"
+	"bufio"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DockerIgnoreFileName - a file with patterns excluded from docker build context.
+const DockerIgnoreFileName = ".dockerignore"
+
+type ignorePattern struct {
+	reg     *regexp.Regexp
+	exclude bool
+}
+
+// DockerIgnore - a matcher of .dockerignore patterns.
+type DockerIgnore struct {
+	patterns    []*ignorePattern
+	hasExcludes bool
+}
+
+// LoadDockerIgnore - load .dockerignore from context dir, an empty matcher is returned if there is no file.
+func LoadDockerIgnore(contextDir string) (*DockerIgnore, error) {
+	result := &DockerIgnore{}
+	file, err := os.Open(filepath.Join(contextDir, DockerIgnoreFileName)) // #nosec
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err = result.Add(line); err != nil {
+			return nil, errors.Wrapf(err, "invalid %v pattern %v", DockerIgnoreFileName, line)
+		}
+	}
+	return result, scanner.Err()
+}
+
+// Add - add a pattern, patterns started with ! are exceptions.
+func (d *DockerIgnore) Add(pattern string) error {
+	p := &ignorePattern{}
+	if strings.HasPrefix(pattern, "!") {
+		p.exclude = true
+		d.hasExcludes = true
+		pattern = strings.TrimSpace(pattern[1:])
+	}
+	pattern = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	var err error
+	p.reg, err = regexp.Compile(GlobExpr(pattern))
+	if err != nil {
+		return err
+	}
+	d.patterns = append(d.patterns, p)
+	return nil
+}
+
+// Ignored - tells if a slash separated path relative to context dir is excluded from context.
+// A path is also excluded if one of its parent folders is matched, last matched pattern wins.
+func (d *DockerIgnore) Ignored(rel string) bool {
+	ignored := false
+	parts := strings.Split(rel, "/")
+	for _, p := range d.patterns {
+		for i := 1; i <= len(parts); i++ {
+			if p.reg.MatchString(strings.Join(parts[:i], "/")) {
+				ignored = !p.exclude
+				break
+			}
+		}
+	}
+	return ignored
+}
+
+// WriteContextTar - write a tar archive of docker build context into writer, files matched by .dockerignore
+// are skipped, except Dockerfile and .dockerignore which are always sent to daemon.
+func WriteContextTar(contextDir, dockerfile string, writer io.Writer) error {
+	ignore, err := LoadDockerIgnore(contextDir)
+	if err != nil {
+		return err
+	}
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	always := map[string]bool{filepath.ToSlash(filepath.Clean(dockerfile)): true, DockerIgnoreFileName: true}
+
+	tw := tar.NewWriter(writer)
+	err = filepath.Walk(contextDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(contextDir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ignore.Ignored(rel) && !always[rel] {
+			// A folder could not be skipped if there are exceptions, they could match its content.
+			if info.IsDir() && !ignore.hasExcludes {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&(os.ModeSocket|os.ModeNamedPipe|os.ModeDevice) != 0 {
+			// Sockets, pipes and devices could not be archived.
+			return nil
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(p) // #nosec
+		if err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to write docker build context")
+	}
+	return tw.Close()
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDockerIgnore(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		ignored  []string
+		included []string
+	}{
+		{
+			name:     "empty",
+			included: []string{"main.go", "dist/app"},
+		},
+		{
+			name:     "folder",
+			patterns: []string{"dist"},
+			ignored:  []string{"dist", "dist/app", "dist/.dgo/cache.json"},
+			included: []string{"distx", "cmd/dist"},
+		},
+		{
+			name:     "nested folder",
+			patterns: []string{"/dist/.dgo/"},
+			ignored:  []string{"dist/.dgo", "dist/.dgo/cache.json"},
+			included: []string{"dist/app", "dist"},
+		},
+		{
+			name:     "glob in root",
+			patterns: []string{"*.log"},
+			ignored:  []string{"build.log"},
+			included: []string{"logs/build.log", "build.log.txt"},
+		},
+		{
+			name:     "any folder",
+			patterns: []string{"**/*.log"},
+			ignored:  []string{"build.log", "logs/build.log", "a/b/c.log"},
+			included: []string{"build.txt"},
+		},
+		{
+			name:     "exception",
+			patterns: []string{"dist", "!dist/app"},
+			ignored:  []string{"dist", "dist/other"},
+			included: []string{"dist/app"},
+		},
+		{
+			name:     "last pattern wins",
+			patterns: []string{"!dist/app", "dist"},
+			ignored:  []string{"dist/app"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &DockerIgnore{}
+			for _, p := range tt.patterns {
+				if err := d.Add(p); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, rel := range tt.ignored {
+				if !d.Ignored(rel) {
+					t.Errorf("%v should be ignored by %v", rel, tt.patterns)
+				}
+			}
+			for _, rel := range tt.included {
+				if d.Ignored(rel) {
+					t.Errorf("%v should not be ignored by %v", rel, tt.patterns)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadDockerIgnore(t *testing.T) {
+	dir := t.TempDir()
+	d, err := LoadDockerIgnore(dir)
+	if err != nil || d.Ignored("dist") {
+		t.Fatalf("missing %v should ignore nothing: %v", DockerIgnoreFileName, err)
+	}
+	content := "# build output\n\ndist\n  !dist/app  \n"
+	if err = ioutil.WriteFile(filepath.Join(dir, DockerIgnoreFileName), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if d, err = LoadDockerIgnore(dir); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Ignored("dist/other") || d.Ignored("dist/app") || d.Ignored("# build output") {
+		t.Errorf("patterns of %v are not loaded", DockerIgnoreFileName)
+	}
+}
+
+func TestWriteContextTar(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"build/Dockerfile":    "FROM scratch\n",
+		DockerIgnoreFileName:  "build\n.git\n!build/keep\n",
+		"main.go":             "package main\n",
+		"build/keep":          "keep",
+		"build/other":         "other",
+		".git/HEAD":           "ref: refs/heads/main\n",
+		"pkg/testdata/x.json": "{}",
+	} {
+		fileName := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fileName, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("main.go", filepath.Join(dir, "link.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteContextTar(dir, "build/Dockerfile", buf); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	reader := tar.NewReader(buf)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(content)
+		if header.Typeflag == tar.TypeSymlink {
+			files[header.Name] = "-> " + header.Linkname
+		}
+	}
+	want := map[string]string{
+		DockerIgnoreFileName:  "build\n.git\n!build/keep\n",
+		"build/Dockerfile":    "FROM scratch\n",
+		"build/keep":          "keep",
+		"link.go":             "-> main.go",
+		"main.go":             "package main\n",
+		"pkg/":                "",
+		"pkg/testdata/":       "",
+		"pkg/testdata/x.json": "{}",
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("context = %v, want %v", files, want)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CoverMode - a coverage mode of all instrumented binaries, data of binaries could be merged only with same mode.
+	CoverMode = "atomic"
+	// CoverProfileName - a name of merged coverage profile in text format.
+	CoverProfileName = "coverage.out"
+	// CoverHTMLName - a name of HTML coverage report.
+	CoverHTMLName = "coverage.html"
+)
+
+// CoverArgs - return go build arguments to build a coverage instrumented binary, coverPkg is a comma separated
+// list of package patterns to instrument, by default only packages of binary module are instrumented.
+func CoverArgs(coverPkg string) []string {
+	args := []string{"-cover", "-covermode=" + CoverMode}
+	if coverPkg != "" {
+		args = append(args, "-coverpkg="+coverPkg)
+	}
+	return args
+}
+
+// CoverageReport - a number of statements and covered statements per package import path.
+type CoverageReport struct {
+	Statements map[string]int
+	Covered    map[string]int
+}
+
+// Percent - return a percent of covered statements of package, or of all packages if pkg is empty.
+func (r *CoverageReport) Percent(pkg string) float64 {
+	statements, covered := 0, 0
+	for p, count := range r.Statements {
+		if pkg == "" || p == pkg {
+			statements += count
+			covered += r.Covered[p]
+		}
+	}
+	if statements == 0 {
+		return 0
+	}
+	return float64(covered) * 100 / float64(statements)
+}
+
+// MergeCoverage - merge coverage data folders written by binaries built with -cover (GOCOVERDIR or -test.gocoverdir)
+// into a text profile stored in outDir and return a report of it.
+func MergeCoverage(ctx context.Context, dir string, dataDirs []string, outDir string, env []string) (*CoverageReport, error) {
+	mergedDir := path.Join(outDir, "merged")
+	if err := os.RemoveAll(mergedDir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(mergedDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	input := "-i=" + strings.Join(dataDirs, ",")
+	mergeCmd := []string{"go", "tool", "covdata", "merge", input, "-o", mergedDir}
+	if output, err := ExecRead(ctx, dir, mergeCmd, env, false); err != nil {
+		return nil, errors.Wrapf(err, "failed to merge coverage data: %v", strings.Join(output, "\n"))
+	}
+	profile := path.Join(outDir, CoverProfileName)
+	textCmd := []string{"go", "tool", "covdata", "textfmt", "-i=" + mergedDir, "-o", profile}
+	if output, err := ExecRead(ctx, dir, textCmd, env, false); err != nil {
+		return nil, errors.Wrapf(err, "failed to convert coverage data: %v", strings.Join(output, "\n"))
+	}
+	return ReadCoverProfile(profile)
+}
+
+// CoverHTML - write a HTML report of coverage profile, sources of packages are resolved from dir.
+func CoverHTML(ctx context.Context, dir, profile, outFile string, env []string) error {
+	htmlCmd := []string{"go", "tool", "cover", "-html=" + profile, "-o", outFile}
+	if output, err := ExecRead(ctx, dir, htmlCmd, env, false); err != nil {
+		return errors.Wrapf(err, "failed to write coverage HTML: %v", strings.Join(output, "\n"))
+	}
+	return nil
+}
+
+// ReadCoverProfile - read a text coverage profile, like example.com/app/pkg/file.go:3.16,5.2 2 1 lines.
+func ReadCoverProfile(fileName string) (*CoverageReport, error) {
+	content, err := ioutil.ReadFile(filepath.Clean(fileName))
+	if err != nil {
+		return nil, err
+	}
+	report := &CoverageReport{Statements: map[string]int{}, Covered: map[string]int{}}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.Contains(fields[0], ":") {
+			return nil, errors.Errorf("invalid coverage profile %v line %q", fileName, line)
+		}
+		statements, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid coverage profile %v line %q", fileName, line)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid coverage profile %v line %q", fileName, line)
+		}
+		pkg := path.Dir(fields[0][:strings.LastIndex(fields[0], ":")])
+		report.Statements[pkg] += statements
+		if count > 0 {
+			report.Covered[pkg] += statements
+		}
+	}
+	return report, nil
+}
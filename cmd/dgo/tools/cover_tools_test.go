@@ -0,0 +1,137 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func TestReadCoverProfile(t *testing.T) {
+	tests := []struct {
+		name       string
+		profile    string
+		statements map[string]int
+		covered    map[string]int
+		total      float64
+		wantErr    bool
+	}{
+		{
+			name:       "empty",
+			profile:    "mode: atomic\n",
+			statements: map[string]int{},
+			covered:    map[string]int{},
+		},
+		{
+			name: "packages",
+			profile: "mode: atomic\n" +
+				"example.com/app/pkg/a.go:3.16,5.2 2 1\n" +
+				"example.com/app/pkg/a.go:7.16,9.2 2 0\n" +
+				"example.com/app/pkg/b.go:3.16,5.2 4 3\n" +
+				"example.com/app/main.go:3.13,5.2 2 0\n",
+			statements: map[string]int{"example.com/app/pkg": 8, "example.com/app": 2},
+			covered:    map[string]int{"example.com/app/pkg": 6},
+			total:      60,
+		},
+		{
+			name:    "missing fields",
+			profile: "mode: atomic\nexample.com/app/main.go:3.13,5.2 2\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing position",
+			profile: "mode: atomic\nexample.com/app/main.go 2 1\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid count",
+			profile: "mode: atomic\nexample.com/app/main.go:3.13,5.2 2 x\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := path.Join(t.TempDir(), CoverProfileName)
+			if err := ioutil.WriteFile(fileName, []byte(tt.profile), 0600); err != nil {
+				t.Fatal(err)
+			}
+			report, err := ReadCoverProfile(fileName)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", report)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalCounts(report.Statements, tt.statements) {
+				t.Errorf("statements = %v, want %v", report.Statements, tt.statements)
+			}
+			if !equalCounts(report.Covered, tt.covered) {
+				t.Errorf("covered = %v, want %v", report.Covered, tt.covered)
+			}
+			if got := report.Percent(""); got != tt.total {
+				t.Errorf("total percent = %v, want %v", got, tt.total)
+			}
+		})
+	}
+}
+
+func TestCoverageReportPercent(t *testing.T) {
+	report := &CoverageReport{
+		Statements: map[string]int{"a": 4, "b": 6, "c": 0},
+		Covered:    map[string]int{"a": 1, "b": 6},
+	}
+	tests := []struct {
+		pkg  string
+		want float64
+	}{
+		{pkg: "", want: 70},
+		{pkg: "a", want: 25},
+		{pkg: "b", want: 100},
+		{pkg: "c", want: 0},
+		{pkg: "unknown", want: 0},
+	}
+	for _, tt := range tests {
+		if got := report.Percent(tt.pkg); got != tt.want {
+			t.Errorf("Percent(%q) = %v, want %v", tt.pkg, got, tt.want)
+		}
+	}
+}
+
+func TestCoverArgs(t *testing.T) {
+	if got := CoverArgs(""); len(got) != 2 || got[1] != "-covermode="+CoverMode {
+		t.Errorf("CoverArgs(\"\") = %v", got)
+	}
+	if got := CoverArgs("./..."); len(got) != 3 || got[2] != "-coverpkg=./..." {
+		t.Errorf("CoverArgs(\"./...\") = %v", got)
+	}
+}
+
+func equalCounts(a, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
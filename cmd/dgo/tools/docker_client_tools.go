@@ -0,0 +1,553 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DockerHostEnv - an environment variable with docker daemon address, only unix:// addresses are supported.
+	DockerHostEnv = "DOCKER_HOST"
+	// DefaultDockerSocket - a default docker daemon socket.
+	DefaultDockerSocket = "/var/run/docker.sock"
+)
+
+// DockerError - an error returned by docker engine API.
+type DockerError struct {
+	// Op - an operation failed, like "container create".
+	Op string
+	// StatusCode - an HTTP status code of response.
+	StatusCode int
+	// Message - a message returned by docker daemon.
+	Message string
+}
+
+func (e *DockerError) Error() string {
+	return fmt.Sprintf("docker %s failed (%d): %s", e.Op, e.StatusCode, e.Message)
+}
+
+// IsDockerNotFound - tells if error is caused by missing image or container.
+func IsDockerNotFound(err error) bool {
+	de, ok := errors.Cause(err).(*DockerError)
+	return ok && de.StatusCode == http.StatusNotFound
+}
+
+// IsDockerConflict - tells if error is caused by a conflict, like container is not running or name is in use.
+func IsDockerConflict(err error) bool {
+	de, ok := errors.Cause(err).(*DockerError)
+	return ok && de.StatusCode == http.StatusConflict
+}
+
+// DockerClient - a docker engine API client talking to docker daemon over unix socket.
+type DockerClient struct {
+	socket string
+	client *http.Client
+}
+
+// NewDockerClient - construct a client for docker daemon socket, if socket is empty DOCKER_HOST or
+// default socket is used.
+func NewDockerClient(socket string) *DockerClient {
+	if socket == "" {
+		socket = DefaultDockerSocket
+		if host := os.Getenv(DockerHostEnv); strings.HasPrefix(host, "unix://") {
+			socket = strings.TrimPrefix(host, "unix://")
+		}
+	}
+	return &DockerClient{
+		socket: socket,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// Socket - return a path to docker daemon socket.
+func (c *DockerClient) Socket() string {
+	return c.socket
+}
+
+// ImageBuildOptions - options of image build.
+type ImageBuildOptions struct {
+	Dockerfile string
+	Target     string
+	Tags       []string
+	BuildArgs  map[string]string
+	Labels     map[string]string
+	NoCache    bool
+	// Push, Output - a destination of multi platform image, pushed to registry with tags or exported with
+	// buildx --output value, like type=oci,dest=image.tar.
+	Push   bool
+	Output string
+}
+
+// ContainerConfig - a configuration of container to create.
+type ContainerConfig struct {
+	Name   string
+	Image  string
+	Cmd    []string
+	Env    []string
+	Labels map[string]string
+	// Ports - host port to container port mapping.
+	Ports map[int]int
+	// Mounts - host path to container path bind mounts.
+	Mounts map[string]string
+	// AutoRemove - remove container after exit, like docker run --rm.
+	AutoRemove bool
+}
+
+// Container - a container returned by container list.
+type Container struct {
+	ID     string            `json:"Id"`
+	Image  string            `json:"Image"`
+	Names  []string          `json:"Names"`
+	State  string            `json:"State"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// Ping - check docker daemon is available.
+func (c *DockerClient) Ping(ctx context.Context) error {
+	resp, err := c.do(ctx, "ping", http.MethodGet, "/_ping", nil, "")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// ImageBuild - build an image with context streamed from contextDir, .dockerignore is respected.
+// Build output is logged, image id and steps of build are returned.
+func (c *DockerClient) ImageBuild(ctx context.Context, contextDir string, options *ImageBuildOptions) (string, []*BuildStep, error) {
+	query := url.Values{}
+	query.Set("rm", "1")
+	if options.Dockerfile != "" {
+		query.Set("dockerfile", options.Dockerfile)
+	}
+	if options.Target != "" {
+		query.Set("target", options.Target)
+	}
+	for _, t := range options.Tags {
+		query.Add("t", t)
+	}
+	if options.NoCache {
+		query.Set("nocache", "1")
+	}
+	for name, value := range map[string]map[string]string{"buildargs": options.BuildArgs, "labels": options.Labels} {
+		if len(value) > 0 {
+			content, err := json.Marshal(value)
+			if err != nil {
+				return "", nil, err
+			}
+			query.Set(name, string(content))
+		}
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(WriteContextTar(contextDir, options.Dockerfile, writer))
+	}()
+	defer func() { _ = reader.Close() }()
+
+	resp, err := c.do(ctx, "image build", http.MethodPost, "/build?"+query.Encode(), reader, "application/x-tar")
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	progress := &legacyBuildProgress{}
+	imageID := ""
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		msg := &struct {
+			Stream string `json:"stream"`
+			Status string `json:"status"`
+			Error  string `json:"error"`
+			Aux    *struct {
+				ID string `json:"ID"`
+			} `json:"aux"`
+		}{}
+		if err = decoder.Decode(msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", progress.result(), errors.Wrap(err, "failed to read image build output")
+		}
+		if msg.Error != "" {
+			progress.fail(msg.Error)
+			return "", progress.result(), &DockerError{Op: "image build", StatusCode: http.StatusOK, Message: msg.Error}
+		}
+		if msg.Aux != nil && msg.Aux.ID != "" {
+			imageID = msg.Aux.ID
+		}
+		for _, line := range strings.Split(strings.TrimRight(msg.Stream+msg.Status, "\n"), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				logrus.Infof("docker build ==> %v", line)
+				progress.parse(line)
+			}
+		}
+	}
+	if imageID == "" {
+		imageID = progress.imageID
+	}
+	if imageID == "" {
+		return "", progress.result(), &DockerError{Op: "image build", StatusCode: resp.StatusCode, Message: "no image id is reported"}
+	}
+	return imageID, progress.result(), nil
+}
+
+// ContainerList - list running containers having all passed labels, label could be a "key" or "key=value".
+func (c *DockerClient) ContainerList(ctx context.Context, labels ...string) ([]*Container, error) {
+	query := url.Values{}
+	if len(labels) > 0 {
+		filters, err := json.Marshal(map[string][]string{"label": labels})
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", string(filters))
+	}
+	result := []*Container{}
+	err := c.doJSON(ctx, "container list", http.MethodGet, "/containers/json?"+query.Encode(), nil, &result)
+	return result, err
+}
+
+// ContainerCreate - create a container and return its id.
+func (c *DockerClient) ContainerCreate(ctx context.Context, config *ContainerConfig) (string, error) {
+	type portBinding struct {
+		HostPort string `json:"HostPort"`
+	}
+	request := map[string]interface{}{
+		"Image":        config.Image,
+		"Cmd":          config.Cmd,
+		"Env":          config.Env,
+		"Labels":       config.Labels,
+		"AttachStdout": true,
+		"AttachStderr": true,
+	}
+	exposed := map[string]struct{}{}
+	bindings := map[string][]portBinding{}
+	for hostPort, containerPort := range config.Ports {
+		port := fmt.Sprintf("%d/tcp", containerPort)
+		exposed[port] = struct{}{}
+		bindings[port] = append(bindings[port], portBinding{HostPort: fmt.Sprint(hostPort)})
+	}
+	binds := []string{}
+	for hostPath, containerPath := range config.Mounts {
+		binds = append(binds, hostPath+":"+containerPath)
+	}
+	sort.Strings(binds)
+	request["ExposedPorts"] = exposed
+	request["HostConfig"] = map[string]interface{}{
+		"AutoRemove":   config.AutoRemove,
+		"PortBindings": bindings,
+		"Binds":        binds,
+	}
+	query := url.Values{}
+	if config.Name != "" {
+		query.Set("name", config.Name)
+	}
+	result := &struct {
+		ID string `json:"Id"`
+	}{}
+	if err := c.doJSON(ctx, "container create", http.MethodPost, "/containers/create?"+query.Encode(), request, result); err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+// ContainerStart - start a created container.
+func (c *DockerClient) ContainerStart(ctx context.Context, id string) error {
+	return c.doJSON(ctx, "container start", http.MethodPost, "/containers/"+id+"/start", nil, nil)
+}
+
+// ContainerAttach - attach to container output and copy it into stdout and stderr until container exits.
+func (c *DockerClient) ContainerAttach(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	resp, err := c.attach(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return copyMultiplexed(resp.Body, stdout, stderr)
+}
+
+// ContainerWait - wait for container exit and return its exit code.
+func (c *DockerClient) ContainerWait(ctx context.Context, id string) (int, error) {
+	resp, err := c.wait(ctx, id)
+	if err != nil {
+		return -1, err
+	}
+	return decodeWait(resp)
+}
+
+func (c *DockerClient) attach(ctx context.Context, id string) (*http.Response, error) {
+	return c.do(ctx, "container attach", http.MethodPost, "/containers/"+id+"/attach?stream=1&stdout=1&stderr=1", nil, "")
+}
+
+func (c *DockerClient) wait(ctx context.Context, id string) (*http.Response, error) {
+	return c.do(ctx, "container wait", http.MethodPost, "/containers/"+id+"/wait?condition=next-exit", nil, "")
+}
+
+func decodeWait(resp *http.Response) (int, error) {
+	defer func() { _ = resp.Body.Close() }()
+	result := &struct {
+		StatusCode int `json:"StatusCode"`
+		Error      *struct {
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return -1, errors.Wrap(err, "failed to decode docker container wait response")
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return result.StatusCode, &DockerError{Op: "container wait", StatusCode: resp.StatusCode, Message: result.Error.Message}
+	}
+	return result.StatusCode, nil
+}
+
+// ContainerKill - send a signal to container, if signal is empty SIGKILL is used.
+func (c *DockerClient) ContainerKill(ctx context.Context, id, signal string) error {
+	query := url.Values{}
+	if signal != "" {
+		query.Set("signal", signal)
+	}
+	return c.doJSON(ctx, "container kill", http.MethodPost, "/containers/"+id+"/kill?"+query.Encode(), nil, nil)
+}
+
+// ContainerRemove - remove container, if force is passed running container will be killed.
+func (c *DockerClient) ContainerRemove(ctx context.Context, id string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+	return c.doJSON(ctx, "container remove", http.MethodDelete, "/containers/"+id+"?"+query.Encode(), nil, nil)
+}
+
+// ContainerRun - create and start a container, copy its output to stdout and stderr, and wait for it to exit.
+// If context is canceled container is killed. Container exit code is returned.
+func (c *DockerClient) ContainerRun(ctx context.Context, config *ContainerConfig, stdout, stderr io.Writer) (int, error) {
+	id, err := c.ContainerCreate(ctx, config)
+	if err != nil {
+		return -1, err
+	}
+	cleanup := func() {
+		if !config.AutoRemove {
+			if err := c.ContainerRemove(context.Background(), id, true); err != nil && !IsDockerNotFound(err) {
+				logrus.Warnf("Failed to remove container %v: %v", id, err)
+			}
+		}
+	}
+	defer cleanup()
+
+	// Attach and wait before start, so no output or exit is missed.
+	attachCtx, cancelAttach := context.WithCancel(context.Background())
+	defer cancelAttach()
+	attachResp, err := c.attach(attachCtx, id)
+	if err != nil {
+		return -1, err
+	}
+	waitResp, err := c.wait(attachCtx, id)
+	if err != nil {
+		_ = attachResp.Body.Close()
+		return -1, err
+	}
+	attachDone := make(chan error, 1)
+	go func() {
+		defer func() { _ = attachResp.Body.Close() }()
+		attachDone <- copyMultiplexed(attachResp.Body, stdout, stderr)
+	}()
+	type waitResult struct {
+		code int
+		err  error
+	}
+	waitDone := make(chan waitResult, 1)
+	go func() {
+		code, err := decodeWait(waitResp)
+		waitDone <- waitResult{code, err}
+	}()
+
+	kill := func() {
+		logrus.Infof("Killing container %v", id)
+		if err := c.ContainerKill(context.Background(), id, ""); err != nil && !IsDockerNotFound(err) && !IsDockerConflict(err) {
+			logrus.Warnf("Failed to kill container %v: %v", id, err)
+		}
+	}
+	if err = c.ContainerStart(ctx, id); err != nil {
+		if ctx.Err() != nil {
+			// Container could be started even if context is canceled before response is received.
+			kill()
+			return -1, ctx.Err()
+		}
+		return -1, err
+	}
+	logrus.Infof("Container %v is started", id)
+
+	select {
+	case <-ctx.Done():
+		kill()
+		return -1, ctx.Err()
+	case result := <-waitDone:
+		select {
+		case <-attachDone:
+		case <-time.After(time.Second):
+		}
+		return result.code, result.err
+	}
+}
+
+func (c *DockerClient) doJSON(ctx context.Context, op, method, path string, request, result interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if request != nil {
+		content, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(content)
+		contentType = "application/json"
+	}
+	resp, err := c.do(ctx, op, method, path, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if result == nil {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.Wrapf(err, "failed to decode docker %s response", op)
+	}
+	return nil
+}
+
+func (c *DockerClient) do(ctx context.Context, op, method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, "http://docker"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to docker daemon at %v", c.socket)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer func() { _ = resp.Body.Close() }()
+		content, _ := ioutil.ReadAll(resp.Body)
+		msg := &struct {
+			Message string `json:"message"`
+		}{}
+		if json.Unmarshal(content, msg) != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(content))
+		}
+		return nil, &DockerError{Op: op, StatusCode: resp.StatusCode, Message: msg.Message}
+	}
+	return resp, nil
+}
+
+// copyMultiplexed - copy docker attach stream, every frame has 8 byte header with stream type and frame size.
+func copyMultiplexed(reader io.Reader, stdout, stderr io.Writer) error {
+	r := bufio.NewReader(reader)
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		out := stdout
+		if header[0] == 2 {
+			out = stderr
+		}
+		if _, err := io.CopyN(out, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+var (
+	legacyStepReg    = regexp.MustCompile(`^Step \d+/\d+ : (.*)$`)
+	legacyImageIDReg = regexp.MustCompile(`^Successfully built ([0-9a-f]+)$`)
+)
+
+// legacyBuildProgress - collect build steps from legacy builder output.
+type legacyBuildProgress struct {
+	steps   []*BuildStep
+	imageID string
+}
+
+func (p *legacyBuildProgress) parse(line string) {
+	now := time.Now()
+	if m := legacyStepReg.FindStringSubmatch(line); m != nil {
+		p.complete(now)
+		p.steps = append(p.steps, &BuildStep{Name: m[1], Started: now})
+		return
+	}
+	if m := legacyImageIDReg.FindStringSubmatch(line); m != nil {
+		p.complete(now)
+		p.imageID = m[1]
+		return
+	}
+	if len(p.steps) > 0 && strings.Contains(line, "Using cache") {
+		p.steps[len(p.steps)-1].Cached = true
+	}
+}
+
+func (p *legacyBuildProgress) complete(now time.Time) {
+	if len(p.steps) > 0 {
+		last := p.steps[len(p.steps)-1]
+		if last.Duration == 0 {
+			last.Duration = now.Sub(last.Started)
+		}
+	}
+}
+
+func (p *legacyBuildProgress) fail(message string) {
+	p.complete(time.Now())
+	if len(p.steps) > 0 {
+		p.steps[len(p.steps)-1].Error = message
+	}
+}
+
+func (p *legacyBuildProgress) result() []*BuildStep {
+	p.complete(time.Now())
+	return p.steps
+}
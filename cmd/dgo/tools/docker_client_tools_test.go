@@ -0,0 +1,282 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startFakeDocker(t *testing.T) (*FakeDockerEngine, *DockerClient) {
+	engine, err := NewFakeDockerEngine(filepath.Join(t.TempDir(), "docker.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = engine.Close() })
+	return engine, NewDockerClient(engine.Socket)
+}
+
+func buildFakeImage(t *testing.T, client *DockerClient) string {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	imageID, _, err := client.ImageBuild(context.Background(), dir, &ImageBuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return imageID
+}
+
+func TestDockerClientImageBuild(t *testing.T) {
+	engine, client := startFakeDocker(t)
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"Dockerfile":         "FROM scratch\n",
+		".dockerignore":      "dist/.dgo\n*.log\n",
+		"main.go":            "package main\n",
+		"build.log":          "log\n",
+		"dist/app":           "binary",
+		"dist/.dgo/cache":    "{}",
+		"dist/app-pkg.test":  "binary",
+		"pkg/pkg.go":         "package pkg\n",
+		"pkg/testdata/a.log": "log\n",
+	} {
+		fileName := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fileName, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	imageID, steps, err := client.ImageBuild(context.Background(), dir, &ImageBuildOptions{
+		Target:    "test",
+		Tags:      []string{"app:latest"},
+		BuildArgs: map[string]string{"SKIP_BUILD": "true"},
+		Labels:    map[string]string{"dgo.test": ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := engine.Images()
+	if len(images) != 1 || images[0].ID != imageID {
+		t.Fatalf("image %v is not built, images: %v", imageID, images)
+	}
+	img := images[0]
+	if img.Target != "test" || !reflect.DeepEqual(img.Tags, []string{"app:latest"}) ||
+		img.BuildArgs["SKIP_BUILD"] != "true" || len(img.Labels) != 1 {
+		t.Errorf("build options are not passed: %+v", img)
+	}
+	want := []string{".dockerignore", "Dockerfile", "dist/", "dist/app", "dist/app-pkg.test", "main.go", "pkg/", "pkg/pkg.go", "pkg/testdata/",
+		// Like docker does, patterns without folders match only files in context root.
+		"pkg/testdata/a.log"}
+	if !reflect.DeepEqual(img.Files, want) {
+		t.Errorf("context files = %v, want %v", img.Files, want)
+	}
+	if len(steps) != 1 || steps[0].Name != "FROM scratch" {
+		t.Errorf("unexpected build steps %v", steps)
+	}
+}
+
+func TestDockerClientContainerRun(t *testing.T) {
+	engine, client := startFakeDocker(t)
+	imageID := buildFakeImage(t, client)
+	engine.Run = func(c *FakeContainer) (string, string, int) {
+		return "out " + strings.Join(c.Env, ","), "err", 3
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code, err := client.ContainerRun(context.Background(), &ContainerConfig{
+		Image:      imageID,
+		Env:        []string{"A=1"},
+		Labels:     map[string]string{"dgo.test": ""},
+		Ports:      map[int]int{40001: 40000},
+		Mounts:     map[string]string{"/host": "/container"},
+		AutoRemove: false,
+	}, stdout, stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 3 || stdout.String() != "out A=1" || stderr.String() != "err" {
+		t.Errorf("ContainerRun() = %v, stdout %q, stderr %q", code, stdout.String(), stderr.String())
+	}
+	if containers := engine.Containers(); len(containers) != 0 {
+		t.Errorf("container is not removed: %v", containers)
+	}
+
+	if _, err = client.ContainerRun(context.Background(), &ContainerConfig{Image: "unknown"}, stdout, stderr); !IsDockerNotFound(err) {
+		t.Errorf("not found error is expected for unknown image, got %v", err)
+	}
+}
+
+func TestDockerClientContainerRunCanceled(t *testing.T) {
+	engine, client := startFakeDocker(t)
+	imageID := buildFakeImage(t, client)
+	started := make(chan *FakeContainer)
+	engine.Run = func(c *FakeContainer) (string, string, int) {
+		started <- c
+		<-c.done
+		return "", "", 0
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err := client.ContainerRun(ctx, &ContainerConfig{Image: imageID, AutoRemove: true}, ioutil.Discard, ioutil.Discard)
+	if err != context.Canceled {
+		t.Errorf("canceled error is expected, got %v", err)
+	}
+	for _, c := range engine.Containers() {
+		if c.State == "running" {
+			t.Errorf("container %v is not killed", c.ID)
+		}
+	}
+}
+
+func TestDockerClientContainers(t *testing.T) {
+	engine, client := startFakeDocker(t)
+	ctx := context.Background()
+	test := engine.AddContainer("image", map[string]string{"dgo.test": "", "shard": "1"})
+	engine.AddContainer("image", map[string]string{"other": ""})
+
+	tests := []struct {
+		labels []string
+		want   int
+	}{
+		{labels: nil, want: 2},
+		{labels: []string{"dgo.test"}, want: 1},
+		{labels: []string{"dgo.test", "shard=1"}, want: 1},
+		{labels: []string{"shard=2"}, want: 0},
+	}
+	for _, tt := range tests {
+		containers, err := client.ContainerList(ctx, tt.labels...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(containers) != tt.want {
+			t.Errorf("ContainerList(%v) returned %v containers, want %v", tt.labels, len(containers), tt.want)
+		}
+	}
+
+	if err := client.ContainerKill(ctx, test.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ContainerKill(ctx, test.ID, ""); !IsDockerConflict(err) {
+		t.Errorf("conflict error is expected for stopped container, got %v", err)
+	}
+	if err := client.ContainerKill(ctx, "unknown", ""); !IsDockerNotFound(err) {
+		t.Errorf("not found error is expected for unknown container, got %v", err)
+	}
+	if containers, err := client.ContainerList(ctx, "dgo.test"); err != nil || len(containers) != 0 {
+		t.Errorf("killed container is listed %v %v", containers, err)
+	}
+}
+
+func TestDockerClientNotAvailable(t *testing.T) {
+	client := NewDockerClient(filepath.Join(t.TempDir(), "docker.sock"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Ping(ctx); err == nil {
+		t.Error("ping of missing socket is expected to fail")
+	}
+}
+
+func TestNewDockerClientSocket(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "", want: DefaultDockerSocket},
+		{host: "unix:///run/user/1000/docker.sock", want: "/run/user/1000/docker.sock"},
+		{host: "tcp://localhost:2375", want: DefaultDockerSocket},
+	}
+	for _, tt := range tests {
+		t.Setenv(DockerHostEnv, tt.host)
+		if got := NewDockerClient("").Socket(); got != tt.want {
+			t.Errorf("socket of %v = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+	if got := NewDockerClient("/tmp/docker.sock").Socket(); got != "/tmp/docker.sock" {
+		t.Errorf("passed socket is not used, got %v", got)
+	}
+}
+
+func multiplexedFrame(stream byte, data string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	return append(header, data...)
+}
+
+func TestCopyMultiplexed(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  []byte
+		stdout string
+		stderr string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "streams",
+			input:  bytes.Join([][]byte{multiplexedFrame(1, "out1 "), multiplexedFrame(2, "err"), multiplexedFrame(1, "out2")}, nil),
+			stdout: "out1 out2",
+			stderr: "err",
+		},
+		{
+			name:   "stdin is written to stdout",
+			input:  multiplexedFrame(0, "in"),
+			stdout: "in",
+		},
+		{
+			name:   "empty frame",
+			input:  append(multiplexedFrame(1, ""), multiplexedFrame(2, "err")...),
+			stderr: "err",
+		},
+		{
+			name:   "truncated header",
+			input:  append(multiplexedFrame(1, "out"), 2, 0, 0),
+			stdout: "out",
+		},
+		{
+			name:   "truncated frame",
+			input:  multiplexedFrame(2, "error")[:10],
+			stderr: "er",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			if err := copyMultiplexed(bytes.NewReader(tt.input), stdout, stderr); err != nil {
+				t.Fatal(err)
+			}
+			if stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+				t.Errorf("stdout %q, stderr %q, want %q, %q", stdout.String(), stderr.String(), tt.stdout, tt.stderr)
+			}
+		})
+	}
+}
@@ -18,29 +18,19 @@
 package tools
 
 import (
-	"io/ioutil"
 	"os"
-	"strings"
 )
 
-// IsDocker - tells we are running from inside docker or other container.
+// ContainerEnv - an environment variable set to true inside containers started by dgo and images created by dgo init,
+// so container is detected with any container runtime.
+const ContainerEnv = "DGO_CONTAINER"
+
+// IsDocker - tells we are running from inside dgo test container or other docker container.
 func IsDocker() bool {
-	return isDockerFileExists() || isDockerHasCGroup()
+	return os.Getenv(ContainerEnv) == "true" || isDockerFileExists()
 }
 
 func isDockerFileExists() bool {
 	_, err := os.Stat("/.dockerenv")
-	if err != nil {
-		return false
-	}
-	return os.IsExist(err)
-}
-
-func isDockerHasCGroup() bool {
-	content, err := ioutil.ReadFile("/proc/self/cgroup")
-	if err != nil {
-		return false
-	}
-	text := string(content)
-	return strings.Contains(text, "docker") || strings.Contains(text, "lxc")
+	return err == nil
 }
@@ -0,0 +1,177 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// elfArch - an ELF machine and class of binaries built for GOARCH.
+type elfArch struct {
+	machine elf.Machine
+	class   elf.Class
+}
+
+var goarchELF = map[string]elfArch{
+	"386":      {elf.EM_386, elf.ELFCLASS32},
+	"amd64":    {elf.EM_X86_64, elf.ELFCLASS64},
+	"arm":      {elf.EM_ARM, elf.ELFCLASS32},
+	"arm64":    {elf.EM_AARCH64, elf.ELFCLASS64},
+	"loong64":  {elf.EM_LOONGARCH, elf.ELFCLASS64},
+	"mips":     {elf.EM_MIPS, elf.ELFCLASS32},
+	"mipsle":   {elf.EM_MIPS, elf.ELFCLASS32},
+	"mips64":   {elf.EM_MIPS, elf.ELFCLASS64},
+	"mips64le": {elf.EM_MIPS, elf.ELFCLASS64},
+	"ppc64":    {elf.EM_PPC64, elf.ELFCLASS64},
+	"ppc64le":  {elf.EM_PPC64, elf.ELFCLASS64},
+	"riscv64":  {elf.EM_RISCV, elf.ELFCLASS64},
+	"s390x":    {elf.EM_S390, elf.ELFCLASS64},
+}
+
+// SectionDiff - a difference of ELF section between two binaries.
+type SectionDiff struct {
+	Name string
+	// Size, OtherSize - sizes of section in both binaries, -1 if binary has no such section.
+	Size      int64
+	OtherSize int64
+	// Offset - an offset of first differing byte inside section, -1 if only sizes are different.
+	Offset int64
+}
+
+// CompareSections - compare content of all ELF sections of two binaries, return differing sections sorted by name.
+// If all sections are equal, but files are different, a diff of ELF header is returned.
+func CompareSections(fileName, otherFileName string) ([]*SectionDiff, error) {
+	file, err := elf.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read ELF %v", fileName)
+	}
+	defer func() { _ = file.Close() }()
+	other, err := elf.Open(otherFileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read ELF %v", otherFileName)
+	}
+	defer func() { _ = other.Close() }()
+
+	names := map[string]bool{}
+	for _, s := range append(append([]*elf.Section{}, file.Sections...), other.Sections...) {
+		if s.Name != "" {
+			names[s.Name] = true
+		}
+	}
+	result := []*SectionDiff{}
+	for name := range names {
+		diff, err := compareSection(file.Section(name), other.Section(name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to compare section %v", name)
+		}
+		if diff != nil {
+			diff.Name = name
+			result = append(result, diff)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	if len(result) == 0 && file.FileHeader != other.FileHeader {
+		result = append(result, &SectionDiff{Name: "(ELF header)", Size: -1, OtherSize: -1, Offset: -1})
+	}
+	return result, nil
+}
+
+func compareSection(section, other *elf.Section) (*SectionDiff, error) {
+	diff := &SectionDiff{Size: -1, OtherSize: -1, Offset: -1}
+	if section != nil {
+		diff.Size = int64(section.Size)
+	}
+	if other != nil {
+		diff.OtherSize = int64(other.Size)
+	}
+	if section == nil || other == nil {
+		return diff, nil
+	}
+	if section.Type == elf.SHT_NOBITS || other.Type == elf.SHT_NOBITS {
+		// Section has no content in file, like .bss
+		if diff.Size == diff.OtherSize && section.Type == other.Type {
+			return nil, nil
+		}
+		return diff, nil
+	}
+	data, err := section.Data()
+	if err != nil {
+		return nil, err
+	}
+	otherData, err := other.Data()
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(data, otherData) {
+		return nil, nil
+	}
+	for i := 0; i < len(data) && i < len(otherData); i++ {
+		if data[i] != otherData[i] {
+			diff.Offset = int64(i)
+			break
+		}
+	}
+	return diff, nil
+}
+
+// CheckELF - check binary is built for goarch, and if static is passed it has no dynamic interpreter and no needed
+// libraries. A list of found problems is returned, binaries of other formats, like darwin or windows ones, are not checked.
+func CheckELF(fileName, goarch string, static bool) ([]string, error) {
+	file, err := elf.Open(fileName)
+	if err != nil {
+		if _, ok := err.(*elf.FormatError); ok {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read ELF %v", fileName)
+	}
+	defer func() { _ = file.Close() }()
+
+	problems := []string{}
+	if arch, ok := goarchELF[goarch]; ok {
+		if file.Machine != arch.machine || file.Class != arch.class {
+			problems = append(problems, fmt.Sprintf("architecture %v %v does not match GOARCH=%v, expected %v %v",
+				file.Machine, file.Class, goarch, arch.machine, arch.class))
+		}
+	}
+	if !static {
+		return problems, nil
+	}
+	for _, p := range file.Progs {
+		if p.Type != elf.PT_INTERP {
+			continue
+		}
+		interp, err := ioutil.ReadAll(p.Open())
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read interpreter of %v", fileName)
+		}
+		problems = append(problems, fmt.Sprintf("dynamic interpreter %v is required", strings.TrimRight(string(interp), "\x00")))
+	}
+	libs, err := file.ImportedLibraries()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read needed libraries of %v", fileName)
+	}
+	for _, lib := range libs {
+		problems = append(problems, fmt.Sprintf("shared library %v is needed", lib))
+	}
+	return problems, nil
+}
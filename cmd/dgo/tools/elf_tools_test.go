@@ -0,0 +1,252 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testSection - a section of ELF fixture, sections of SHT_NOBITS type have only size.
+type testSection struct {
+	name string
+	typ  elf.SectionType
+	data []byte
+	size uint64
+}
+
+// writeTestELF - write a minimal little endian ELF64 executable with passed sections,
+// if interp is passed a PT_INTERP program header is added.
+func writeTestELF(t *testing.T, fileName string, machine elf.Machine, interp string, sections ...testSection) {
+	t.Helper()
+	const headerSize, progSize, sectionSize = 64, 56, 64
+	names := []byte{0}
+	nameOffsets := []uint32{}
+	for _, s := range append(sections, testSection{name: ".shstrtab"}) {
+		nameOffsets = append(nameOffsets, uint32(len(names)))
+		names = append(append(names, s.name...), 0)
+	}
+
+	data := bytes.Buffer{}
+	progs := []elf.Prog64{}
+	offset := uint64(headerSize)
+	if interp != "" {
+		offset += progSize
+		progs = append(progs, elf.Prog64{Type: uint32(elf.PT_INTERP), Flags: uint32(elf.PF_R), Off: offset,
+			Filesz: uint64(len(interp) + 1), Memsz: uint64(len(interp) + 1), Align: 1})
+		data.WriteString(interp)
+		data.WriteByte(0)
+	}
+	headers := []elf.Section64{{}}
+	for i, s := range sections {
+		typ := s.typ
+		if typ == elf.SHT_NULL {
+			typ = elf.SHT_PROGBITS
+		}
+		size := uint64(len(s.data))
+		if typ == elf.SHT_NOBITS {
+			size = s.size
+		}
+		headers = append(headers, elf.Section64{Name: nameOffsets[i], Type: uint32(typ), Flags: uint64(elf.SHF_ALLOC),
+			Off: offset + uint64(data.Len()), Size: size, Addralign: 1})
+		data.Write(s.data)
+	}
+	headers = append(headers, elf.Section64{Name: nameOffsets[len(sections)], Type: uint32(elf.SHT_STRTAB),
+		Off: offset + uint64(data.Len()), Size: uint64(len(names)), Addralign: 1})
+	data.Write(names)
+
+	header := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     offset + uint64(data.Len()),
+		Ehsize:    headerSize,
+		Phentsize: progSize,
+		Phnum:     uint16(len(progs)),
+		Shentsize: sectionSize,
+		Shnum:     uint16(len(headers)),
+		Shstrndx:  uint16(len(headers) - 1),
+	}
+	if len(progs) > 0 {
+		header.Phoff = headerSize
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	content := bytes.Buffer{}
+	for _, v := range []interface{}{header, progs, data.Bytes(), headers} {
+		if err := binary.Write(&content, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(fileName, content.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompareSections(t *testing.T) {
+	text := testSection{name: ".text", data: []byte{0x90, 0x90, 0xc3}}
+	buildInfo := testSection{name: ".go.buildinfo", data: []byte("\xff Go buildinf:go1.20")}
+	bss := testSection{name: ".bss", typ: elf.SHT_NOBITS, size: 16}
+	tests := []struct {
+		name     string
+		machine  elf.Machine
+		sections []testSection
+		want     []SectionDiff
+	}{
+		{
+			name:     "identical",
+			machine:  elf.EM_X86_64,
+			sections: []testSection{text, buildInfo, bss},
+			want:     []SectionDiff{},
+		},
+		{
+			name:    "different text",
+			machine: elf.EM_X86_64,
+			sections: []testSection{
+				{name: ".text", data: []byte{0x90, 0xcc, 0xc3}}, buildInfo, bss,
+			},
+			want: []SectionDiff{{Name: ".text", Size: 3, OtherSize: 3, Offset: 1}},
+		},
+		{
+			name:    "different buildinfo size and bss",
+			machine: elf.EM_X86_64,
+			sections: []testSection{
+				text, {name: ".go.buildinfo", data: []byte("\xff Go buildinf:go1.20.1")}, {name: ".bss", typ: elf.SHT_NOBITS, size: 32},
+			},
+			want: []SectionDiff{
+				{Name: ".bss", Size: 16, OtherSize: 32, Offset: -1},
+				{Name: ".go.buildinfo", Size: 20, OtherSize: 22, Offset: -1},
+			},
+		},
+		{
+			name:     "missing section",
+			machine:  elf.EM_X86_64,
+			sections: []testSection{text, bss},
+			want: []SectionDiff{
+				{Name: ".go.buildinfo", Size: 20, OtherSize: -1, Offset: -1},
+				{Name: ".shstrtab", Size: 36, OtherSize: 22, Offset: 8},
+			},
+		},
+		{
+			name:     "different header",
+			machine:  elf.EM_AARCH64,
+			sections: []testSection{text, buildInfo, bss},
+			want:     []SectionDiff{{Name: "(ELF header)", Size: -1, OtherSize: -1, Offset: -1}},
+		},
+	}
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app")
+	writeTestELF(t, fileName, elf.EM_X86_64, "", text, buildInfo, bss)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			otherFileName := filepath.Join(dir, "rebuilt")
+			writeTestELF(t, otherFileName, tt.machine, "", tt.sections...)
+			diffs, err := CompareSections(fileName, otherFileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []SectionDiff{}
+			for _, d := range diffs {
+				got = append(got, *d)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CompareSections() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "script"), []byte("#!/bin/sh\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompareSections(fileName, filepath.Join(dir, "script")); err == nil {
+		t.Error("expected an error for not ELF file")
+	}
+}
+
+func TestCheckELF(t *testing.T) {
+	dir := t.TempDir()
+	text := testSection{name: ".text", data: []byte{0xc3}}
+	tests := []struct {
+		name     string
+		machine  elf.Machine
+		interp   string
+		goarch   string
+		static   bool
+		problems int
+	}{
+		{name: "static binary", machine: elf.EM_X86_64, goarch: "amd64", static: true},
+		{name: "arm64 binary", machine: elf.EM_AARCH64, goarch: "arm64", static: true},
+		{name: "wrong goarch", machine: elf.EM_X86_64, goarch: "arm64", static: true, problems: 1},
+		{name: "dynamic binary", machine: elf.EM_X86_64, interp: "/lib64/ld-linux-x86-64.so.2", goarch: "amd64", static: true, problems: 1},
+		{name: "dynamic binary with cgo", machine: elf.EM_X86_64, interp: "/lib64/ld-linux-x86-64.so.2", goarch: "amd64"},
+		{name: "unknown goarch", machine: elf.EM_X86_64, goarch: "wasm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(dir, "app")
+			writeTestELF(t, fileName, tt.machine, tt.interp, text)
+			problems, err := CheckELF(fileName, tt.goarch, tt.static)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) != tt.problems {
+				t.Errorf("CheckELF() = %q, want %v problems", problems, tt.problems)
+			}
+			if tt.interp != "" && tt.problems > 0 && !strings.Contains(problems[0], tt.interp) {
+				t.Errorf("expected interpreter %v to be reported, got %q", tt.interp, problems)
+			}
+		})
+	}
+
+	// Binaries of other formats are not checked.
+	fileName := filepath.Join(dir, "app.exe")
+	if err := os.WriteFile(fileName, []byte("MZ"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := CheckELF(fileName, "amd64", true); err != nil || len(problems) != 0 {
+		t.Errorf("CheckELF() of not ELF file = %q, %v", problems, err)
+	}
+}
+
+func TestGoarchELF(t *testing.T) {
+	for goarch, arch := range goarchELF {
+		is64 := strings.HasSuffix(goarch, "64") || goarch == "s390x" || goarch == "ppc64le" || goarch == "mips64le"
+		if want := map[bool]elf.Class{true: elf.ELFCLASS64, false: elf.ELFCLASS32}[is64]; arch.class != want {
+			t.Errorf("goarchELF[%v] class = %v, want %v", goarch, arch.class, want)
+		}
+	}
+	if arch := goarchELF[runtime.GOARCH]; runtime.GOOS == "linux" && arch.machine != elf.EM_NONE {
+		executable, err := os.Executable()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Test binary itself is built for GOARCH.
+		if problems, err := CheckELF(executable, runtime.GOARCH, false); err != nil || len(problems) != 0 {
+			t.Errorf("CheckELF() of test binary = %q, %v", problems, err)
+		}
+	}
+}
@@ -17,7 +17,9 @@ package tools
 
 import (
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"strings"
 )
 
 // RetrieveGoEnv - return environment strings based on go parameters.
@@ -30,3 +32,43 @@ func RetrieveGoEnv(cgoEnabled bool, goos, goarch string) (env []string, cgoEnv [
 	env = append(env, fmt.Sprintf("GOOS=%s", goos), fmt.Sprintf("GOARCH=%s", goarch))
 	return
 }
+
+// Platform - a target operating system and architecture pair.
+type Platform struct {
+	OS   string
+	Arch string
+}
+
+// String - return platform in docker notation, like linux/amd64.
+func (p Platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
+// Dir - return a folder name used to store platform specific artifacts, like linux_amd64.
+func (p Platform) Dir() string {
+	return p.OS + "_" + p.Arch
+}
+
+// ParsePlatforms - parse a list of os/arch values, every value could also be a comma separated list.
+func ParsePlatforms(values []string) ([]Platform, error) {
+	result := []Platform{}
+	seen := map[Platform]bool{}
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			if len(v) == 0 {
+				continue
+			}
+			parts := strings.Split(v, "/")
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, errors.Errorf("invalid platform %q, expected os/arch", v)
+			}
+			p := Platform{OS: parts[0], Arch: parts[1]}
+			if !seen[p] {
+				seen[p] = true
+				result = append(result, p)
+			}
+		}
+	}
+	return result, nil
+}
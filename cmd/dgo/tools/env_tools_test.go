@@ -0,0 +1,66 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePlatforms(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []Platform
+		wantErr bool
+	}{
+		{name: "empty", values: nil, want: []Platform{}},
+		{name: "single", values: []string{"linux/amd64"}, want: []Platform{{OS: "linux", Arch: "amd64"}}},
+		{
+			name:   "comma separated with spaces",
+			values: []string{"linux/amd64, linux/arm64"},
+			want:   []Platform{{OS: "linux", Arch: "amd64"}, {OS: "linux", Arch: "arm64"}},
+		},
+		{
+			name:   "duplicates across values are dropped",
+			values: []string{"linux/amd64", "linux/arm64,linux/amd64"},
+			want:   []Platform{{OS: "linux", Arch: "amd64"}, {OS: "linux", Arch: "arm64"}},
+		},
+		{name: "empty items are skipped", values: []string{",linux/amd64,,"}, want: []Platform{{OS: "linux", Arch: "amd64"}}},
+		{name: "missing arch", values: []string{"linux"}, wantErr: true},
+		{name: "empty arch", values: []string{"linux/"}, wantErr: true},
+		{name: "variant is not supported", values: []string{"linux/arm/v7"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePlatforms(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePlatforms(%q) error = %v, wantErr %v", tt.values, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePlatforms(%q) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlatformDir(t *testing.T) {
+	p := Platform{OS: "linux", Arch: "arm64"}
+	if p.String() != "linux/arm64" || p.Dir() != "linux_arm64" {
+		t.Errorf("unexpected platform names %v %v", p.String(), p.Dir())
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 )
 
 //wrapper - A simple process wrapper
@@ -37,25 +38,41 @@ type wrapper struct {
 
 // ExecRead - execute command and return output as result, stderr is ignored.
 func ExecRead(ctx context.Context, dir string, args, env []string, showOut bool) ([]string, error) {
-	var err error
+	output, errOutput, err := execRead(ctx, dir, args, env, showOut)
+	if err != nil {
+		return append(output, errOutput...), err
+	}
+	return output, nil
+}
+
+// ExecReadAll - execute command and return output followed by stderr as result, stderr is returned even if command
+// succeeds, like compiler warnings.
+func ExecReadAll(ctx context.Context, dir string, args, env []string, showOut bool) ([]string, error) {
+	output, errOutput, err := execRead(ctx, dir, args, env, showOut)
+	return append(output, errOutput...), err
+}
+
+func execRead(ctx context.Context, dir string, args, env []string, showOut bool) (output, errOutput []string, err error) {
 	if dir == "" {
 		dir, err = os.Getwd()
 		if err != nil {
 			logrus.Errorf("Failed to receive current dir %v", err)
-			return nil, err
+			return nil, nil, err
 		}
 	}
 	var proc *wrapper
 	proc, err = execProc(ctx, dir, args, env)
 	if err != nil && proc == nil {
-		return nil, err
+		return nil, nil, err
 	}
-	output := []string{}
-	errOutput := []string{}
+	output = []string{}
+	errOutput = []string{}
 	reader := bufio.NewReader(proc.Stdout)
 	errReader := bufio.NewReader(proc.Stderr)
 
+	errDone := make(chan struct{})
 	go func() {
+		defer close(errDone)
 		for {
 			s, err := errReader.ReadString('\n')
 			if err != nil {
@@ -78,11 +95,8 @@ func ExecRead(ctx context.Context, dir string, args, env []string, showOut bool)
 		}
 		output = append(output, strings.TrimSpace(s))
 	}
-	err = proc.Cmd.Wait()
-	if err != nil {
-		return append(output, errOutput...), err
-	}
-	return output, nil
+	<-errDone
+	return output, errOutput, proc.Cmd.Wait()
 }
 
 // Exec - execute shell command
@@ -96,6 +110,37 @@ func Exec(ctx context.Context, dir string, args, env []string) error {
 	return err
 }
 
+// ExecLines - execute command and pass every line of stdout and stderr to onLine as soon as it is printed,
+// onLine is never called concurrently.
+func ExecLines(ctx context.Context, dir string, args, env []string, onLine func(line string)) error {
+	p, err := execProc(ctx, dir, args, env)
+	if err != nil {
+		return err
+	}
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, r := range []io.Reader{p.Stdout, p.Stderr} {
+		reader := bufio.NewReader(r)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				s, err := reader.ReadString('\n')
+				if s != "" {
+					lock.Lock()
+					onLine(strings.TrimRight(s, "\r\n"))
+					lock.Unlock()
+				}
+				if err != nil {
+					break
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return p.Cmd.Wait()
+}
+
 func printCmdOutput(p *wrapper, args []string) {
 	reader := bufio.NewReader(p.Stdout)
 	errReader := bufio.NewReader(p.Stderr)
@@ -0,0 +1,72 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestExecRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		read    []string
+		readAll []string
+		wantErr bool
+	}{
+		{
+			name:    "stdout",
+			script:  "echo out",
+			read:    []string{"out"},
+			readAll: []string{"out"},
+		},
+		{
+			name:    "stderr of succeeded command",
+			script:  "echo out; echo warning >&2",
+			read:    []string{"out"},
+			readAll: []string{"out", "warning"},
+		},
+		{
+			name:    "stderr of failed command",
+			script:  "echo out; echo error >&2; exit 1",
+			read:    []string{"out", "error"},
+			readAll: []string{"out", "error"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []string{"sh", "-c", tt.script}
+			output, err := ExecRead(context.Background(), "", args, nil, false)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExecRead() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(output, tt.read) {
+				t.Errorf("ExecRead() = %q, want %q", output, tt.read)
+			}
+			output, err = ExecReadAll(context.Background(), "", args, nil, false)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExecReadAll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(output, tt.readAll) {
+				t.Errorf("ExecReadAll() = %q, want %q", output, tt.readAll)
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FakeImage - an image built by fake docker engine.
+type FakeImage struct {
+	ID        string
+	Target    string
+	Tags      []string
+	BuildArgs map[string]string
+	Labels    map[string]string
+	// Files - names of files sent with build context.
+	Files []string
+}
+
+// FakeContainer - a container created by fake docker engine.
+type FakeContainer struct {
+	ID         string
+	Image      string
+	Cmd        []string
+	Env        []string
+	Labels     map[string]string
+	Ports      map[string]string
+	Binds      []string
+	AutoRemove bool
+	State      string
+	ExitCode   int
+	Stdout     string
+	Stderr     string
+
+	done chan struct{}
+}
+
+// FakeRunFunc - emulate container execution, return container output and exit code.
+type FakeRunFunc func(c *FakeContainer) (stdout, stderr string, exitCode int)
+
+// FakeDockerEngine - an in memory docker engine API server listening on unix socket, to be used in tests
+// with DockerClient. It supports image build, container create/start/attach/wait/kill/remove and list.
+type FakeDockerEngine struct {
+	Socket string
+	// Run - emulate container execution, by default container exits with 0 without output.
+	Run FakeRunFunc
+
+	lock       sync.Mutex
+	listener   net.Listener
+	server     *http.Server
+	images     map[string]*FakeImage
+	containers map[string]*FakeContainer
+	counter    int
+}
+
+// NewFakeDockerEngine - start a fake docker engine on passed unix socket path.
+func NewFakeDockerEngine(socket string) (*FakeDockerEngine, error) {
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	e := &FakeDockerEngine{
+		Socket:     socket,
+		listener:   listener,
+		images:     map[string]*FakeImage{},
+		containers: map[string]*FakeContainer{},
+	}
+	e.server = &http.Server{Handler: http.HandlerFunc(e.handle)}
+	go func() { _ = e.server.Serve(listener) }()
+	return e, nil
+}
+
+// Close - stop fake docker engine and remove its socket.
+func (e *FakeDockerEngine) Close() error {
+	err := e.server.Close()
+	_ = os.Remove(e.Socket)
+	return err
+}
+
+// Images - return all built images.
+func (e *FakeDockerEngine) Images() []*FakeImage {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	result := []*FakeImage{}
+	for _, img := range e.images {
+		result = append(result, img)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Containers - return all not removed containers.
+func (e *FakeDockerEngine) Containers() []*FakeContainer {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	result := []*FakeContainer{}
+	for _, c := range e.containers {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// AddContainer - register a running container, like one left from previous run.
+func (e *FakeDockerEngine) AddContainer(image string, labels map[string]string) *FakeContainer {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	c := &FakeContainer{ID: e.nextID(), Image: image, Labels: labels, State: "running", done: make(chan struct{})}
+	e.containers[c.ID] = c
+	return c
+}
+
+func (e *FakeDockerEngine) nextID() string {
+	e.counter++
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprint(e.counter))))
+}
+
+func (e *FakeDockerEngine) handle(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	// Skip API version prefix, like /v1.40/containers/json
+	if len(parts) > 0 && strings.HasPrefix(parts[0], "v1.") {
+		parts = parts[1:]
+	}
+	switch {
+	case len(parts) == 1 && parts[0] == "_ping":
+		_, _ = w.Write([]byte("OK"))
+	case len(parts) == 1 && parts[0] == "build" && r.Method == http.MethodPost:
+		e.build(w, r)
+	case len(parts) == 2 && parts[0] == "containers" && parts[1] == "json":
+		e.list(w, r)
+	case len(parts) == 2 && parts[0] == "containers" && parts[1] == "create" && r.Method == http.MethodPost:
+		e.create(w, r)
+	case len(parts) == 2 && parts[0] == "containers" && r.Method == http.MethodDelete:
+		e.remove(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "containers" && r.Method == http.MethodPost:
+		c := e.container(parts[1])
+		if c == nil {
+			fakeError(w, http.StatusNotFound, "No such container: "+parts[1])
+			return
+		}
+		switch parts[2] {
+		case "start":
+			e.start(w, c)
+		case "attach":
+			e.attach(w, c)
+		case "wait":
+			e.wait(w, r, c)
+		case "kill":
+			e.kill(w, c)
+		default:
+			fakeError(w, http.StatusNotFound, "page not found")
+		}
+	default:
+		fakeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func fakeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func (e *FakeDockerEngine) container(id string) *FakeContainer {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.containers[id]
+}
+
+func (e *FakeDockerEngine) build(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	img := &FakeImage{Target: query.Get("target"), Tags: query["t"]}
+	for name, value := range map[string]*map[string]string{"buildargs": &img.BuildArgs, "labels": &img.Labels} {
+		if content := query.Get(name); content != "" {
+			if err := json.Unmarshal([]byte(content), value); err != nil {
+				fakeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+	reader := tar.NewReader(r.Body)
+	hash := sha256.New()
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		img.Files = append(img.Files, header.Name)
+		_, _ = hash.Write([]byte(header.Name))
+		_, _ = io.Copy(hash, reader)
+	}
+	img.ID = fmt.Sprintf("sha256:%x", hash.Sum(nil))
+
+	e.lock.Lock()
+	e.images[img.ID] = img
+	e.lock.Unlock()
+
+	encoder := json.NewEncoder(w)
+	_ = encoder.Encode(map[string]string{"stream": "Step 1/1 : FROM scratch\n"})
+	_ = encoder.Encode(map[string]interface{}{"aux": map[string]string{"ID": img.ID}})
+	_ = encoder.Encode(map[string]string{"stream": fmt.Sprintf("Successfully built %s\n", img.ID[len("sha256:"):][:12])})
+}
+
+func (e *FakeDockerEngine) list(w http.ResponseWriter, r *http.Request) {
+	filters := map[string][]string{}
+	if content := r.URL.Query().Get("filters"); content != "" {
+		if err := json.Unmarshal([]byte(content), &filters); err != nil {
+			fakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	result := []*Container{}
+	for _, c := range e.Containers() {
+		if c.State != "running" || !matchLabels(c.Labels, filters["label"]) {
+			continue
+		}
+		result = append(result, &Container{ID: c.ID, Image: c.Image, Names: []string{"/" + c.ID[:12]}, State: c.State, Labels: c.Labels})
+	}
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func matchLabels(labels map[string]string, filters []string) bool {
+	for _, f := range filters {
+		kv := strings.SplitN(f, "=", 2)
+		value, ok := labels[kv[0]]
+		if !ok || (len(kv) == 2 && value != kv[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *FakeDockerEngine) create(w http.ResponseWriter, r *http.Request) {
+	request := &struct {
+		Image      string
+		Cmd        []string
+		Env        []string
+		Labels     map[string]string
+		HostConfig struct {
+			AutoRemove   bool
+			PortBindings map[string][]struct{ HostPort string }
+			Binds        []string
+		}
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		fakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if _, ok := e.images[request.Image]; !ok {
+		fakeError(w, http.StatusNotFound, "No such image: "+request.Image)
+		return
+	}
+	c := &FakeContainer{
+		ID:         e.nextID(),
+		Image:      request.Image,
+		Cmd:        request.Cmd,
+		Env:        request.Env,
+		Labels:     request.Labels,
+		Ports:      map[string]string{},
+		Binds:      request.HostConfig.Binds,
+		AutoRemove: request.HostConfig.AutoRemove,
+		State:      "created",
+		done:       make(chan struct{}),
+	}
+	for port, bindings := range request.HostConfig.PortBindings {
+		for _, b := range bindings {
+			c.Ports[b.HostPort] = port
+		}
+	}
+	e.containers[c.ID] = c
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]string{"Id": c.ID})
+}
+
+func (e *FakeDockerEngine) start(w http.ResponseWriter, c *FakeContainer) {
+	e.lock.Lock()
+	if c.State != "created" {
+		e.lock.Unlock()
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	c.State = "running"
+	e.lock.Unlock()
+	go func() {
+		stdout, stderr, code := "", "", 0
+		if e.Run != nil {
+			stdout, stderr, code = e.Run(c)
+		}
+		e.exit(c, stdout, stderr, code)
+	}()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *FakeDockerEngine) exit(c *FakeContainer, stdout, stderr string, code int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if c.State == "exited" {
+		return
+	}
+	c.State, c.Stdout, c.Stderr, c.ExitCode = "exited", stdout, stderr, code
+	close(c.done)
+}
+
+func (e *FakeDockerEngine) attach(w http.ResponseWriter, c *FakeContainer) {
+	w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	<-c.done
+	for stream, data := range [][]byte{1: []byte(c.Stdout), 2: []byte(c.Stderr)} {
+		if len(data) == 0 {
+			continue
+		}
+		header := make([]byte, 8)
+		header[0] = byte(stream)
+		binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+		_, _ = w.Write(append(header, data...))
+	}
+}
+
+func (e *FakeDockerEngine) wait(w http.ResponseWriter, r *http.Request, c *FakeContainer) {
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	select {
+	case <-c.done:
+	case <-r.Context().Done():
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"StatusCode": c.ExitCode})
+	if c.AutoRemove {
+		e.lock.Lock()
+		delete(e.containers, c.ID)
+		e.lock.Unlock()
+	}
+}
+
+func (e *FakeDockerEngine) kill(w http.ResponseWriter, c *FakeContainer) {
+	e.lock.Lock()
+	running := c.State == "running"
+	e.lock.Unlock()
+	if !running {
+		fakeError(w, http.StatusConflict, fmt.Sprintf("Container %s is not running", c.ID))
+		return
+	}
+	e.exit(c, "", "", 137)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *FakeDockerEngine) remove(w http.ResponseWriter, r *http.Request, id string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	c, ok := e.containers[id]
+	if !ok {
+		fakeError(w, http.StatusNotFound, "No such container: "+id)
+		return
+	}
+	if c.State == "running" && r.URL.Query().Get("force") == "" {
+		fakeError(w, http.StatusConflict, fmt.Sprintf("You cannot remove a running container %s", id))
+		return
+	}
+	if c.State != "exited" {
+		c.State = "exited"
+		c.ExitCode = 137
+		close(c.done)
+	}
+	delete(e.containers, id)
+	w.WriteHeader(http.StatusNoContent)
+}
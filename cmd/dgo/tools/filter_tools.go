@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+// RegexpPatternPrefix - a prefix of pattern to be used as regular expression instead of glob.
+const RegexpPatternPrefix = "re:"
+
+// NameFilter - select names by include and exclude patterns. A pattern is a glob, where * matches any characters
+// except /, ** matches any characters and ? matches one character, or a regular expression prefixed with re:.
+// Globs should match a whole name, regular expressions could match any part of it.
+type NameFilter struct {
+	includes []*regexp.Regexp
+	excludes []*regexp.Regexp
+}
+
+// NewNameFilter - construct a filter, if there are no include patterns, all names not excluded are selected.
+func NewNameFilter(includes, excludes []string) (*NameFilter, error) {
+	f := &NameFilter{}
+	var err error
+	if f.includes, err = compilePatterns(includes); err != nil {
+		return nil, err
+	}
+	if f.excludes, err = compilePatterns(excludes); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// IsEmpty - tells if filter has no patterns and selects everything.
+func (f *NameFilter) IsEmpty() bool {
+	return f == nil || len(f.includes) == 0 && len(f.excludes) == 0
+}
+
+// Match - tells if one of names, like a name and a path of same item, is included and none of them is excluded.
+func (f *NameFilter) Match(names ...string) bool {
+	if f.IsEmpty() {
+		return true
+	}
+	included := len(f.includes) == 0
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		for _, r := range f.excludes {
+			if r.MatchString(name) {
+				return false
+			}
+		}
+		for _, r := range f.includes {
+			if r.MatchString(name) {
+				included = true
+			}
+		}
+	}
+	return included
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	result := []*regexp.Regexp{}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		expr := GlobExpr(p)
+		if strings.HasPrefix(p, RegexpPatternPrefix) {
+			expr = strings.TrimPrefix(p, RegexpPatternPrefix)
+		}
+		r, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern %q", p)
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// GlobExpr - convert a slash separated glob into a regular expression matching a whole value, * matches any
+// characters except /, ** matches any characters and **/ matches any number of folders including none.
+func GlobExpr(pattern string) string {
+	expr := strings.Builder{}
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					expr.WriteString("(.*/)?")
+				} else {
+					expr.WriteString(".*")
+				}
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	expr.WriteString("$")
+	return expr.String()
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGlobExpr(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []string
+		noMatch []string
+	}{
+		{pattern: "app", match: []string{"app"}, noMatch: []string{"app2", "my-app", "cmd/app"}},
+		{pattern: "cmd/*", match: []string{"cmd/app", "cmd/"}, noMatch: []string{"cmd/app/sub", "cmd", "x/cmd/app"}},
+		{pattern: "*-gen", match: []string{"api-gen", "-gen"}, noMatch: []string{"cmd/api-gen", "api-gen2"}},
+		{pattern: "examples/**", match: []string{"examples/a", "examples/a/b", "examples/"}, noMatch: []string{"examples"}},
+		{pattern: "**/internal/**", match: []string{"example.com/app/internal/x", "internal/x"}, noMatch: []string{"example.com/app/internalx/y"}},
+		{pattern: "**", match: []string{"", "a", "a/b"}},
+		{pattern: "app?", match: []string{"app1", "appx"}, noMatch: []string{"app", "app/", "app12"}},
+		{pattern: "a.b+c", match: []string{"a.b+c"}, noMatch: []string{"axb+c", "a.bbc"}},
+	}
+	for _, tt := range tests {
+		r := regexp.MustCompile(GlobExpr(tt.pattern))
+		for _, name := range tt.match {
+			if !r.MatchString(name) {
+				t.Errorf("GlobExpr(%q) = %v should match %q", tt.pattern, r, name)
+			}
+		}
+		for _, name := range tt.noMatch {
+			if r.MatchString(name) {
+				t.Errorf("GlobExpr(%q) = %v should not match %q", tt.pattern, r, name)
+			}
+		}
+	}
+}
+
+func TestNameFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		includes []string
+		excludes []string
+		empty    bool
+		match    [][]string
+		noMatch  [][]string
+	}{
+		{
+			name:     "empty",
+			includes: []string{"", " "},
+			empty:    true,
+			match:    [][]string{{"app"}, {}},
+		},
+		{
+			name:     "include by name or folder",
+			includes: []string{"cmd/*"},
+			match:    [][]string{{"app", "cmd/app"}, {"cmd/app"}},
+			noMatch:  [][]string{{"app"}, {"app", "tools/app"}, {"app", ""}},
+		},
+		{
+			name:     "exclude",
+			excludes: []string{"re:-gen$"},
+			match:    [][]string{{"app", "cmd/app"}},
+			noMatch:  [][]string{{"api-gen", "cmd/api-gen"}, {"app", "cmd/x-gen"}},
+		},
+		{
+			name:     "exclude wins",
+			includes: []string{"cmd/**"},
+			excludes: []string{"**/internal/**"},
+			match:    [][]string{{"cmd/app"}},
+			noMatch:  [][]string{{"cmd/internal/app"}},
+		},
+		{
+			name:     "regexp matches any part",
+			includes: []string{"re:server"},
+			match:    [][]string{{"my-server-app"}},
+			noMatch:  [][]string{{"client"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewNameFilter(tt.includes, tt.excludes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.IsEmpty() != tt.empty {
+				t.Errorf("IsEmpty() = %v, want %v", f.IsEmpty(), tt.empty)
+			}
+			for _, names := range tt.match {
+				if !f.Match(names...) {
+					t.Errorf("Match(%q) = false, want true", names)
+				}
+			}
+			for _, names := range tt.noMatch {
+				if f.Match(names...) {
+					t.Errorf("Match(%q) = true, want false", names)
+				}
+			}
+		})
+	}
+	if _, err := NewNameFilter([]string{"re:("}, nil); err == nil {
+		t.Error("invalid regular expression is expected to fail")
+	}
+	if !(*NameFilter)(nil).Match("app") {
+		t.Error("nil filter is expected to select everything")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SourceDateEpochEnv - a standard variable with unix time used as build time by reproducible builds.
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// GitCommit - return a commit sha of HEAD, or empty string if dir is not inside git repository.
+func GitCommit(ctx context.Context, dir string) string {
+	lines, err := ExecRead(ctx, dir, []string{"git", "rev-parse", "HEAD"}, nil, false)
+	if err != nil || len(lines) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(lines[0])
+}
+
+// VersionInfo - a version information of sources, used to stamp binaries.
+type VersionInfo struct {
+	// Version - an output of git describe --tags --always --dirty
+	Version string
+	// Commit - a commit sha of HEAD
+	Commit string
+	// Dirty - true if working tree has uncommitted changes
+	Dirty bool
+	// BuildTime - a build time in RFC3339 format
+	BuildTime string
+}
+
+// GitVersionInfo - return a version information of sources inside dir, if dir is not inside git repository
+// version will be "unknown".
+func GitVersionInfo(ctx context.Context, dir string, buildTime time.Time) *VersionInfo {
+	info := &VersionInfo{
+		Version:   "unknown",
+		Commit:    GitCommit(ctx, dir),
+		BuildTime: buildTime.UTC().Format(time.RFC3339),
+	}
+	if lines, err := ExecRead(ctx, dir, []string{"git", "describe", "--tags", "--always", "--dirty"}, nil, false); err == nil && len(lines) > 0 {
+		info.Version = strings.TrimSpace(lines[0])
+	}
+	if lines, err := ExecRead(ctx, dir, []string{"git", "status", "--porcelain", "--untracked-files=no"}, nil, false); err == nil {
+		for _, l := range lines {
+			if strings.TrimSpace(l) != "" {
+				info.Dirty = true
+				break
+			}
+		}
+	}
+	return info
+}
+
+// SourceDateEpoch - return a time passed with SOURCE_DATE_EPOCH, or a time of HEAD commit if variable is not set.
+func SourceDateEpoch(ctx context.Context, dir string) (time.Time, error) {
+	value := strings.TrimSpace(os.Getenv(SourceDateEpochEnv))
+	if value == "" {
+		lines, err := ExecRead(ctx, dir, []string{"git", "log", "-1", "--format=%ct"}, nil, false)
+		if err != nil || len(lines) == 0 {
+			return time.Time{}, errors.Errorf("%v is not set and time of HEAD commit is not available: %v", SourceDateEpochEnv, err)
+		}
+		value = strings.TrimSpace(lines[0])
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "invalid %v=%v", SourceDateEpochEnv, value)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// GitChangedFiles - return absolute paths of files changed since git ref, including uncommitted and untracked files.
+func GitChangedFiles(ctx context.Context, dir, since string) ([]string, error) {
+	lines, err := ExecRead(ctx, dir, []string{"git", "rev-parse", "--show-toplevel"}, nil, false)
+	if err != nil || len(lines) == 0 {
+		return nil, errors.Wrapf(err, "failed to find git repository root: %v", strings.Join(lines, "\n"))
+	}
+	root := strings.TrimSpace(lines[0])
+	files := map[string]bool{}
+	for _, gitCmd := range [][]string{
+		{"git", "diff", "--name-only", since, "--"},
+		{"git", "ls-files", "--others", "--exclude-standard", "--full-name"},
+	} {
+		lines, err = ExecRead(ctx, root, gitCmd, nil, false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find changed files since %v: %v", since, strings.Join(lines, "\n"))
+		}
+		for _, l := range lines {
+			if l = strings.TrimSpace(l); l != "" {
+				files[filepath.Join(root, filepath.FromSlash(l))] = true
+			}
+		}
+	}
+	result := []string{}
+	for f := range files {
+		result = append(result, f)
+	}
+	sort.Strings(result)
+	return result, nil
+}
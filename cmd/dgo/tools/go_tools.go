@@ -19,10 +19,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"path"
 	"regexp"
 	"strings"
+	"text/template"
 	"time"
 )
 
@@ -50,31 +52,52 @@ func FindMainPackages(ctx context.Context, root string, env []string) []string {
 	return roots
 }
 
-func relativePath(rootDir, pkgName string) string {
-	names := []string{}
-	pkg := pkgName
-	for {
-		if strings.HasSuffix(rootDir, pkg) {
-			return ""
-		}
-		var part string
-		pkg, part = path.Split(pkg)
-		pkg = path.Clean(pkg)
-		names = append([]string{part}, names...)
-		if strings.HasSuffix(rootDir, pkg) {
-			break
-		}
-		if pkg == "" {
-			break
-		}
+// ImportPath - return an import path of package located in dir.
+func ImportPath(ctx context.Context, dir string, env []string) (string, error) {
+	lines, err := ExecRead(ctx, dir, []string{"go", "list", "-f", "{{.ImportPath}}", "."}, env, false)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve import path of %v: %v", dir, strings.Join(lines, "\n"))
+	}
+	if len(lines) == 0 {
+		return "", errors.Errorf("failed to resolve import path of %v", dir)
 	}
-	return strings.Join(names, "/")
+	return strings.TrimSpace(lines[0]), nil
+}
+
+// GoVersion - return a version of go compiler, like go1.14.2
+func GoVersion(ctx context.Context, dir string) string {
+	lines, err := ExecRead(ctx, dir, []string{"go", "version"}, nil, false)
+	if err != nil || len(lines) == 0 {
+		return ""
+	}
+	// go version go1.14.2 linux/amd64
+	parts := strings.Fields(lines[0])
+	if len(parts) < 3 {
+		return lines[0]
+	}
+	return parts[2]
+}
+
+// relativePath - return a path of package relative to root package, like "pkg/api" for
+// root "example.com/app" and package "example.com/app/pkg/api".
+func relativePath(rootImportPath, pkgName string) string {
+	if pkgName == rootImportPath {
+		return ""
+	}
+	if strings.HasPrefix(pkgName, rootImportPath+"/") {
+		return pkgName[len(rootImportPath)+1:]
+	}
+	// Package is outside of root, use its full import path.
+	return pkgName
 }
 
 type PackageInfo struct {
 	RelPath string
+	Package string
 	Tests   []string
 	OutName string
+	// AppFolder - a folder of application relative to folder build is started in, empty if it is not known.
+	AppFolder string
 }
 
 type TestEvent struct {
@@ -88,6 +111,22 @@ type TestEvent struct {
 
 var alphaReg, _ = regexp.Compile("[^A-Za-z0-9]+")
 
+// SafeName - replace all non alphanumeric characters with -, so value could be used as a file name.
+func SafeName(value string) string {
+	return strings.Trim(alphaReg.ReplaceAllString(value, "-"), "-")
+}
+
+// IsTestName - check if name listed by -test.list is a top level function selected by -test.run, so Test, Example and
+// Fuzz functions are included, but benchmarks and go test summary lines are not.
+func IsTestName(name string) bool {
+	for _, prefix := range []string{"Test", "Example", "Fuzz"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func FindTests(ctx context.Context, rootDir string, env []string) (map[string]*PackageInfo, error) {
 	logrus.Infof("Find Tests in %v", rootDir)
 	testPackages := map[string]*PackageInfo{}
@@ -101,6 +140,10 @@ func FindTests(ctx context.Context, rootDir string, env []string) (map[string]*P
 	}
 
 	_, cmdName := path.Split(path.Clean(rootDir))
+	rootImportPath := ""
+	if importLines, err := ExecRead(ctx, rootDir, []string{"go", "list", "-e", "-f", "{{.ImportPath}}", "."}, env, false); err == nil && len(importLines) > 0 {
+		rootImportPath = strings.TrimSpace(importLines[0])
+	}
 
 	for _, line := range lines {
 		trimLine := strings.TrimSpace(line)
@@ -115,13 +158,14 @@ func FindTests(ctx context.Context, rootDir string, env []string) (map[string]*P
 		}
 		pkgInfo, ok := testPackages[event.Package]
 		if !ok {
-			relPath := relativePath(rootDir, event.Package)
+			relPath := relativePath(rootImportPath, event.Package)
 			outName := fmt.Sprintf("%s-%s.test", cmdName, alphaReg.ReplaceAllString(relPath, "-"))
 			if len(relPath) == 0 {
 				outName = fmt.Sprintf("%s.test", cmdName)
 			}
 			pkgInfo = &PackageInfo{
 				RelPath: relPath,
+				Package: event.Package,
 				OutName: outName,
 				Tests:   []string{},
 			}
@@ -131,7 +175,7 @@ func FindTests(ctx context.Context, rootDir string, env []string) (map[string]*P
 		switch event.Action {
 		case "output":
 			for _, k := range strings.Split(strings.TrimSpace(event.Output), "\n") {
-				if strings.HasPrefix(k, "Test") {
+				if IsTestName(k) {
 					pkgInfo.Tests = append(pkgInfo.Tests, k)
 				}
 			}
@@ -141,3 +185,86 @@ func FindTests(ctx context.Context, rootDir string, env []string) (map[string]*P
 	}
 	return testPackages, nil
 }
+
+// BuildFlags - go compiler flags applied to every go build and go test -c command.
+type BuildFlags struct {
+	LdFlags  string
+	GcFlags  string
+	Tags     string
+	TrimPath bool
+	// Stamps - a list of importpath.name=template values passed to linker with -X,
+	// templates are executed with VersionInfo, like main.version={{.Version}}
+	Stamps []string
+	// Reproducible - remove file system paths and build id, so same sources produce identical binaries.
+	Reproducible bool
+}
+
+// Args - return go build arguments for flags, stamps are resolved using version info,
+// if info is nil stamps are not applied, which is used for test binaries.
+func (f *BuildFlags) Args(info *VersionInfo) ([]string, error) {
+	return f.args(info, info != nil)
+}
+
+// KeyArgs - return arguments identifying flags in build cache key, stamps are added as templates,
+// so a new commit or build time doesn't invalidate cached binaries when sources are not changed.
+func (f *BuildFlags) KeyArgs() ([]string, error) {
+	return f.args(nil, true)
+}
+
+func (f *BuildFlags) args(info *VersionInfo, stamps bool) ([]string, error) {
+	args := []string{}
+	if f.TrimPath || f.Reproducible {
+		args = append(args, "-trimpath")
+	}
+	if f.Tags != "" {
+		args = append(args, "-tags="+f.Tags)
+	}
+	if f.GcFlags != "" {
+		args = append(args, "-gcflags="+f.GcFlags)
+	}
+	ldFlags := []string{}
+	if f.Reproducible {
+		ldFlags = append(ldFlags, "-buildid=")
+	}
+	if f.LdFlags != "" {
+		ldFlags = append(ldFlags, f.LdFlags)
+	}
+	for _, stamp := range f.Stamps {
+		if !stamps {
+			break
+		}
+		pos := strings.Index(stamp, "=")
+		if pos <= 0 {
+			return nil, errors.Errorf("invalid stamp %q, expected importpath.name=value", stamp)
+		}
+		tmpl, err := template.New(stamp).Parse(stamp[pos+1:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid stamp %q", stamp)
+		}
+		if info == nil {
+			ldFlags = append(ldFlags, "-X", quoteLdFlag(stamp))
+			continue
+		}
+		value := strings.Builder{}
+		if err = tmpl.Execute(&value, info); err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve stamp %q", stamp)
+		}
+		ldFlags = append(ldFlags, "-X", quoteLdFlag(stamp[:pos]+"="+value.String()))
+	}
+	if len(ldFlags) > 0 {
+		args = append(args, "-ldflags="+strings.Join(ldFlags, " "))
+	}
+	return args, nil
+}
+
+// quoteLdFlag - quote a value if it contains spaces or quotes, go tool split -ldflags on spaces and
+// allow single or double quotes around fields without any escaping inside.
+func quoteLdFlag(value string) string {
+	if !strings.ContainsAny(value, " \t'\"") {
+		return value
+	}
+	if !strings.Contains(value, "'") {
+		return "'" + value + "'"
+	}
+	return "\"" + value + "\""
+}
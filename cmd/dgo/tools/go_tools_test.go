@@ -0,0 +1,160 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsTestName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "TestFoo", want: true},
+		{name: "Test", want: true},
+		{name: "ExampleFoo", want: true},
+		{name: "Example_bar", want: true},
+		{name: "FuzzParse", want: true},
+		{name: "BenchmarkFoo", want: false},
+		{name: "ok  \texample.com/app\t0.005s", want: false},
+		{name: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := IsTestName(tt.name); got != tt.want {
+			t.Errorf("IsTestName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteLdFlag(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "main.version=v1.0.0", want: "main.version=v1.0.0"},
+		{value: "", want: ""},
+		{value: "main.name=hello world", want: "'main.name=hello world'"},
+		{value: "main.name=a\tb", want: "'main.name=a\tb'"},
+		{value: "main.name=a\"b", want: "'main.name=a\"b'"},
+		{value: "main.name=it's", want: "\"main.name=it's\""},
+	}
+	for _, tt := range tests {
+		if got := quoteLdFlag(tt.value); got != tt.want {
+			t.Errorf("quoteLdFlag(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBuildFlagsArgs(t *testing.T) {
+	info := &VersionInfo{Version: "v1.2.3-dirty", Commit: "abc", Dirty: true, BuildTime: "2020-01-02T03:04:05Z"}
+	tests := []struct {
+		name    string
+		flags   BuildFlags
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			want: []string{},
+		},
+		{
+			name:  "compiler flags",
+			flags: BuildFlags{TrimPath: true, Tags: "netgo,osusergo", GcFlags: "all=-N -l", LdFlags: "-s -w"},
+			want:  []string{"-trimpath", "-tags=netgo,osusergo", "-gcflags=all=-N -l", "-ldflags=-s -w"},
+		},
+		{
+			name:  "reproducible",
+			flags: BuildFlags{Reproducible: true, LdFlags: "-s"},
+			want:  []string{"-trimpath", "-ldflags=-buildid= -s"},
+		},
+		{
+			name: "stamps",
+			flags: BuildFlags{LdFlags: "-s", Stamps: []string{
+				"main.version={{.Version}}",
+				"main.commit={{.Commit}}{{if .Dirty}}+{{end}}",
+				"main.built=built at {{.BuildTime}}",
+			}},
+			want: []string{"-ldflags=-s -X main.version=v1.2.3-dirty -X main.commit=abc+ " +
+				"-X 'main.built=built at 2020-01-02T03:04:05Z'"},
+		},
+		{
+			name:    "stamp without value",
+			flags:   BuildFlags{Stamps: []string{"main.version"}},
+			wantErr: true,
+		},
+		{
+			name:    "stamp without name",
+			flags:   BuildFlags{Stamps: []string{"=v1"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid template",
+			flags:   BuildFlags{Stamps: []string{"main.version={{.Version"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			flags:   BuildFlags{Stamps: []string{"main.version={{.Unknown}}"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.flags.Args(info)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Args() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildFlagsKeyArgs(t *testing.T) {
+	flags := BuildFlags{LdFlags: "-s", Stamps: []string{"main.version={{.Version}}", "main.built=built at {{.BuildTime}}"}}
+	want := []string{"-ldflags=-s -X main.version={{.Version}} -X 'main.built=built at {{.BuildTime}}'"}
+	got, err := flags.KeyArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("KeyArgs() = %q, want %q", got, want)
+	}
+
+	// Test binaries are compiled without stamps.
+	got, err = flags.Args(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want = []string{"-ldflags=-s"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Args(nil) = %q, want %q", got, want)
+	}
+
+	flags.Stamps = []string{"main.version={{.Version"}
+	if _, err = flags.KeyArgs(); err == nil {
+		t.Error("expected an error for invalid stamp")
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GraphPackage - a package of current module.
+type GraphPackage struct {
+	ImportPath string
+	Name       string
+	Dir        string
+	// HasTests - true if package has any _test.go files.
+	HasTests bool
+}
+
+// PackageGraph - an import graph of module packages including test only imports.
+type PackageGraph struct {
+	// Packages - all packages of main module by import path.
+	Packages map[string]*GraphPackage
+	// importedBy - reverse edges of non test imports.
+	importedBy map[string][]string
+	// testImportedBy - reverse edges of all imports, test variants are merged with their packages.
+	testImportedBy map[string][]string
+}
+
+// LoadPackageGraph - load an import graph of all packages inside dir with go list -deps -test.
+func LoadPackageGraph(ctx context.Context, dir string, env []string) (*PackageGraph, error) {
+	listCmd := []string{"go", "list", "-e", "-deps", "-test", "-json", "./..."}
+	lines, err := ExecRead(ctx, dir, listCmd, env, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list packages: %v", strings.Join(lines, "\n"))
+	}
+	packages, err := decodePackages(lines)
+	if err != nil {
+		return nil, err
+	}
+	return newPackageGraph(packages), nil
+}
+
+// newPackageGraph - build a graph from go list -deps -test output, test variants are merged with their packages.
+func newPackageGraph(packages []*listPackage) *PackageGraph {
+	g := &PackageGraph{
+		Packages:       map[string]*GraphPackage{},
+		importedBy:     map[string][]string{},
+		testImportedBy: map[string][]string{},
+	}
+	dirs := map[string]string{}
+	for _, p := range packages {
+		if p.ForTest == "" {
+			dirs[p.ImportPath] = p.Dir
+		}
+	}
+	ids := map[string]string{}
+	for _, p := range packages {
+		ids[p.ImportPath] = graphID(p, dirs)
+	}
+	for _, p := range packages {
+		if p.Standard || p.Module == nil || !p.Module.Main {
+			continue
+		}
+		id := ids[p.ImportPath]
+		testVariant := id != p.ImportPath
+		if !testVariant {
+			g.Packages[id] = &GraphPackage{
+				ImportPath: id,
+				Name:       p.Name,
+				Dir:        p.Dir,
+				HasTests:   len(p.TestGoFiles)+len(p.XTestGoFiles) > 0,
+			}
+		}
+		for _, imp := range p.Imports {
+			impID, ok := ids[imp]
+			if !ok {
+				impID = trimVariant(imp)
+			}
+			if impID == id {
+				continue
+			}
+			if !testVariant {
+				g.importedBy[impID] = append(g.importedBy[impID], id)
+			}
+			g.testImportedBy[impID] = append(g.testImportedBy[impID], id)
+		}
+	}
+	return g
+}
+
+// Merge - add packages and imports of other graph, like a graph of another module.
+func (g *PackageGraph) Merge(other *PackageGraph) {
+	for id, p := range other.Packages {
+		if _, ok := g.Packages[id]; !ok {
+			g.Packages[id] = p
+		}
+	}
+	for id, edges := range other.importedBy {
+		g.importedBy[id] = append(g.importedBy[id], edges...)
+	}
+	for id, edges := range other.testImportedBy {
+		g.testImportedBy[id] = append(g.testImportedBy[id], edges...)
+	}
+}
+
+// graphID - merge test variants of package with package itself, like "p [p.test]", external
+// test package "p_test [p.test]" and synthesized test main "p.test" are all become "p".
+// Packages with _test or .test suffixes in their paths are kept as is.
+func graphID(p *listPackage, dirs map[string]string) string {
+	importPath := trimVariant(p.ImportPath)
+	if p.ForTest != "" {
+		if importPath == p.ForTest+"_test" && p.Dir == dirs[p.ForTest] {
+			return p.ForTest
+		}
+		return importPath
+	}
+	// Test main is not marked with ForTest, but it imports a test variant of package under test.
+	if pkg := strings.TrimSuffix(importPath, ".test"); pkg != importPath && p.Name == "main" {
+		for _, imp := range p.Imports {
+			if imp == pkg+" ["+importPath+"]" {
+				return pkg
+			}
+		}
+	}
+	return importPath
+}
+
+// trimVariant - remove a test variant suffix, like " [p.test]".
+func trimVariant(importPath string) string {
+	if pos := strings.Index(importPath, " ["); pos != -1 {
+		return importPath[:pos]
+	}
+	return importPath
+}
+
+// PackagesInDirs - return import paths of module packages located in one of dirs.
+func (g *PackageGraph) PackagesInDirs(dirs []string) []string {
+	dirSet := map[string]bool{}
+	for _, d := range dirs {
+		dirSet[filepath.Clean(d)] = true
+	}
+	result := []string{}
+	for id, p := range g.Packages {
+		if dirSet[filepath.Clean(p.Dir)] {
+			result = append(result, id)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Affected - return all packages transitively importing one of changed packages, including changed ones.
+// If tests is passed, imports of tests are also taken into account.
+func (g *PackageGraph) Affected(changed []string, tests bool) map[string]bool {
+	edges := g.importedBy
+	if tests {
+		edges = g.testImportedBy
+	}
+	result := map[string]bool{}
+	queue := append([]string{}, changed...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if result[id] {
+			continue
+		}
+		result[id] = true
+		queue = append(queue, edges[id]...)
+	}
+	return result
+}
+
+// AffectedSet - main and test packages affected by changed files, nil maps mean every package is affected.
+type AffectedSet struct {
+	// Apps - packages with non test imports affected.
+	Apps map[string]bool
+	// Tests - packages with tests affected.
+	Tests map[string]bool
+}
+
+// App - tells if package build is affected.
+func (a *AffectedSet) App(importPath string) bool {
+	return a == nil || a.Apps == nil || a.Apps[importPath]
+}
+
+// Test - tells if package tests are affected.
+func (a *AffectedSet) Test(importPath string) bool {
+	return a == nil || a.Tests == nil || a.Tests[importPath]
+}
+
+// AffectedBy - return packages affected by changed files. Files belong to the package in nearest parent folder, like
+// files in testdata or embedded assets. If go.mod, go.sum, go.work or go.work.sum are changed every package is affected.
+func (g *PackageGraph) AffectedBy(files []string) *AffectedSet {
+	dirs := map[string][]string{}
+	for id, p := range g.Packages {
+		dir := filepath.Clean(p.Dir)
+		dirs[dir] = append(dirs[dir], id)
+	}
+	changed := []string{}
+	for _, f := range files {
+		switch filepath.Base(f) {
+		case "go.mod", "go.sum", "go.work", "go.work.sum":
+			return &AffectedSet{}
+		}
+		for dir := filepath.Dir(filepath.Clean(f)); ; dir = filepath.Dir(dir) {
+			if ids, ok := dirs[dir]; ok {
+				changed = append(changed, ids...)
+				break
+			}
+			if dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+	return &AffectedSet{
+		Apps:  g.Affected(changed, false),
+		Tests: g.Affected(changed, true),
+	}
+}
+
+func decodePackages(lines []string) ([]*listPackage, error) {
+	result := []*listPackage{}
+	decoder := json.NewDecoder(strings.NewReader(strings.Join(lines, "\n")))
+	for decoder.More() {
+		p := &listPackage{}
+		if err := decoder.Decode(p); err != nil {
+			return nil, errors.Wrap(err, "failed to parse go list output")
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
@@ -0,0 +1,246 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestGraphID(t *testing.T) {
+	dirs := map[string]string{
+		"example.com/app/pkg":      "/src/app/pkg",
+		"example.com/app/pkg_test": "/src/app/pkg_test",
+		"example.com/app/x.test":   "/src/app/x.test",
+	}
+	tests := []struct {
+		name string
+		pkg  listPackage
+		want string
+	}{
+		{
+			name: "package",
+			pkg:  listPackage{ImportPath: "example.com/app/pkg", Dir: "/src/app/pkg"},
+			want: "example.com/app/pkg",
+		},
+		{
+			name: "test variant",
+			pkg:  listPackage{ImportPath: "example.com/app/pkg [example.com/app/pkg.test]", ForTest: "example.com/app/pkg", Dir: "/src/app/pkg"},
+			want: "example.com/app/pkg",
+		},
+		{
+			name: "external test package",
+			pkg:  listPackage{ImportPath: "example.com/app/pkg_test [example.com/app/pkg.test]", ForTest: "example.com/app/pkg", Dir: "/src/app/pkg"},
+			want: "example.com/app/pkg",
+		},
+		{
+			name: "test main",
+			pkg: listPackage{ImportPath: "example.com/app/pkg.test", Name: "main",
+				Imports: []string{"example.com/app/pkg [example.com/app/pkg.test]", "testing"}},
+			want: "example.com/app/pkg",
+		},
+		{
+			name: "dependency recompiled for test",
+			pkg:  listPackage{ImportPath: "example.com/app/pkg/testutil [example.com/app/pkg.test]", ForTest: "example.com/app/pkg", Dir: "/src/app/pkg/testutil"},
+			want: "example.com/app/pkg/testutil",
+		},
+		{
+			name: "package with _test suffix",
+			pkg:  listPackage{ImportPath: "example.com/app/pkg_test", Dir: "/src/app/pkg_test"},
+			want: "example.com/app/pkg_test",
+		},
+		{
+			name: "package with _test suffix recompiled for test",
+			pkg:  listPackage{ImportPath: "example.com/app/pkg_test [example.com/app/pkg.test]", ForTest: "example.com/app/pkg", Dir: "/src/app/pkg_test"},
+			want: "example.com/app/pkg_test",
+		},
+		{
+			name: "package with .test suffix",
+			pkg:  listPackage{ImportPath: "example.com/app/x.test", Name: "main", Dir: "/src/app/x.test", Imports: []string{"fmt"}},
+			want: "example.com/app/x.test",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := graphID(&tt.pkg, dirs); got != tt.want {
+				t.Errorf("graphID(%q) = %q, want %q", tt.pkg.ImportPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPackageGraphKeepsTestSuffixPackages(t *testing.T) {
+	main := &listModule{Path: "example.com/app", Main: true}
+	g := newPackageGraph([]*listPackage{
+		{ImportPath: "example.com/app/x.test", Name: "x", Dir: "/src/app/x.test", Module: main},
+		{ImportPath: "example.com/app/x_test", Name: "x", Dir: "/src/app/x_test", Module: main, Imports: []string{"example.com/app/x.test"}},
+		{ImportPath: "example.com/app/x", Name: "x", Dir: "/src/app/x", Module: main, Imports: []string{"example.com/app/x_test"}},
+	})
+	ids := []string{}
+	for id := range g.Packages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	want := []string{"example.com/app/x", "example.com/app/x.test", "example.com/app/x_test"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("packages = %v, want %v", ids, want)
+	}
+	if got := g.importedBy["example.com/app/x.test"]; !reflect.DeepEqual(got, []string{"example.com/app/x_test"}) {
+		t.Errorf("importedBy[x.test] = %v", got)
+	}
+}
+
+// testGraph - app imports pkg, pkg imports util, tests of other import testutil which imports util.
+func testGraph() *PackageGraph {
+	root := filepath.FromSlash("/src/app")
+	g := &PackageGraph{
+		Packages:       map[string]*GraphPackage{},
+		importedBy:     map[string][]string{},
+		testImportedBy: map[string][]string{},
+	}
+	for _, p := range []struct {
+		id, dir string
+		tests   bool
+	}{
+		{"app", "", false},
+		{"app/pkg", "pkg", true},
+		{"app/pkg/util", "pkg/util", true},
+		{"app/other", "other", true},
+		{"app/testutil", "testutil", false},
+	} {
+		g.Packages[p.id] = &GraphPackage{ImportPath: p.id, Dir: filepath.Join(root, filepath.FromSlash(p.dir)), HasTests: p.tests}
+	}
+	for _, e := range [][2]string{{"app/pkg", "app"}, {"app/pkg/util", "app/pkg"}, {"app/pkg/util", "app/testutil"}} {
+		g.importedBy[e[0]] = append(g.importedBy[e[0]], e[1])
+		g.testImportedBy[e[0]] = append(g.testImportedBy[e[0]], e[1])
+	}
+	g.testImportedBy["app/testutil"] = append(g.testImportedBy["app/testutil"], "app/other")
+	return g
+}
+
+func TestAffected(t *testing.T) {
+	tests := []struct {
+		name    string
+		changed []string
+		tests   bool
+		want    map[string]bool
+	}{
+		{
+			name:    "nothing",
+			changed: nil,
+			want:    map[string]bool{},
+		},
+		{
+			name:    "application",
+			changed: []string{"app"},
+			want:    map[string]bool{"app": true},
+		},
+		{
+			name:    "transitive",
+			changed: []string{"app/pkg/util"},
+			want:    map[string]bool{"app/pkg/util": true, "app/pkg": true, "app": true, "app/testutil": true},
+		},
+		{
+			name:    "transitive with tests",
+			changed: []string{"app/pkg/util"},
+			tests:   true,
+			want: map[string]bool{"app/pkg/util": true, "app/pkg": true, "app": true, "app/testutil": true,
+				"app/other": true},
+		},
+		{
+			name:    "test only import",
+			changed: []string{"app/testutil"},
+			want:    map[string]bool{"app/testutil": true},
+		},
+		{
+			name:    "test only import with tests",
+			changed: []string{"app/testutil"},
+			tests:   true,
+			want:    map[string]bool{"app/testutil": true, "app/other": true},
+		},
+	}
+	g := testGraph()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.Affected(tt.changed, tt.tests); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Affected() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAffectedBy(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		apps  map[string]bool
+		all   bool
+	}{
+		{
+			name:  "package file",
+			files: []string{"pkg/pkg.go"},
+			apps:  map[string]bool{"app/pkg": true, "app": true},
+		},
+		{
+			name:  "testdata",
+			files: []string{"pkg/util/testdata/input/file.json"},
+			apps:  map[string]bool{"app/pkg/util": true, "app/pkg": true, "app": true, "app/testutil": true},
+		},
+		{
+			name:  "embedded assets",
+			files: []string{"other/static/index.html"},
+			apps:  map[string]bool{"app/other": true},
+		},
+		{
+			name:  "root files",
+			files: []string{"readme.md"},
+			apps:  map[string]bool{"app": true},
+		},
+		{
+			name:  "outside of module",
+			files: []string{"../lib/lib.go"},
+			apps:  map[string]bool{},
+		},
+		{name: "go.mod", files: []string{"pkg/pkg.go", "go.mod"}, all: true},
+		{name: "go.sum", files: []string{"go.sum"}, all: true},
+		{name: "go.work", files: []string{"go.work"}, all: true},
+		{name: "go.work.sum", files: []string{"go.work.sum"}, all: true},
+		{name: "nested go.mod", files: []string{"pkg/go.mod"}, all: true},
+	}
+	g := testGraph()
+	root := filepath.FromSlash("/src/app")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := []string{}
+			for _, f := range tt.files {
+				files = append(files, filepath.Join(root, filepath.FromSlash(f)))
+			}
+			got := g.AffectedBy(files)
+			if tt.all {
+				if got.Apps != nil || got.Tests != nil {
+					t.Errorf("every package is expected to be affected, got %v", got.Apps)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got.Apps, tt.apps) {
+				t.Errorf("AffectedBy().Apps = %v, want %v", got.Apps, tt.apps)
+			}
+		})
+	}
+}
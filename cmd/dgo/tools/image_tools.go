@@ -0,0 +1,239 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BuildStep - a step of docker image build reported by BuildKit.
+type BuildStep struct {
+	Name     string
+	Cached   bool
+	Error    string
+	Started  time.Time
+	Duration time.Duration
+}
+
+// buildVertex - a vertex of BuildKit rawjson progress output.
+type buildVertex struct {
+	Digest    string     `json:"digest"`
+	Name      string     `json:"name"`
+	Cached    bool       `json:"cached"`
+	Error     string     `json:"error"`
+	Started   *time.Time `json:"started"`
+	Completed *time.Time `json:"completed"`
+}
+
+// buildLog - a log record of BuildKit rawjson progress output, data is base64 encoded.
+type buildLog struct {
+	Vertex string `json:"vertex"`
+	Data   []byte `json:"data"`
+}
+
+// buildStatus - a line of BuildKit rawjson progress output.
+type buildStatus struct {
+	Vertexes []*buildVertex `json:"vertexes"`
+	Logs     []*buildLog    `json:"logs"`
+}
+
+// buildProgress - collect build steps from BuildKit rawjson progress output.
+type buildProgress struct {
+	steps map[string]*BuildStep
+	names map[string]string
+}
+
+// cliImageBuild - build image with container runtime CLI and arguments passed to build command, and return image id.
+// Image id is retrieved with --iidfile, so it works with both legacy docker builder and BuildKit.
+// If rawJSON is passed, BuildKit rawjson progress is parsed and per step timings and cache hits are returned.
+func cliImageBuild(ctx context.Context, binary, dir string, args []string, rawJSON bool) (string, []*BuildStep, error) {
+	iidFile, err := ioutil.TempFile("", "dgo-iid")
+	if err != nil {
+		return "", nil, err
+	}
+	_ = iidFile.Close()
+	defer func() { _ = os.Remove(iidFile.Name()) }()
+
+	buildCmd := append([]string{binary, "build", "--iidfile", iidFile.Name()}, args...)
+	var steps []*BuildStep
+	if rawJSON {
+		var output []string
+		steps, output, err = execBuildKit(ctx, dir, append(buildCmd, "--progress", "rawjson"), nil)
+		if err != nil && isProgressUnsupported(output) {
+			// Older BuildKit clients don't support rawjson, use plain output.
+			logrus.Infof("rawjson progress is not supported, fallback to plain output")
+			steps = nil
+			err = Exec(ctx, dir, buildCmd, nil)
+		}
+	} else {
+		err = Exec(ctx, dir, buildCmd, nil)
+	}
+	if err != nil {
+		return "", steps, err
+	}
+	content, err := ioutil.ReadFile(iidFile.Name())
+	if err != nil {
+		return "", steps, errors.Wrap(err, "failed to read image id")
+	}
+	imageID := strings.TrimSpace(string(content))
+	if imageID == "" {
+		return "", steps, errors.Errorf("%v build produced an empty image id", binary)
+	}
+	return imageID, steps, nil
+}
+
+// IsBuildKit - tells if docker build will use BuildKit. DOCKER_BUILDKIT is respected,
+// otherwise BuildKit is used if docker buildx is available, as it is the default builder for modern docker.
+func IsBuildKit(ctx context.Context, env []string) bool {
+	value := os.Getenv("DOCKER_BUILDKIT")
+	for _, e := range env {
+		if strings.HasPrefix(e, "DOCKER_BUILDKIT=") {
+			value = strings.TrimPrefix(e, "DOCKER_BUILDKIT=")
+		}
+	}
+	switch value {
+	case "0", "false":
+		return false
+	case "1", "true":
+		return true
+	}
+	_, err := ExecRead(ctx, "", []string{"docker", "buildx", "version"}, env, false)
+	return err == nil
+}
+
+func isProgressUnsupported(output []string) bool {
+	for _, line := range output {
+		if strings.Contains(line, "progress") && (strings.Contains(line, "invalid") || strings.Contains(line, "unknown") || strings.Contains(line, "unsupported")) {
+			return true
+		}
+	}
+	return false
+}
+
+// execBuildKit - run docker build with rawjson progress, steps are logged as they are completed.
+// Return parsed steps and not parsed output lines.
+func execBuildKit(ctx context.Context, dir string, args, env []string) ([]*BuildStep, []string, error) {
+	if dir == "" {
+		var err error
+		if dir, err = os.Getwd(); err != nil {
+			return nil, nil, err
+		}
+	}
+	proc, err := execProc(ctx, dir, args, env)
+	if err != nil {
+		return nil, nil, err
+	}
+	progress := &buildProgress{
+		steps: map[string]*BuildStep{},
+		names: map[string]string{},
+	}
+	output := []string{}
+	outDone := make(chan struct{})
+	go func() {
+		defer close(outDone)
+		scanner := bufio.NewScanner(proc.Stdout)
+		for scanner.Scan() {
+			logrus.Infof("%v ==> %v", args[0], strings.TrimSpace(scanner.Text()))
+		}
+	}()
+	scanner := bufio.NewScanner(proc.Stderr)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !progress.parse(line) && line != "" {
+			logrus.Infof("%v stderr ==> %v", args[0], line)
+			output = append(output, line)
+		}
+	}
+	<-outDone
+	err = proc.Cmd.Wait()
+	return progress.result(), output, err
+}
+
+// parse - parse a line of rawjson progress, return false if line is not a progress status.
+func (p *buildProgress) parse(line string) bool {
+	if !strings.HasPrefix(line, "{") {
+		return false
+	}
+	status := &buildStatus{}
+	if err := json.Unmarshal([]byte(line), status); err != nil {
+		return false
+	}
+	for _, v := range status.Vertexes {
+		if v.Name != "" {
+			p.names[v.Digest] = v.Name
+		}
+		step, ok := p.steps[v.Digest]
+		if !ok {
+			step = &BuildStep{Name: p.names[v.Digest]}
+			p.steps[v.Digest] = step
+		}
+		if v.Name != "" {
+			step.Name = v.Name
+		}
+		step.Cached = step.Cached || v.Cached
+		if v.Error != "" {
+			step.Error = v.Error
+		}
+		if v.Started != nil && step.Started.IsZero() {
+			step.Started = *v.Started
+		}
+		if v.Completed != nil {
+			if v.Started != nil {
+				step.Duration = v.Completed.Sub(*v.Started)
+			}
+			switch {
+			case step.Error != "":
+				logrus.Errorf("docker build ==> %v ERROR: %v", step.Name, step.Error)
+			case step.Cached:
+				logrus.Infof("docker build ==> %v CACHED", step.Name)
+			default:
+				logrus.Infof("docker build ==> %v DONE %v", step.Name, step.Duration.Round(time.Millisecond))
+			}
+		}
+	}
+	for _, l := range status.Logs {
+		for _, s := range strings.Split(strings.TrimRight(string(l.Data), "\n"), "\n") {
+			logrus.Infof("docker build ==> %v: %v", p.names[l.Vertex], strings.TrimSpace(s))
+		}
+	}
+	return true
+}
+
+// result - return build steps sorted by start time.
+func (p *buildProgress) result() []*BuildStep {
+	result := []*BuildStep{}
+	for _, s := range p.steps {
+		result = append(result, s)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Started.Equal(result[j].Started) {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Started.Before(result[j].Started)
+	})
+	return result
+}
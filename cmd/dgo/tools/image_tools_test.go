@@ -0,0 +1,159 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildProgressParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  []string
+		parsed []bool
+		want   []BuildStep
+	}{
+		{
+			name: "completed vertex",
+			lines: []string{
+				`{"vertexes":[{"digest":"sha256:1","name":"[build 1/2] FROM golang","started":"2020-01-01T00:00:00Z"}]}`,
+				`{"vertexes":[{"digest":"sha256:1","started":"2020-01-01T00:00:00Z","completed":"2020-01-01T00:00:02Z"}]}`,
+			},
+			parsed: []bool{true, true},
+			want: []BuildStep{
+				{Name: "[build 1/2] FROM golang", Started: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Duration: 2 * time.Second},
+			},
+		},
+		{
+			name: "cached and failed vertexes",
+			lines: []string{
+				`{"vertexes":[{"digest":"sha256:1","name":"COPY go.mod","cached":true,"started":"2020-01-01T00:00:00Z","completed":"2020-01-01T00:00:00Z"}]}`,
+				`{"vertexes":[{"digest":"sha256:2","name":"RUN go build","started":"2020-01-01T00:00:01Z"}]}`,
+				`{"logs":[{"vertex":"sha256:2","data":"Y29tcGlsaW5nCg=="}]}`,
+				`{"vertexes":[{"digest":"sha256:2","error":"exit code: 1","started":"2020-01-01T00:00:01Z","completed":"2020-01-01T00:00:04Z"}]}`,
+			},
+			parsed: []bool{true, true, true, true},
+			want: []BuildStep{
+				{Name: "COPY go.mod", Cached: true, Started: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+				{Name: "RUN go build", Error: "exit code: 1", Started: time.Date(2020, 1, 1, 0, 0, 1, 0, time.UTC), Duration: 3 * time.Second},
+			},
+		},
+		{
+			name: "status lines",
+			lines: []string{
+				"#1 [internal] load build definition from Dockerfile",
+				"",
+				`{"vertexes":`,
+			},
+			parsed: []bool{false, false, false},
+			want:   []BuildStep{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &buildProgress{steps: map[string]*BuildStep{}, names: map[string]string{}}
+			for i, line := range tt.lines {
+				if got := p.parse(line); got != tt.parsed[i] {
+					t.Errorf("parse(%q) = %v, want %v", line, got, tt.parsed[i])
+				}
+			}
+			got := []BuildStep{}
+			for _, s := range p.result() {
+				got = append(got, *s)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("steps = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegacyBuildProgressParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		lines       []string
+		wantImageID string
+		wantSteps   []string
+		wantCached  []bool
+	}{
+		{
+			name: "successfully built",
+			lines: []string{
+				"Step 1/3 : FROM golang:1.20",
+				" ---> 0123456789ab",
+				"Step 2/3 : COPY . .",
+				" ---> Using cache",
+				"Step 3/3 : RUN dgo build",
+				" ---> Running in 0123456789ab",
+				"Successfully built 3f2a1b0c9d8e",
+				"Successfully tagged app:latest",
+			},
+			wantImageID: "3f2a1b0c9d8e",
+			wantSteps:   []string{"FROM golang:1.20", "COPY . .", "RUN dgo build"},
+			wantCached:  []bool{false, true, false},
+		},
+		{
+			name:        "no steps",
+			lines:       []string{"Sending build context to Docker daemon  2.048kB"},
+			wantSteps:   []string{},
+			wantCached:  []bool{},
+			wantImageID: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &legacyBuildProgress{}
+			for _, line := range tt.lines {
+				p.parse(line)
+			}
+			if p.imageID != tt.wantImageID {
+				t.Errorf("imageID = %q, want %q", p.imageID, tt.wantImageID)
+			}
+			names, cached := []string{}, []bool{}
+			for _, s := range p.result() {
+				names = append(names, s.Name)
+				cached = append(cached, s.Cached)
+			}
+			if !reflect.DeepEqual(names, tt.wantSteps) || !reflect.DeepEqual(cached, tt.wantCached) {
+				t.Errorf("steps = %v %v, want %v %v", names, cached, tt.wantSteps, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestIsProgressUnsupported(t *testing.T) {
+	tests := []struct {
+		name   string
+		output []string
+		want   bool
+	}{
+		{name: "invalid progress", output: []string{`invalid argument "rawjson" for "--progress" flag`}, want: true},
+		{name: "unknown flag", output: []string{"unknown flag: --progress"}, want: true},
+		{name: "unsupported progress", output: []string{"progress type rawjson is unsupported"}, want: true},
+		{name: "build failure", output: []string{"failed to solve: process did not complete successfully"}, want: false},
+		{name: "empty", output: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isProgressUnsupported(tt.output); got != tt.want {
+				t.Errorf("isProgressUnsupported(%q) = %v, want %v", tt.output, got, tt.want)
+			}
+		})
+	}
+}
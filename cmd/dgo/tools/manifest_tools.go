@@ -0,0 +1,83 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+)
+
+// ManifestFileName - a name of build manifest file stored inside output folder.
+const ManifestFileName = "dgo-manifest.json"
+
+// ManifestEntry - describe one binary produced by build.
+type ManifestEntry struct {
+	// Name - a file name of binary.
+	Name string `json:"name"`
+	// Path - a path of binary relative to folder manifest is stored in.
+	Path string `json:"path"`
+	// Application - a name of application binary is related to.
+	Application string `json:"application"`
+	// Folder - a slash separated folder of application relative to folder build is started in.
+	Folder string `json:"folder,omitempty"`
+	// Package - an import path of source package.
+	Package  string   `json:"package"`
+	Tests    []string `json:"tests,omitempty"`
+	Platform string   `json:"platform"`
+	SHA256   string   `json:"sha256"`
+}
+
+// Manifest - describe all binaries produced by build.
+type Manifest struct {
+	GoVersion    string           `json:"goVersion"`
+	GitCommit    string           `json:"gitCommit,omitempty"`
+	Applications []*ManifestEntry `json:"applications"`
+	Tests        []*ManifestEntry `json:"tests"`
+}
+
+// ReadManifest - read a manifest from folder.
+func ReadManifest(folder string) (*Manifest, error) {
+	content, err := ioutil.ReadFile(path.Join(folder, ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err = json.Unmarshal(content, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Write - store manifest into folder, entries are sorted by path to keep file stable between builds.
+func (m *Manifest) Write(folder string) error {
+	for _, entries := range [][]*ManifestEntry{m.Applications, m.Tests} {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Path < entries[j].Path
+		})
+	}
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(folder, os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(folder, ManifestFileName), content, 0600)
+}
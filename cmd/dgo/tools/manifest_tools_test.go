@@ -0,0 +1,64 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dist")
+	m := &Manifest{
+		GoVersion: "go1.20",
+		GitCommit: "abc",
+		Applications: []*ManifestEntry{
+			{Name: "b", Path: "b", Application: "b", Folder: "cmd/b", Package: "example.com/app/cmd/b", Platform: "linux/amd64", SHA256: "2"},
+			{Name: "a", Path: "a", Application: "a", Package: "example.com/app", Platform: "linux/amd64", SHA256: "1"},
+		},
+		Tests: []*ManifestEntry{
+			{Name: "app_pkg.test", Path: "app_pkg.test", Application: "a", Package: "example.com/app/pkg",
+				Tests: []string{"TestA", "ExampleA"}, Platform: "linux/amd64", SHA256: "3"},
+		},
+	}
+	if err := m.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Entries are sorted by path.
+	if got.Applications[0].Path != "a" || got.Applications[1].Path != "b" {
+		t.Errorf("applications are not sorted: %v, %v", got.Applications[0].Path, got.Applications[1].Path)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("ReadManifest() = %+v, want %+v", got, m)
+	}
+
+	if _, err = ReadManifest(t.TempDir()); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error for missing manifest, got %v", err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, ManifestFileName), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadManifest(dir); err == nil {
+		t.Error("expected an error for corrupted manifest")
+	}
+}
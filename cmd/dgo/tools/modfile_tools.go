@@ -0,0 +1,183 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ModFileName - a name of alternate go.mod with replace overrides, stored in state folder of output folder.
+// Nested modules use dgo-${module name}.mod
+const ModFileName = "dgo.mod"
+
+// WorkFileName - a name of alternate go.work with replace overrides, stored in state folder of output folder.
+const WorkFileName = "dgo.work"
+
+// ModReplace - a replace directive override, Old is a module path with optional version,
+// New is a local path or module path with version.
+type ModReplace struct {
+	Old string
+	New string
+}
+
+func (r ModReplace) String() string {
+	return fmt.Sprintf("%s => %s", r.Old, r.New)
+}
+
+// ParseReplaces - parse old=new replace overrides, local paths are converted to absolute ones.
+func ParseReplaces(values []string) ([]ModReplace, error) {
+	result := []ModReplace{}
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, errors.Errorf("invalid replace %q, expected module=path or module=module@version", v)
+		}
+		r := ModReplace{Old: strings.TrimSpace(parts[0]), New: strings.TrimSpace(parts[1])}
+		if isLocalPath(r.New) {
+			abs, err := filepath.Abs(r.New)
+			if err != nil {
+				return nil, err
+			}
+			r.New = abs
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// isLocalPath - tells if replacement is a file path, same rules as go.mod uses.
+func isLocalPath(value string) bool {
+	return filepath.IsAbs(value) || value == "." || value == ".." ||
+		strings.HasPrefix(value, "./") || strings.HasPrefix(value, "../")
+}
+
+// WriteModFile - generate an alternate go.mod and go.sum with replace overrides into outFolder, module go.mod and
+// go.sum are not touched. Missing requirements and checksums are resolved into alternate files.
+// Modfile is stored as outFolder/fileName, fileName should have .mod extension.
+// Return environment with GOFLAGS to pass -modfile to every go command.
+func WriteModFile(ctx context.Context, dir, outFolder, fileName string, replaces []ModReplace, env []string) ([]string, error) {
+	lines, err := ExecRead(ctx, dir, []string{"go", "env", "GOMOD"}, env, false)
+	if err != nil || len(lines) == 0 {
+		return nil, errors.Wrapf(err, "failed to find go.mod: %v", strings.Join(lines, "\n"))
+	}
+	goMod := strings.TrimSpace(lines[0])
+	if goMod == "" || goMod == os.DevNull {
+		return nil, errors.New("replace overrides require go modules")
+	}
+	if err = os.MkdirAll(outFolder, os.ModePerm); err != nil {
+		return nil, err
+	}
+	modFile, err := filepath.Abs(filepath.Join(outFolder, fileName))
+	if err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(modFile, " \t") {
+		return nil, errors.Errorf("alternate modfile path %q should not contain spaces to be passed with GOFLAGS", modFile)
+	}
+	for src, dst := range map[string]string{goMod: modFile, strings.TrimSuffix(goMod, ".mod") + ".sum": strings.TrimSuffix(modFile, ".mod") + ".sum"} {
+		content, err := ioutil.ReadFile(src) // #nosec
+		if os.IsNotExist(err) {
+			content = nil
+		} else if err != nil {
+			return nil, err
+		}
+		if err = ioutil.WriteFile(dst, content, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	editCmd := []string{"go", "mod", "edit"}
+	for _, r := range replaces {
+		editCmd = append(editCmd, fmt.Sprintf("-replace=%s=%s", r.Old, r.New))
+	}
+	if lines, err = ExecRead(ctx, dir, append(editCmd, modFile), env, false); err != nil {
+		return nil, errors.Wrapf(err, "failed to add replace overrides: %v", strings.Join(lines, "\n"))
+	}
+
+	// Resolve requirements and checksums of replaced modules once, so parallel builds don't update modfile.
+	listCmd := []string{"go", "list", "-mod=mod", "-modfile=" + modFile, "-deps", "-test", "./..."}
+	if lines, err = ExecRead(ctx, filepath.Dir(goMod), listCmd, env, false); err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve replace overrides: %v", strings.Join(lines, "\n"))
+	}
+
+	goFlags := strings.TrimSpace(os.Getenv("GOFLAGS") + " -modfile=" + modFile)
+	return []string{"GOFLAGS=" + goFlags}, nil
+}
+
+// WriteWorkFile - generate an alternate go.work with replace overrides into outFolder, go.work of workspace is not
+// touched, -modfile could not be used in workspace mode. Relative use directives are made absolute.
+// Return environment with GOWORK pointing to alternate file.
+func WriteWorkFile(ctx context.Context, dir, outFolder string, replaces []ModReplace, env []string) ([]string, error) {
+	lines, err := ExecRead(ctx, dir, []string{"go", "env", "GOWORK"}, env, false)
+	if err != nil || len(lines) == 0 {
+		return nil, errors.Wrapf(err, "failed to find go.work: %v", strings.Join(lines, "\n"))
+	}
+	goWork := strings.TrimSpace(lines[0])
+	if goWork == "" || goWork == "off" {
+		return nil, errors.New("go.work workspace is not used")
+	}
+	if err = os.MkdirAll(outFolder, os.ModePerm); err != nil {
+		return nil, err
+	}
+	workFile, err := filepath.Abs(filepath.Join(outFolder, WorkFileName))
+	if err != nil {
+		return nil, err
+	}
+	for src, dst := range map[string]string{goWork: workFile, goWork + ".sum": workFile + ".sum"} {
+		content, err := ioutil.ReadFile(src) // #nosec
+		if os.IsNotExist(err) {
+			content = nil
+		} else if err != nil {
+			return nil, err
+		}
+		if err = ioutil.WriteFile(dst, content, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	if lines, err = ExecRead(ctx, dir, []string{"go", "work", "edit", "-json", goWork}, env, false); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %v: %v", goWork, strings.Join(lines, "\n"))
+	}
+	work := &struct {
+		Use []struct {
+			DiskPath string
+		}
+	}{}
+	if err = json.Unmarshal([]byte(strings.Join(lines, "\n")), work); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %v", goWork)
+	}
+	editCmd := []string{"go", "work", "edit"}
+	for _, use := range work.Use {
+		if !filepath.IsAbs(use.DiskPath) {
+			editCmd = append(editCmd, "-dropuse="+use.DiskPath, "-use="+filepath.Join(filepath.Dir(goWork), use.DiskPath))
+		}
+	}
+	for _, r := range replaces {
+		editCmd = append(editCmd, fmt.Sprintf("-replace=%s=%s", r.Old, r.New))
+	}
+	if lines, err = ExecRead(ctx, dir, append(editCmd, workFile), env, false); err != nil {
+		return nil, errors.Wrapf(err, "failed to add replace overrides: %v", strings.Join(lines, "\n"))
+	}
+	return []string{"GOWORK=" + workFile}, nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReplaces(t *testing.T) {
+	parent, err := filepath.Abs("../b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		values  []string
+		want    []ModReplace
+		wantErr bool
+	}{
+		{name: "relative path", values: []string{"a=../b"}, want: []ModReplace{{Old: "a", New: parent}}},
+		{name: "module version", values: []string{"a=b@v1"}, want: []ModReplace{{Old: "a", New: "b@v1"}}},
+		{name: "absolute path", values: []string{"a@v1.2.0 = /src/a"}, want: []ModReplace{{Old: "a@v1.2.0", New: "/src/a"}}},
+		{name: "none", values: nil, want: []ModReplace{}},
+		{name: "no path", values: []string{"a"}, wantErr: true},
+		{name: "empty module", values: []string{"=../b"}, wantErr: true},
+		{name: "empty path", values: []string{"a= "}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReplaces(tt.values)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseReplaces(%q) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+// writeTestModules - create app module importing example.com/lib, which is available only as a local lib folder.
+func writeTestModules(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"app/go.mod":  "module example.com/app\n\ngo 1.20\n",
+		"app/main.go": "package main\n\nimport \"example.com/lib\"\n\nfunc main() { lib.Run() }\n",
+		"lib/go.mod":  "module example.com/lib\n\ngo 1.20\n",
+		"lib/lib.go":  "package lib\n\n// Run - do nothing.\nfunc Run() {}\n",
+	})
+	return root
+}
+
+func TestWriteModFile(t *testing.T) {
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOWORK", "off")
+	root := writeTestModules(t)
+	appDir := filepath.Join(root, "app")
+	stateDir := StateDir(filepath.Join(appDir, "dist"))
+	replaces := []ModReplace{{Old: "example.com/lib", New: filepath.Join(root, "lib")}}
+
+	env, err := WriteModFile(context.Background(), appDir, stateDir, ModFileName, replaces, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modFile := filepath.Join(appDir, "dist", ".dgo", ModFileName)
+	if want := []string{"GOFLAGS=-mod=mod -modfile=" + modFile}; !reflect.DeepEqual(env, want) {
+		t.Errorf("env = %v, want %v", env, want)
+	}
+	content, err := os.ReadFile(modFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"module example.com/app", "require example.com/lib", "replace example.com/lib => " + filepath.Join(root, "lib")} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("%v doesn't contain %q:\n%s", ModFileName, want, content)
+		}
+	}
+	// Module go.mod is not touched.
+	if content, err = os.ReadFile(filepath.Join(appDir, "go.mod")); err != nil || string(content) != "module example.com/app\n\ngo 1.20\n" {
+		t.Errorf("go.mod is changed: %s %v", content, err)
+	}
+	// Application is built with alternate modfile.
+	if output, err := ExecRead(context.Background(), appDir, []string{"go", "build", "-o", os.DevNull, "."}, env, false); err != nil {
+		t.Errorf("failed to build with %v: %v %v", env, err, output)
+	}
+}
+
+func TestWriteWorkFile(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOPROXY", "off")
+	root := writeTestModules(t)
+	// Workspace replaces only required modules.
+	writeTestFiles(t, root, map[string]string{
+		"go.work":    "go 1.20\n\nuse ./app\n",
+		"app/go.mod": "module example.com/app\n\ngo 1.20\n\nrequire example.com/lib v1.0.0\n",
+	})
+	t.Setenv("GOWORK", filepath.Join(root, "go.work"))
+	appDir := filepath.Join(root, "app")
+	stateDir := StateDir(filepath.Join(root, "dist"))
+	replaces := []ModReplace{{Old: "example.com/lib", New: filepath.Join(root, "lib")}}
+
+	env, err := WriteWorkFile(context.Background(), appDir, stateDir, replaces, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	workFile := filepath.Join(root, "dist", ".dgo", WorkFileName)
+	if want := []string{"GOWORK=" + workFile}; !reflect.DeepEqual(env, want) {
+		t.Errorf("env = %v, want %v", env, want)
+	}
+	content, err := os.ReadFile(workFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Relative use directives are made absolute, since alternate file is stored in dist/.dgo.
+	for _, want := range []string{"use " + appDir, "replace example.com/lib => " + filepath.Join(root, "lib")} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("%v doesn't contain %q:\n%s", WorkFileName, want, content)
+		}
+	}
+	if strings.Contains(string(content), "./app") {
+		t.Errorf("%v contains relative use directive:\n%s", WorkFileName, content)
+	}
+	if output, err := ExecRead(context.Background(), appDir, []string{"go", "build", "-o", os.DevNull, "."}, env, false); err != nil {
+		t.Errorf("failed to build with %v: %v %v", env, err, output)
+	}
+
+	t.Setenv("GOWORK", "off")
+	if _, err = WriteWorkFile(context.Background(), appDir, stateDir, replaces, nil); err == nil {
+		t.Error("expected an error without workspace")
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Module - a go module found in workspace or under root folder.
+type Module struct {
+	// Path - a module path from go.mod
+	Path string
+	// Dir - an absolute folder go commands of module are executed in, a module root or root folder
+	// if root folder is inside of module.
+	Dir string
+	// Name - a short unique module name used as output names prefix, empty for a module of root folder.
+	Name string
+	// Workspace - true if module is a part of go.work workspace.
+	Workspace bool
+}
+
+// OutName - return an output file name prefixed with module name, so binaries of different modules don't collide.
+func (m *Module) OutName(name string) string {
+	if m.Name == "" {
+		return name
+	}
+	return m.Name + "-" + name
+}
+
+// FindModules - find all modules of go.work workspace located under root folder if workspace is used, else all
+// modules under root folder. If root folder is inside a module, this module is returned first with root folder as Dir.
+func FindModules(ctx context.Context, root string, env []string) ([]*Module, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if goWork := goEnvValue(ctx, root, "GOWORK", env); goWork != "" && goWork != "off" {
+		return findWorkspaceModules(ctx, root, goWork, env)
+	}
+
+	modules := []*Module{}
+	goMod := goEnvValue(ctx, root, "GOMOD", env)
+	switch goMod {
+	case "":
+		// GOPATH mode, there are no modules.
+		return []*Module{{Dir: root}}, nil
+	case os.DevNull:
+		// Module mode without go.mod, only nested modules could be built.
+	default:
+		modPath, err := readModulePath(goMod)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, &Module{Path: modPath, Dir: root})
+	}
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() || p == root {
+			return err
+		}
+		name := info.Name()
+		if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata" || name == "node_modules" {
+			return filepath.SkipDir
+		}
+		goMod := filepath.Join(p, "go.mod")
+		if _, err = os.Stat(goMod); err != nil {
+			return nil
+		}
+		modPath, err := readModulePath(goMod)
+		if err != nil {
+			return err
+		}
+		modules = append(modules, &Module{Path: modPath, Dir: p, Name: moduleName(root, p)})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find modules")
+	}
+	return modules, nil
+}
+
+func findWorkspaceModules(ctx context.Context, root, goWork string, env []string) ([]*Module, error) {
+	lines, err := ExecRead(ctx, root, []string{"go", "work", "edit", "-json", goWork}, env, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %v: %v", goWork, strings.Join(lines, "\n"))
+	}
+	work := &struct {
+		Use []struct {
+			DiskPath string
+		}
+	}{}
+	if err = json.Unmarshal([]byte(strings.Join(lines, "\n")), work); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %v", goWork)
+	}
+	workDir := filepath.Dir(goWork)
+	modules := []*Module{}
+	for _, use := range work.Use {
+		dir := filepath.Clean(use.DiskPath)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(workDir, dir)
+		}
+		modPath, err := readModulePath(filepath.Join(dir, "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+		if isInside(dir, root) {
+			// Root folder is inside of module, like a nested folder of workspace module.
+			dir = root
+		} else if !isInside(root, dir) {
+			continue
+		}
+		modules = append(modules, &Module{Path: modPath, Dir: dir, Name: moduleName(root, dir), Workspace: true})
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Dir < modules[j].Dir })
+	return modules, nil
+}
+
+// isInside - tells if dir is a root folder or located inside of it.
+func isInside(root, dir string) bool {
+	rel, err := filepath.Rel(root, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// moduleName - return a module folder relative to root as a file name, empty for root itself.
+func moduleName(root, dir string) string {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return SafeName(filepath.ToSlash(rel))
+}
+
+func goEnvValue(ctx context.Context, dir, name string, env []string) string {
+	lines, err := ExecRead(ctx, dir, []string{"go", "env", name}, env, false)
+	if err != nil || len(lines) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(lines[0])
+}
+
+// readModulePath - read a module path from go.mod file.
+func readModulePath(goMod string) (string, error) {
+	file, err := os.Open(goMod) // #nosec
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module") {
+			value := strings.TrimSpace(strings.TrimPrefix(line, "module"))
+			if pos := strings.Index(value, "//"); pos != -1 {
+				value = strings.TrimSpace(value[:pos])
+			}
+			return strings.Trim(value, "\"`"), nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.Errorf("no module directive is found in %v", goMod)
+}
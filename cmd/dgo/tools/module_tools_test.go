@@ -0,0 +1,146 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestFiles - create files relative to root folder.
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		fileName := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// nestedModules - a root module with nested ones, modules inside vendor, testdata and hidden folders are ignored.
+var nestedModules = map[string]string{
+	"go.mod":              "module example.com/root\n\ngo 1.20\n",
+	"a/go.mod":            "module example.com/a\n\ngo 1.20\n",
+	"a/sub/main.go":       "package main\n",
+	"b/c/go.mod":          "module \"example.com/c\" // nested\n\ngo 1.20\n",
+	"vendor/v/go.mod":     "module example.com/v\n",
+	"a/testdata/t/go.mod": "module example.com/t\n",
+	".hidden/go.mod":      "module example.com/hidden\n",
+	"_skip/go.mod":        "module example.com/skip\n",
+}
+
+func TestFindModules(t *testing.T) {
+	t.Setenv("GOWORK", "off")
+	root := t.TempDir()
+	writeTestFiles(t, root, nestedModules)
+
+	modules, err := FindModules(context.Background(), root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Module{
+		{Path: "example.com/root", Dir: root},
+		{Path: "example.com/a", Dir: filepath.Join(root, "a"), Name: "a"},
+		{Path: "example.com/c", Dir: filepath.Join(root, "b", "c"), Name: SafeName("b/c")},
+	}
+	if !reflect.DeepEqual(modules, want) {
+		t.Errorf("FindModules() = %v, want %v", modules, want)
+	}
+
+	// Without go.mod in root folder only nested modules are found.
+	if err = os.Remove(filepath.Join(root, "go.mod")); err != nil {
+		t.Fatal(err)
+	}
+	if modules, err = FindModules(context.Background(), root, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(modules, want[1:]) {
+		t.Errorf("FindModules() without root module = %v, want %v", modules, want[1:])
+	}
+}
+
+func TestFindWorkspaceModules(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, nestedModules)
+	writeTestFiles(t, root, map[string]string{"go.work": "go 1.20\n\nuse (\n\t./b/c\n\t./a\n\t" + filepath.Join(root, "vendor", "v") + "\n)\n"})
+	t.Setenv("GOWORK", filepath.Join(root, "go.work"))
+
+	modules, err := FindModules(context.Background(), root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Module{
+		{Path: "example.com/a", Dir: filepath.Join(root, "a"), Name: "a", Workspace: true},
+		{Path: "example.com/c", Dir: filepath.Join(root, "b", "c"), Name: SafeName("b/c"), Workspace: true},
+		{Path: "example.com/v", Dir: filepath.Join(root, "vendor", "v"), Name: SafeName("vendor/v"), Workspace: true},
+	}
+	if !reflect.DeepEqual(modules, want) {
+		t.Errorf("FindModules() = %v, want %v", modules, want)
+	}
+
+	// Root folder inside of workspace module, modules outside of root are skipped.
+	sub := filepath.Join(root, "a", "sub")
+	if modules, err = FindModules(context.Background(), sub, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want = []*Module{{Path: "example.com/a", Dir: sub, Workspace: true}}; !reflect.DeepEqual(modules, want) {
+		t.Errorf("FindModules() of nested folder = %v, want %v", modules, want)
+	}
+}
+
+func TestReadModulePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", content: "module example.com/a\n\ngo 1.20\n", want: "example.com/a"},
+		{name: "quoted with comment", content: "// header\nmodule \"example.com/a\" // comment\n", want: "example.com/a"},
+		{name: "raw string", content: "module `example.com/a`\n", want: "example.com/a"},
+		{name: "no module", content: "go 1.20\n", wantErr: true},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goMod := filepath.Join(dir, "go.mod")
+			if err := os.WriteFile(goMod, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readModulePath(goMod)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("readModulePath() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+	if _, err := readModulePath(filepath.Join(dir, "missing", "go.mod")); err == nil {
+		t.Error("expected an error for missing go.mod")
+	}
+}
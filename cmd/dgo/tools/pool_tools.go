@@ -0,0 +1,119 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// StatusSkipped - a status of task was not started since pool is stopped.
+	StatusSkipped = "skipped"
+	// StatusCanceled - a status of task was interrupted since pool is stopped.
+	StatusCanceled = "canceled"
+)
+
+// Task - a unit of work executed by worker pool, it return a status, output to be reported and error.
+type Task func(ctx context.Context) (status string, output []string, err error)
+
+// TaskResult - a result of task executed by worker pool.
+type TaskResult struct {
+	Name     string
+	Status   string
+	Output   []string
+	Err      error
+	Duration time.Duration
+}
+
+// WorkerPool - execute tasks with bounded concurrency, tasks are allowed to add new tasks.
+type WorkerPool struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	failFast bool
+	slots    chan struct{}
+	wg       sync.WaitGroup
+	lock     sync.Mutex
+	results  []*TaskResult
+}
+
+// NewWorkerPool - construct a worker pool running at most jobs tasks at once,
+// if failFast is passed, first failed task will cancel all running and skip all pending tasks.
+func NewWorkerPool(ctx context.Context, jobs int, failFast bool) *WorkerPool {
+	if jobs < 1 {
+		jobs = 1
+	}
+	pool := &WorkerPool{
+		failFast: failFast,
+		slots:    make(chan struct{}, jobs),
+	}
+	pool.ctx, pool.cancel = context.WithCancel(ctx)
+	return pool
+}
+
+// Go - schedule a task for execution, it will be started as soon as there will be a free slot.
+func (p *WorkerPool) Go(name string, task Task) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		result := &TaskResult{Name: name}
+		defer p.add(result)
+
+		select {
+		case p.slots <- struct{}{}:
+		case <-p.ctx.Done():
+			result.Status = StatusSkipped
+			return
+		}
+		defer func() { <-p.slots }()
+		if p.ctx.Err() != nil {
+			result.Status = StatusSkipped
+			return
+		}
+
+		start := time.Now()
+		result.Status, result.Output, result.Err = task(p.ctx)
+		result.Duration = time.Since(start)
+		if result.Err != nil {
+			if p.ctx.Err() != nil {
+				result.Status = StatusCanceled
+			} else if p.failFast {
+				p.cancel()
+			}
+		}
+	}()
+}
+
+// Wait - wait for all tasks to complete and return results ordered by name.
+func (p *WorkerPool) Wait() []*TaskResult {
+	p.wg.Wait()
+	p.cancel()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	sort.Slice(p.results, func(i, j int) bool {
+		return p.results[i].Name < p.results[j].Name
+	})
+	return p.results
+}
+
+func (p *WorkerPool) add(result *TaskResult) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.results = append(p.results, result)
+}
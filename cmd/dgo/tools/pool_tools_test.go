@@ -0,0 +1,144 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolJobs(t *testing.T) {
+	for _, jobs := range []int{0, 1, 3} {
+		pool := NewWorkerPool(context.Background(), jobs, false)
+		lock := sync.Mutex{}
+		running, maxRunning := 0, 0
+		for i := 0; i < 10; i++ {
+			pool.Go(fmt.Sprintf("task-%02d", i), func(ctx context.Context) (string, []string, error) {
+				lock.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				lock.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				lock.Lock()
+				running--
+				lock.Unlock()
+				return "done", nil, nil
+			})
+		}
+		results := pool.Wait()
+		want := jobs
+		if want < 1 {
+			want = 1
+		}
+		if maxRunning > want {
+			t.Errorf("jobs %v: %v tasks are running at once", jobs, maxRunning)
+		}
+		if len(results) != 10 || results[0].Name != "task-00" || results[9].Name != "task-09" {
+			t.Errorf("jobs %v: results are not ordered by name: %v", jobs, results)
+		}
+		for _, r := range results {
+			if r.Status != "done" || r.Err != nil {
+				t.Errorf("jobs %v: unexpected result %+v", jobs, r)
+			}
+		}
+	}
+}
+
+func TestWorkerPoolFailFast(t *testing.T) {
+	pool := NewWorkerPool(context.Background(), 2, true)
+	started := make(chan struct{})
+	pool.Go("a-running", func(ctx context.Context) (string, []string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", nil, ctx.Err()
+	})
+	<-started
+	pool.Go("b-failed", func(ctx context.Context) (string, []string, error) {
+		return "", []string{"compile error"}, errors.New("failed")
+	})
+	// Wait till failure cancels the pool, so queued tasks are never started.
+	<-pool.ctx.Done()
+	pool.Go("c-queued", func(ctx context.Context) (string, []string, error) {
+		t.Error("queued task is started after failure")
+		return "done", nil, nil
+	})
+	results := map[string]*TaskResult{}
+	for _, r := range pool.Wait() {
+		results[r.Name] = r
+	}
+	if r := results["a-running"]; r.Status != StatusCanceled || r.Err == nil {
+		t.Errorf("running task should be canceled, got %+v", r)
+	}
+	if r := results["b-failed"]; r.Err == nil || len(r.Output) != 1 {
+		t.Errorf("failed task should keep its error and output, got %+v", r)
+	}
+	if r := results["c-queued"]; r.Status != StatusSkipped || r.Err != nil {
+		t.Errorf("queued task should be skipped, got %+v", r)
+	}
+}
+
+func TestWorkerPoolKeepGoing(t *testing.T) {
+	pool := NewWorkerPool(context.Background(), 1, false)
+	for i := 0; i < 5; i++ {
+		i := i
+		pool.Go(fmt.Sprintf("task-%v", i), func(ctx context.Context) (string, []string, error) {
+			if i%2 == 0 {
+				return "", nil, errors.Errorf("task %v failed", i)
+			}
+			// Tasks could schedule new ones.
+			pool.Go(fmt.Sprintf("task-%v-child", i), func(ctx context.Context) (string, []string, error) {
+				return "done", nil, ctx.Err()
+			})
+			return "done", nil, nil
+		})
+	}
+	results := pool.Wait()
+	if len(results) != 7 {
+		t.Fatalf("every task should be executed, got %v results", len(results))
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Status == StatusSkipped || r.Status == StatusCanceled {
+			t.Errorf("task %v should not be stopped", r.Name)
+		}
+		if r.Err != nil {
+			failed++
+		}
+	}
+	if failed != 3 {
+		t.Errorf("every error should be collected, got %v", failed)
+	}
+}
+
+func TestWorkerPoolParentCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pool := NewWorkerPool(ctx, 1, false)
+	pool.Go("task", func(ctx context.Context) (string, []string, error) {
+		t.Error("task is started with canceled context")
+		return "done", nil, nil
+	})
+	if results := pool.Wait(); len(results) != 1 || results[0].Status != StatusSkipped {
+		t.Errorf("task should be skipped, got %+v", results[0])
+	}
+}
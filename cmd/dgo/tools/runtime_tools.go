@@ -0,0 +1,383 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// RuntimeAuto - detect container runtime automatically.
+	RuntimeAuto = "auto"
+	// RuntimeDocker - docker, engine API is used if docker socket is available, else docker CLI.
+	RuntimeDocker = "docker"
+	// RuntimePodman - podman CLI, rootless mode is supported.
+	RuntimePodman = "podman"
+	// RuntimeNerdctl - containerd nerdctl CLI.
+	RuntimeNerdctl = "nerdctl"
+)
+
+// ContainerRuntime - a container engine used to build images and run test containers.
+type ContainerRuntime interface {
+	// Name - return a runtime name, like docker.
+	Name() string
+	// BuildImage - build an image from contextDir and return its id and build steps if they are known.
+	BuildImage(ctx context.Context, contextDir string, options *ImageBuildOptions) (string, []*BuildStep, error)
+	// BuildPlatforms - build an image for several platforms at once.
+	BuildPlatforms(ctx context.Context, contextDir string, platforms []Platform, options *ImageBuildOptions) error
+	// ListContainers - list running containers having all passed labels, label could be a "key" or "key=value".
+	ListContainers(ctx context.Context, labels ...string) ([]*Container, error)
+	// KillContainer - kill a running container.
+	KillContainer(ctx context.Context, id string) error
+	// RunContainer - run container, copy its output into stdout and stderr, return its exit code.
+	// If context is canceled, container is killed.
+	RunContainer(ctx context.Context, config *ContainerConfig, stdout, stderr io.Writer) (int, error)
+}
+
+// NewContainerRuntime - construct a container runtime by name, one of auto, docker, podman, nerdctl.
+func NewContainerRuntime(ctx context.Context, name string) (ContainerRuntime, error) {
+	if name == "" || name == RuntimeAuto {
+		name = DetectContainerRuntime(ctx)
+		logrus.Infof("Detected container runtime %v", name)
+	}
+	switch name {
+	case RuntimeDocker:
+		client := NewDockerClient("")
+		err := client.Ping(ctx)
+		if err == nil {
+			return &dockerRuntime{client: client, cli: &cliRuntime{binary: RuntimeDocker}}, nil
+		}
+		logrus.Infof("Docker engine API is not available, docker CLI is used: %v", err)
+		return &cliRuntime{binary: RuntimeDocker}, nil
+	case RuntimePodman, RuntimeNerdctl:
+		return &cliRuntime{binary: name}, nil
+	}
+	return nil, errors.Errorf("unknown container runtime %q, expected one of: auto, docker, podman, nerdctl", name)
+}
+
+// DetectContainerRuntime - return docker if docker socket is available, else first of docker, podman
+// and nerdctl found in PATH. docker is returned if nothing is found.
+func DetectContainerRuntime(ctx context.Context) string {
+	if NewDockerClient("").Ping(ctx) == nil {
+		return RuntimeDocker
+	}
+	for _, name := range []string{RuntimeDocker, RuntimePodman, RuntimeNerdctl} {
+		if _, err := exec.LookPath(name); err == nil {
+			return name
+		}
+	}
+	return RuntimeDocker
+}
+
+// dockerRuntime - docker engine API based runtime, images are built with docker CLI, so BuildKit is used and its
+// steps are reported. Engine API build, done with legacy builder, is used only if docker CLI is not installed.
+type dockerRuntime struct {
+	client *DockerClient
+	cli    *cliRuntime
+}
+
+func (r *dockerRuntime) Name() string {
+	return RuntimeDocker
+}
+
+func (r *dockerRuntime) BuildImage(ctx context.Context, contextDir string, options *ImageBuildOptions) (string, []*BuildStep, error) {
+	if _, err := exec.LookPath(r.cli.binary); err != nil {
+		logrus.Warnf("Docker CLI is not found, image is built with engine API without BuildKit: %v", err)
+		return r.client.ImageBuild(ctx, contextDir, options)
+	}
+	return r.cli.BuildImage(ctx, contextDir, options)
+}
+
+func (r *dockerRuntime) BuildPlatforms(ctx context.Context, contextDir string, platforms []Platform, options *ImageBuildOptions) error {
+	return r.cli.BuildPlatforms(ctx, contextDir, platforms, options)
+}
+
+func (r *dockerRuntime) ListContainers(ctx context.Context, labels ...string) ([]*Container, error) {
+	return r.client.ContainerList(ctx, labels...)
+}
+
+func (r *dockerRuntime) KillContainer(ctx context.Context, id string) error {
+	err := r.client.ContainerKill(ctx, id, "")
+	if IsDockerNotFound(err) || IsDockerConflict(err) {
+		// Container is already stopped.
+		return nil
+	}
+	return err
+}
+
+func (r *dockerRuntime) RunContainer(ctx context.Context, config *ContainerConfig, stdout, stderr io.Writer) (int, error) {
+	return r.client.ContainerRun(ctx, config, stdout, stderr)
+}
+
+// cliRuntime - a runtime driven by docker compatible CLI, like docker, podman or nerdctl.
+type cliRuntime struct {
+	binary string
+}
+
+func (r *cliRuntime) Name() string {
+	return r.binary
+}
+
+// buildArgs - translate build options into CLI arguments, context dir is passed as last argument.
+func (r *cliRuntime) buildArgs(options *ImageBuildOptions) []string {
+	args := []string{}
+	if options.Dockerfile != "" {
+		args = append(args, "--file", options.Dockerfile)
+	}
+	if options.Target != "" {
+		args = append(args, "--target", options.Target)
+	}
+	for _, t := range options.Tags {
+		args = append(args, "--tag", t)
+	}
+	if options.NoCache {
+		args = append(args, "--no-cache")
+	}
+	args = append(args, keyValueArgs("--build-arg", options.BuildArgs)...)
+	args = append(args, keyValueArgs("--label", options.Labels)...)
+	return append(args, ".")
+}
+
+func (r *cliRuntime) BuildImage(ctx context.Context, contextDir string, options *ImageBuildOptions) (string, []*BuildStep, error) {
+	// Only docker CLI supports BuildKit rawjson progress.
+	rawJSON := r.binary == RuntimeDocker && IsBuildKit(ctx, nil)
+	return cliImageBuild(ctx, r.binary, contextDir, r.buildArgs(options), rawJSON)
+}
+
+func (r *cliRuntime) BuildPlatforms(ctx context.Context, contextDir string, platforms []Platform, options *ImageBuildOptions) error {
+	platformNames := []string{}
+	for _, p := range platforms {
+		platformNames = append(platformNames, p.String())
+	}
+	if err := ValidateImageOutput(len(platforms), options); err != nil {
+		return err
+	}
+	buildCmd := []string{r.binary, "build", "--platform", strings.Join(platformNames, ",")}
+	var pushCmd []string
+	switch r.binary {
+	case RuntimeDocker:
+		buildCmd = []string{r.binary, "buildx", "build", "--platform", strings.Join(platformNames, ",")}
+		switch {
+		case options.Push:
+			buildCmd = append(buildCmd, "--push")
+		case options.Output == "":
+			// Only a single platform image could be loaded into local image store.
+			buildCmd = append(buildCmd, "--load")
+		}
+	case RuntimePodman:
+		// podman could build several platforms only into a manifest list, which is pushed with manifest push.
+		manifest := "localhost/" + strings.ToLower(filepath.Base(contextDir))
+		if len(options.Tags) > 0 {
+			manifest = options.Tags[0]
+		}
+		buildCmd = append(buildCmd, "--manifest", manifest)
+		if options.Push {
+			pushCmd = []string{r.binary, "manifest", "push", "--all", manifest, "docker://" + manifest}
+		}
+	default:
+		if options.Push {
+			// nerdctl pushes images with BuildKit image exporter.
+			buildCmd = append(buildCmd, "--output", fmt.Sprintf("type=image,name=%s,push=true", strings.Join(options.Tags, ",")))
+		}
+	}
+	if options.Output != "" {
+		buildCmd = append(buildCmd, "--output", options.Output)
+	}
+	if err := Exec(ctx, contextDir, append(buildCmd, r.buildArgs(options)...), nil); err != nil {
+		return err
+	}
+	if len(pushCmd) > 0 {
+		return Exec(ctx, contextDir, pushCmd, nil)
+	}
+	return nil
+}
+
+// ValidateImageOutput - check that an image built for several platforms is pushed or exported, since it could not
+// be loaded into local image store, a pushed image requires a tag.
+func ValidateImageOutput(platforms int, options *ImageBuildOptions) error {
+	if options.Push && options.Output != "" {
+		return errors.New("only one of --push and --image-output could be passed")
+	}
+	if options.Push && len(options.Tags) == 0 {
+		return errors.New("--push requires --image-tag")
+	}
+	if platforms > 1 && !options.Push && options.Output == "" {
+		return errors.New("image of several platforms should be pushed with --push or exported with --image-output, like type=oci,dest=image.tar")
+	}
+	return nil
+}
+
+func (r *cliRuntime) ListContainers(ctx context.Context, labels ...string) ([]*Container, error) {
+	listCmd := []string{r.binary, "ps"}
+	for _, l := range labels {
+		listCmd = append(listCmd, "--filter", "label="+l)
+	}
+	if r.binary == RuntimePodman {
+		listCmd = append(listCmd, "--format", "json")
+	} else {
+		listCmd = append(listCmd, "--format", "{{json .}}")
+	}
+	lines, err := ExecRead(ctx, "", listCmd, nil, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list containers: %v", strings.Join(lines, "\n"))
+	}
+	if r.binary == RuntimePodman {
+		// podman prints a json array with labels as map.
+		result := []*Container{}
+		if err = json.Unmarshal([]byte(strings.Join(lines, "\n")), &result); err != nil {
+			return nil, errors.Wrap(err, "failed to parse podman ps output")
+		}
+		return result, nil
+	}
+	// docker and nerdctl print a json object per line with names and labels as comma separated strings.
+	result := []*Container{}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		c := &struct {
+			ID     string
+			Image  string
+			Names  string
+			State  string
+			Labels string
+		}{}
+		if err = json.Unmarshal([]byte(line), c); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %v ps output", r.binary)
+		}
+		container := &Container{ID: c.ID, Image: c.Image, Names: strings.Split(c.Names, ","), State: c.State, Labels: map[string]string{}}
+		for _, l := range strings.Split(c.Labels, ",") {
+			if kv := strings.SplitN(l, "=", 2); len(kv) == 2 {
+				container.Labels[kv[0]] = kv[1]
+			} else if l != "" {
+				container.Labels[l] = ""
+			}
+		}
+		result = append(result, container)
+	}
+	return result, nil
+}
+
+func (r *cliRuntime) KillContainer(ctx context.Context, id string) error {
+	output, err := ExecRead(ctx, "", []string{r.binary, "kill", id}, nil, false)
+	if err != nil && isNotRunning(output) {
+		// Container is already stopped.
+		return nil
+	}
+	return err
+}
+
+func isNotRunning(output []string) bool {
+	text := strings.ToLower(strings.Join(output, "\n"))
+	return strings.Contains(text, "not running") || strings.Contains(text, "no such container") || strings.Contains(text, "not found")
+}
+
+// runArgs - translate container config into run CLI arguments.
+func (r *cliRuntime) runArgs(config *ContainerConfig, name string) []string {
+	args := []string{r.binary, "run", "--name", name}
+	if config.AutoRemove {
+		args = append(args, "--rm")
+	}
+	for _, e := range config.Env {
+		args = append(args, "--env", e)
+	}
+	args = append(args, keyValueArgs("--label", config.Labels)...)
+	hostPorts := []int{}
+	for hostPort := range config.Ports {
+		hostPorts = append(hostPorts, hostPort)
+	}
+	sort.Ints(hostPorts)
+	for _, hostPort := range hostPorts {
+		args = append(args, "--publish", fmt.Sprintf("%d:%d", hostPort, config.Ports[hostPort]))
+	}
+	hostPaths := []string{}
+	for hostPath := range config.Mounts {
+		hostPaths = append(hostPaths, hostPath)
+	}
+	sort.Strings(hostPaths)
+	for _, hostPath := range hostPaths {
+		args = append(args, "--volume", hostPath+":"+config.Mounts[hostPath])
+	}
+	return append(append(args, config.Image), config.Cmd...)
+}
+
+func (r *cliRuntime) RunContainer(ctx context.Context, config *ContainerConfig, stdout, stderr io.Writer) (int, error) {
+	// A name is required to kill container, killing CLI process doesn't stop container.
+	name := config.Name
+	if name == "" {
+		name = fmt.Sprintf("dgo-%d", time.Now().UnixNano())
+	}
+	args := r.runArgs(config, name)
+	logrus.Infof("Running %v", args)
+	// #nosec
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return -1, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				return status.ExitStatus(), nil
+			}
+		}
+		if err != nil {
+			return -1, err
+		}
+		return 0, nil
+	case <-ctx.Done():
+		logrus.Infof("Killing container %v", name)
+		if err := r.KillContainer(context.Background(), name); err != nil {
+			logrus.Warnf("Failed to kill container %v: %v", name, err)
+		}
+		// nerdctl doesn't remove killed containers with --rm, so remove it explicitly.
+		_, _ = ExecRead(context.Background(), "", []string{r.binary, "rm", "--force", name}, nil, false)
+		<-done
+		return -1, ctx.Err()
+	}
+}
+
+// keyValueArgs - translate map into sorted list of flag key=value arguments.
+func keyValueArgs(flag string, values map[string]string) []string {
+	keys := []string{}
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	args := []string{}
+	for _, k := range keys {
+		args = append(args, flag, k+"="+values[k])
+	}
+	return args
+}
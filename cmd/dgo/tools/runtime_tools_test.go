@@ -0,0 +1,45 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"testing"
+)
+
+func TestValidateImageOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		platforms int
+		options   ImageBuildOptions
+		wantErr   bool
+	}{
+		{name: "single platform is loaded", platforms: 1},
+		{name: "several platforms without output", platforms: 2, wantErr: true},
+		{name: "several platforms pushed", platforms: 2, options: ImageBuildOptions{Push: true, Tags: []string{"r/app:1"}}},
+		{name: "push without tag", platforms: 2, options: ImageBuildOptions{Push: true}, wantErr: true},
+		{name: "several platforms exported", platforms: 2, options: ImageBuildOptions{Output: "type=oci,dest=image.tar"}},
+		{name: "push and output", platforms: 2, options: ImageBuildOptions{Push: true, Tags: []string{"r/app:1"}, Output: "type=oci,dest=image.tar"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			if err := ValidateImageOutput(tt.platforms, &options); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateImageOutput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
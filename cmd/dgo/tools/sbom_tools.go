@@ -0,0 +1,340 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// CycloneDXSuffix - a suffix of CycloneDX SBOM file stored next to binary.
+	CycloneDXSuffix = ".cdx.json"
+	// SPDXSuffix - a suffix of SPDX SBOM file stored next to binary.
+	SPDXSuffix = ".spdx.json"
+	// ImageSBOMName - a name of aggregated SBOM of all applications of image, stored with both suffixes.
+	ImageSBOMName = "dgo-sbom"
+)
+
+// SBOMModule - a go module linked into binary.
+type SBOMModule struct {
+	Path    string
+	Version string
+	// Sum - a go.sum hash of module, like h1:base64
+	Sum string
+}
+
+// PURL - return a package url of module.
+func (m *SBOMModule) PURL() string {
+	if m.Version == "" {
+		return "pkg:golang/" + m.Path
+	}
+	return fmt.Sprintf("pkg:golang/%s@%s", m.Path, m.Version)
+}
+
+// goSumProperty - a name of property with go.sum hash of module. h1 hash is a hash of a list of module file hashes,
+// not of module zip, so it is not a checksum of any artifact and could not be passed as one.
+const goSumProperty = "go.sum:h1"
+
+// SBOMBinary - a binary with modules and build settings read from build info embedded by go build.
+type SBOMBinary struct {
+	Name      string
+	SHA256    string
+	GoVersion string
+	Package   string
+	Main      *SBOMModule
+	Deps      []*SBOMModule
+	Settings  []debug.BuildSetting
+}
+
+// ReadSBOMBinary - read build info embedded into binary.
+func ReadSBOMBinary(fileName string) (*SBOMBinary, error) {
+	info, err := buildinfo.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read build info of %v", fileName)
+	}
+	sha, err := FileHash(fileName)
+	if err != nil {
+		return nil, err
+	}
+	b := &SBOMBinary{
+		Name:      filepath.Base(fileName),
+		SHA256:    sha,
+		GoVersion: info.GoVersion,
+		Package:   info.Path,
+		Main:      &SBOMModule{Path: info.Main.Path, Version: info.Main.Version, Sum: info.Main.Sum},
+		Settings:  info.Settings,
+	}
+	if b.Main.Version == "(devel)" {
+		// Main module version is not known if it is built without VCS information.
+		b.Main.Version = ""
+	}
+	for _, d := range info.Deps {
+		m := &SBOMModule{Path: d.Path, Version: d.Version, Sum: d.Sum}
+		if d.Replace != nil {
+			// Replacement is linked, a local replacement has no version, so only module path is known.
+			m = &SBOMModule{Path: d.Replace.Path, Version: d.Replace.Version, Sum: d.Replace.Sum}
+			if isLocalPath(d.Replace.Path) {
+				m = &SBOMModule{Path: d.Path}
+			}
+		}
+		b.Deps = append(b.Deps, m)
+	}
+	return b, nil
+}
+
+// stdlib - return a standard library as module, it is linked into every binary.
+func (b *SBOMBinary) stdlib() *SBOMModule {
+	return &SBOMModule{Path: "stdlib", Version: b.GoVersion}
+}
+
+// documentID - a stable id of document built from binaries hashes, so same binaries produce same document.
+func documentID(name string, binaries []*SBOMBinary) string {
+	hash := sha256.New()
+	_, _ = hash.Write([]byte(name))
+	for _, b := range binaries {
+		_, _ = hash.Write([]byte(b.SHA256))
+	}
+	sum := hash.Sum(nil)
+	// Format as UUID version 5 like value.
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxComponent struct {
+	Type       string         `json:"type"`
+	BomRef     string         `json:"bom-ref"`
+	Name       string         `json:"name"`
+	Version    string         `json:"version,omitempty"`
+	PURL       string         `json:"purl,omitempty"`
+	Hashes     []*cdxHash     `json:"hashes,omitempty"`
+	Properties []*cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxTool struct {
+	Name string `json:"name"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+type cdxDocument struct {
+	BomFormat    string `json:"bomFormat"`
+	SpecVersion  string `json:"specVersion"`
+	SerialNumber string `json:"serialNumber"`
+	Version      int    `json:"version"`
+	Metadata     struct {
+		Timestamp string        `json:"timestamp"`
+		Tools     []*cdxTool    `json:"tools"`
+		Component *cdxComponent `json:"component"`
+	} `json:"metadata"`
+	Components   []*cdxComponent  `json:"components"`
+	Dependencies []*cdxDependency `json:"dependencies"`
+}
+
+// CycloneDX - build a CycloneDX 1.4 document of a binary, if image is passed binaries are described as components
+// of a container with passed name.
+func CycloneDX(name string, binaries []*SBOMBinary, image bool, created time.Time) ([]byte, error) {
+	doc := &cdxDocument{BomFormat: "CycloneDX", SpecVersion: "1.4", SerialNumber: "urn:uuid:" + documentID(name, binaries), Version: 1}
+	doc.Metadata.Timestamp = created.UTC().Format(time.RFC3339)
+	doc.Metadata.Tools = []*cdxTool{{Name: "dgo"}}
+
+	components := map[string]*cdxComponent{}
+	dependencies := []*cdxDependency{}
+	for _, b := range binaries {
+		app := &cdxComponent{Type: "application", BomRef: "binary:" + b.Name, Name: b.Name, Version: b.Main.Version,
+			PURL: b.Main.PURL(), Hashes: []*cdxHash{{Alg: "SHA-256", Content: b.SHA256}}}
+		app.Properties = append(app.Properties, &cdxProperty{Name: "go.package", Value: b.Package})
+		for _, s := range b.Settings {
+			app.Properties = append(app.Properties, &cdxProperty{Name: "go.buildsetting:" + s.Key, Value: s.Value})
+		}
+		dependency := &cdxDependency{Ref: app.BomRef, DependsOn: []string{}}
+		for _, m := range append([]*SBOMModule{b.stdlib()}, b.Deps...) {
+			purl := m.PURL()
+			if _, ok := components[purl]; !ok {
+				c := &cdxComponent{Type: "library", BomRef: purl, Name: m.Path, Version: m.Version, PURL: purl}
+				if m.Sum != "" {
+					c.Properties = []*cdxProperty{{Name: goSumProperty, Value: m.Sum}}
+				}
+				components[purl] = c
+			}
+			dependency.DependsOn = append(dependency.DependsOn, purl)
+		}
+		dependencies = append(dependencies, dependency)
+		if image {
+			components[app.BomRef] = app
+		} else {
+			doc.Metadata.Component = app
+		}
+	}
+	if image {
+		doc.Metadata.Component = &cdxComponent{Type: "container", BomRef: "image:" + name, Name: name}
+		root := &cdxDependency{Ref: doc.Metadata.Component.BomRef, DependsOn: []string{}}
+		for _, b := range binaries {
+			root.DependsOn = append(root.DependsOn, "binary:"+b.Name)
+		}
+		dependencies = append([]*cdxDependency{root}, dependencies...)
+	}
+	refs := []string{}
+	for ref := range components {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		doc.Components = append(doc.Components, components[ref])
+	}
+	doc.Dependencies = dependencies
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxPackage struct {
+	Name             string             `json:"name"`
+	SPDXID           string             `json:"SPDXID"`
+	VersionInfo      string             `json:"versionInfo,omitempty"`
+	DownloadLocation string             `json:"downloadLocation"`
+	FilesAnalyzed    bool               `json:"filesAnalyzed"`
+	LicenseConcluded string             `json:"licenseConcluded"`
+	LicenseDeclared  string             `json:"licenseDeclared"`
+	CopyrightText    string             `json:"copyrightText"`
+	Checksums        []*spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []*spdxExternalRef `json:"externalRefs,omitempty"`
+	Comment          string             `json:"comment,omitempty"`
+}
+
+type spdxRelationship struct {
+	SpdxElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSpdxElement string `json:"relatedSpdxElement"`
+}
+
+type spdxDocument struct {
+	SPDXVersion       string `json:"spdxVersion"`
+	DataLicense       string `json:"dataLicense"`
+	SPDXID            string `json:"SPDXID"`
+	Name              string `json:"name"`
+	DocumentNamespace string `json:"documentNamespace"`
+	CreationInfo      struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+	} `json:"creationInfo"`
+	Packages      []*spdxPackage      `json:"packages"`
+	Relationships []*spdxRelationship `json:"relationships"`
+}
+
+// SPDX - build an SPDX 2.3 document describing binaries and modules they depend on, if image is passed document
+// describes a container with passed name containing binaries.
+func SPDX(name string, binaries []*SBOMBinary, image bool, created time.Time) ([]byte, error) {
+	doc := &spdxDocument{SPDXVersion: "SPDX-2.3", DataLicense: "CC0-1.0", SPDXID: "SPDXRef-DOCUMENT", Name: name,
+		DocumentNamespace: "https://github.com/haiodo/dgo/spdx/" + name + "-" + documentID(name, binaries)}
+	doc.CreationInfo.Created = created.UTC().Format(time.RFC3339)
+	doc.CreationInfo.Creators = []string{"Tool: dgo"}
+
+	newPackage := func(id, name, version string) *spdxPackage {
+		return &spdxPackage{Name: name, SPDXID: id, VersionInfo: version, DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION", LicenseDeclared: "NOASSERTION", CopyrightText: "NOASSERTION"}
+	}
+	imageID := "SPDXRef-Image-" + SafeName(name)
+	if image {
+		doc.Packages = append(doc.Packages, newPackage(imageID, name, ""))
+		doc.Relationships = append(doc.Relationships, &spdxRelationship{SpdxElementID: doc.SPDXID, RelationshipType: "DESCRIBES", RelatedSpdxElement: imageID})
+	}
+	modules := map[string]string{}
+	for i, b := range binaries {
+		binaryID := fmt.Sprintf("SPDXRef-Binary-%d-%s", i, SafeName(b.Name))
+		p := newPackage(binaryID, b.Name, b.Main.Version)
+		p.Checksums = []*spdxChecksum{{Algorithm: "SHA256", ChecksumValue: b.SHA256}}
+		p.ExternalRefs = []*spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: b.Main.PURL()}}
+		settings := []string{"go.package=" + b.Package}
+		for _, s := range b.Settings {
+			settings = append(settings, s.Key+"="+s.Value)
+		}
+		p.Comment = strings.Join(settings, "\n")
+		doc.Packages = append(doc.Packages, p)
+		if image {
+			doc.Relationships = append(doc.Relationships, &spdxRelationship{SpdxElementID: imageID, RelationshipType: "CONTAINS", RelatedSpdxElement: binaryID})
+		} else {
+			doc.Relationships = append(doc.Relationships, &spdxRelationship{SpdxElementID: doc.SPDXID, RelationshipType: "DESCRIBES", RelatedSpdxElement: binaryID})
+		}
+
+		for _, m := range append([]*SBOMModule{b.stdlib()}, b.Deps...) {
+			purl := m.PURL()
+			moduleID, ok := modules[purl]
+			if !ok {
+				moduleID = fmt.Sprintf("SPDXRef-Module-%d-%s", len(modules), SafeName(m.Path))
+				modules[purl] = moduleID
+				mp := newPackage(moduleID, m.Path, m.Version)
+				if m.Sum != "" {
+					mp.Comment = goSumProperty + "=" + m.Sum
+				}
+				mp.ExternalRefs = []*spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: purl}}
+				doc.Packages = append(doc.Packages, mp)
+			}
+			doc.Relationships = append(doc.Relationships, &spdxRelationship{SpdxElementID: binaryID, RelationshipType: "DEPENDS_ON", RelatedSpdxElement: moduleID})
+		}
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// WriteSBOM - store CycloneDX and SPDX documents with passed name into folder as ${fileName}.cdx.json and ${fileName}.spdx.json
+func WriteSBOM(folder, fileName, name string, binaries []*SBOMBinary, image bool, created time.Time) error {
+	for suffix, generate := range map[string]func(string, []*SBOMBinary, bool, time.Time) ([]byte, error){
+		CycloneDXSuffix: CycloneDX,
+		SPDXSuffix:      SPDX,
+	} {
+		content, err := generate(name, binaries, image, created)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(filepath.Join(folder, fileName+suffix), content, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"encoding/json"
+	"os"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSBOMBinary() *SBOMBinary {
+	return &SBOMBinary{
+		Name:      "app",
+		SHA256:    "0123abcd",
+		GoVersion: "go1.21.0",
+		Package:   "example.com/app/cmd/app",
+		Main:      &SBOMModule{Path: "example.com/app", Version: "v1.2.3"},
+		Deps: []*SBOMModule{
+			{Path: "github.com/pkg/errors", Version: "v0.9.1", Sum: "h1:FEBLx1zS214owpjy7qsBeixbURkuhQAwrK5UwLGTwt4="},
+			{Path: "example.com/local"},
+		},
+		Settings: []debug.BuildSetting{{Key: "CGO_ENABLED", Value: "0"}},
+	}
+}
+
+func TestCycloneDX(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	content, err := CycloneDX("app", []*SBOMBinary{testSBOMBinary()}, false, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &cdxDocument{}
+	if err = json.Unmarshal(content, doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Metadata.Component.Name != "app" || doc.Metadata.Component.Hashes[0].Content != "0123abcd" {
+		t.Errorf("unexpected binary component %+v", doc.Metadata.Component)
+	}
+	if doc.Metadata.Timestamp != "2020-01-02T03:04:05Z" {
+		t.Errorf("unexpected timestamp %v", doc.Metadata.Timestamp)
+	}
+	components := map[string]*cdxComponent{}
+	for _, c := range doc.Components {
+		components[c.PURL] = c
+	}
+	errorsModule := components["pkg:golang/github.com/pkg/errors@v0.9.1"]
+	if errorsModule == nil {
+		t.Fatalf("module component is not found in %v", string(content))
+	}
+	// go.sum h1 hash is not a hash of module artifact.
+	if len(errorsModule.Hashes) != 0 {
+		t.Errorf("module should not have hashes: %+v", errorsModule.Hashes)
+	}
+	if len(errorsModule.Properties) != 1 || errorsModule.Properties[0].Name != "go.sum:h1" ||
+		errorsModule.Properties[0].Value != "h1:FEBLx1zS214owpjy7qsBeixbURkuhQAwrK5UwLGTwt4=" {
+		t.Errorf("unexpected module properties %+v", errorsModule.Properties)
+	}
+	if c := components["pkg:golang/example.com/local"]; c == nil || len(c.Properties) != 0 {
+		t.Errorf("local module without version and hash is expected: %+v", c)
+	}
+	if components["pkg:golang/stdlib@go1.21.0"] == nil {
+		t.Errorf("stdlib component is not found")
+	}
+	if len(doc.Dependencies) != 1 || len(doc.Dependencies[0].DependsOn) != 3 {
+		t.Errorf("unexpected dependencies %+v", doc.Dependencies)
+	}
+
+	again, err := CycloneDX("app", []*SBOMBinary{testSBOMBinary()}, false, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(content) {
+		t.Errorf("document should be stable for same binaries")
+	}
+}
+
+func TestCycloneDXImage(t *testing.T) {
+	other := testSBOMBinary()
+	other.Name = "other"
+	content, err := CycloneDX("image", []*SBOMBinary{testSBOMBinary(), other}, true, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &cdxDocument{}
+	if err = json.Unmarshal(content, doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Metadata.Component.Type != "container" {
+		t.Errorf("image should be described as container: %+v", doc.Metadata.Component)
+	}
+	if root := doc.Dependencies[0]; root.Ref != "image:image" || strings.Join(root.DependsOn, ",") != "binary:app,binary:other" {
+		t.Errorf("unexpected image dependency %+v", root)
+	}
+}
+
+func TestSPDX(t *testing.T) {
+	content, err := SPDX("app", []*SBOMBinary{testSBOMBinary()}, false, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &spdxDocument{}
+	if err = json.Unmarshal(content, doc); err != nil {
+		t.Fatal(err)
+	}
+	var binary, module *spdxPackage
+	for _, p := range doc.Packages {
+		switch p.Name {
+		case "app":
+			binary = p
+		case "github.com/pkg/errors":
+			module = p
+		}
+	}
+	if binary == nil || len(binary.Checksums) != 1 || binary.Checksums[0].ChecksumValue != "0123abcd" {
+		t.Fatalf("unexpected binary package %+v", binary)
+	}
+	if module == nil || len(module.Checksums) != 0 || module.Comment != "go.sum:h1=h1:FEBLx1zS214owpjy7qsBeixbURkuhQAwrK5UwLGTwt4=" {
+		t.Fatalf("unexpected module package %+v", module)
+	}
+	dependsOn := 0
+	for _, r := range doc.Relationships {
+		if r.RelationshipType == "DEPENDS_ON" {
+			dependsOn++
+		}
+	}
+	if dependsOn != 3 {
+		t.Errorf("expected 3 dependencies, got %v", dependsOn)
+	}
+}
+
+func TestReadSBOMBinary(t *testing.T) {
+	// Test binary has build info embedded by go test.
+	b, err := ReadSBOMBinary(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.GoVersion == "" || b.SHA256 == "" || b.Main.Path != "github.com/haiodo/dgo" {
+		t.Errorf("unexpected build info %+v %+v", b, b.Main)
+	}
+	if _, err = ReadSBOMBinary("sbom_tools.go"); err == nil {
+		t.Errorf("error is expected for file without build info")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"debug/buildinfo"
+	"debug/elf"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SizeReportFileName - a name of binary size report stored inside state folder of output folder, used as baseline by next build.
+const SizeReportFileName = "dgo-size.json"
+
+const (
+	// StdModule - a name of dependency standard library packages are grouped into.
+	StdModule = "std"
+	// OtherPackage - a name of package symbols without package are grouped into, like C or linker symbols.
+	OtherPackage = "(other)"
+)
+
+// BinarySize - a size of binary with sizes of symbols grouped by package and by module.
+type BinarySize struct {
+	Size int64 `json:"size"`
+	// Packages - a sum of symbol sizes per package import path.
+	Packages map[string]int64 `json:"packages,omitempty"`
+	// Modules - a sum of symbol sizes per module path, std for standard library.
+	Modules map[string]int64 `json:"modules,omitempty"`
+}
+
+// SizeReport - sizes of all binaries of build by path relative to output folder.
+type SizeReport struct {
+	Binaries map[string]*BinarySize `json:"binaries"`
+}
+
+// ReadSizeReport - read a size report from folder.
+func ReadSizeReport(folder string) (*SizeReport, error) {
+	content, err := ioutil.ReadFile(path.Join(folder, SizeReportFileName))
+	if err != nil {
+		return nil, err
+	}
+	r := &SizeReport{}
+	if err = json.Unmarshal(content, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write - store size report into folder.
+func (r *SizeReport) Write(folder string) error {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(folder, os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(folder, SizeReportFileName), content, 0600)
+}
+
+// ReadBinarySize - return a size of binary, if it is ELF with symbol table, sizes of symbols are grouped by package
+// and by module using module information embedded by go build.
+func ReadBinarySize(fileName string) (*BinarySize, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return nil, err
+	}
+	result := &BinarySize{Size: info.Size()}
+	file, err := elf.Open(fileName)
+	if err != nil {
+		// Not an ELF binary, like darwin or windows one.
+		return result, nil
+	}
+	defer func() { _ = file.Close() }()
+	symbols, err := file.Symbols()
+	if err != nil {
+		// Symbol table is stripped.
+		return result, nil
+	}
+
+	modules := []string{}
+	mainModule := OtherPackage
+	if bi, err := buildinfo.ReadFile(fileName); err == nil {
+		mainModule = bi.Main.Path
+		modules = append(modules, bi.Main.Path)
+		for _, d := range bi.Deps {
+			modules = append(modules, d.Path)
+		}
+	}
+	// Longest module path is checked first, so nested modules are matched.
+	sort.Slice(modules, func(i, j int) bool { return len(modules[i]) > len(modules[j]) })
+
+	result.Packages = map[string]int64{}
+	result.Modules = map[string]int64{}
+	for _, s := range symbols {
+		if s.Size == 0 || elf.ST_TYPE(s.Info) == elf.STT_SECTION || elf.ST_TYPE(s.Info) == elf.STT_FILE {
+			continue
+		}
+		pkg := SymbolPackage(s.Name)
+		result.Packages[pkg] += int64(s.Size)
+		if pkg == "main" {
+			result.Modules[mainModule] += int64(s.Size)
+		} else {
+			result.Modules[packageModule(modules, pkg)] += int64(s.Size)
+		}
+	}
+	return result, nil
+}
+
+// SymbolPackage - return an import path of package go symbol belongs to, like example.com/app/pkg for
+// example.com/app/pkg.(*Type).Method or type:*example.com/app/pkg.Type
+func SymbolPackage(name string) string {
+	for _, prefix := range []string{"type:", "type.", "go:itab.", "go.itab."} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	name = strings.TrimLeft(name, "*[]")
+	if strings.HasPrefix(name, "go:") || strings.HasPrefix(name, "go.") {
+		// Linker generated symbols, like go:buildinfo
+		return OtherPackage
+	}
+	// Type parameters and receivers could contain other import paths.
+	if pos := strings.IndexAny(name, "[("); pos != -1 {
+		name = name[:pos]
+	}
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot <= 0 {
+		return OtherPackage
+	}
+	return name[:slash+1+dot]
+}
+
+// packageModule - return a module of package, modules should be sorted from longest to shortest path.
+func packageModule(modules []string, pkg string) string {
+	for _, m := range modules {
+		if pkg == m || strings.HasPrefix(pkg, m+"/") {
+			return m
+		}
+	}
+	if pkg == OtherPackage {
+		return OtherPackage
+	}
+	if first := strings.Split(pkg, "/")[0]; !strings.Contains(first, ".") {
+		return StdModule
+	}
+	return OtherPackage
+}
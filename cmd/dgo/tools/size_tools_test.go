@@ -0,0 +1,72 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"testing"
+)
+
+func TestSymbolPackage(t *testing.T) {
+	tests := []struct {
+		symbol string
+		want   string
+	}{
+		{"main.main", "main"},
+		{"runtime.gcBgMarkWorker.func1", "runtime"},
+		{"sync/atomic.(*Int64).Add", "sync/atomic"},
+		{"example.com/app/pkg.(*Type).Method", "example.com/app/pkg"},
+		{"example.com/app/pkg.Func.func2", "example.com/app/pkg"},
+		{"type:*example.com/app/pkg.Type", "example.com/app/pkg"},
+		{"type.*example.com/app/pkg.Type", "example.com/app/pkg"},
+		{"type:[]example.com/app/pkg.Type", "example.com/app/pkg"},
+		{"go:itab.*example.com/app/pkg.T,io.Reader", "example.com/app/pkg"},
+		{"example.com/app/pkg.Map[go.shape.int,example.com/other.T]", "example.com/app/pkg"},
+		{"example.com/app/pkg.(*List[go.shape.string]).Push", "example.com/app/pkg"},
+		// Dots of last path element are escaped by linker.
+		{"gopkg.in/yaml%2ev2.(*parser).parse", "gopkg.in/yaml%2ev2"},
+		{"go:buildinfo", OtherPackage},
+		{"go.string.*", OtherPackage},
+		{"type:.eq.[2]interface {}", OtherPackage},
+		{"noPackageSymbol", OtherPackage},
+	}
+	for _, tt := range tests {
+		if got := SymbolPackage(tt.symbol); got != tt.want {
+			t.Errorf("SymbolPackage(%q) = %q, want %q", tt.symbol, got, tt.want)
+		}
+	}
+}
+
+func TestPackageModule(t *testing.T) {
+	modules := []string{"example.com/app/tools", "example.com/app"}
+	tests := []struct {
+		pkg  string
+		want string
+	}{
+		{"example.com/app", "example.com/app"},
+		{"example.com/app/pkg", "example.com/app"},
+		{"example.com/app/tools/x", "example.com/app/tools"},
+		{"example.com/application", OtherPackage},
+		{"net/http", StdModule},
+		{"runtime", StdModule},
+		{OtherPackage, OtherPackage},
+	}
+	for _, tt := range tests {
+		if got := packageModule(modules, tt.pkg); got != tt.want {
+			t.Errorf("packageModule(%q) = %q, want %q", tt.pkg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Test event actions, same as go test -json ones.
+const (
+	TestActionRun    = "run"
+	TestActionPause  = "pause"
+	TestActionCont   = "cont"
+	TestActionPass   = "pass"
+	TestActionFail   = "fail"
+	TestActionSkip   = "skip"
+	TestActionOutput = "output"
+)
+
+// TestStatusFlaky - a status of test which is failed and then passed when it is executed again.
+const TestStatusFlaky = "flaky"
+
+const (
+	// TestReportName - a name of JSON test report.
+	TestReportName = "dgo-tests.json"
+	// JUnitReportName - a name of JUnit XML test report.
+	JUnitReportName = "junit.xml"
+)
+
+// testFrameMarker - a marker of framing lines printed by test binaries executed with -test.v=test2json.
+const testFrameMarker = "\x16"
+
+var (
+	testFrameReg  = regexp.MustCompile(`^=== (RUN|PAUSE|CONT|NAME)\s*(.*)$`)
+	testResultReg = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): (.+) \(([0-9.]+)s\)$`)
+	// Error output is highlighted with shift out and shift in characters.
+	testHighlightReplacer = strings.NewReplacer("\x0e", "", "\x0f", "")
+)
+
+// TestEventConverter - convert output of test binary executed with -test.v=test2json into test events,
+// like go tool test2json does.
+type TestEventConverter struct {
+	pkg   string
+	start time.Time
+	test  string
+	emit  func(e *TestEvent)
+}
+
+// NewTestEventConverter - create a converter of package output, every event is passed to emit.
+func NewTestEventConverter(pkg string, emit func(e *TestEvent)) *TestEventConverter {
+	return &TestEventConverter{pkg: pkg, start: time.Now(), emit: emit}
+}
+
+// Line - convert a line of test binary output.
+func (c *TestEventConverter) Line(line string) {
+	text := testHighlightReplacer.Replace(strings.Replace(line, testFrameMarker, "", 1))
+	if strings.HasPrefix(line, testFrameMarker) {
+		if m := testFrameReg.FindStringSubmatch(text); m != nil {
+			c.test = m[2]
+			switch m[1] {
+			case "RUN":
+				c.event(TestActionRun, "", 0)
+			case "PAUSE":
+				c.event(TestActionPause, "", 0)
+			case "CONT":
+				c.event(TestActionCont, "", 0)
+			case "NAME":
+				// Only switch output to another test.
+				return
+			}
+			c.event(TestActionOutput, text+"\n", 0)
+			return
+		}
+	}
+	if m := testResultReg.FindStringSubmatch(text); m != nil {
+		c.test = m[2]
+		elapsed, _ := strconv.ParseFloat(m[3], 64)
+		c.event(TestActionOutput, text+"\n", 0)
+		c.event(strings.ToLower(m[1]), "", elapsed)
+		c.test = ""
+		return
+	}
+	c.event(TestActionOutput, text+"\n", 0)
+}
+
+// Exit - emit a package result, package is failed if test binary is exited with error.
+func (c *TestEventConverter) Exit(err error) {
+	c.test = ""
+	if err != nil {
+		c.event(TestActionOutput, fmt.Sprintf("%v\n", err), 0)
+		c.event(TestActionFail, "", time.Since(c.start).Seconds())
+		return
+	}
+	c.event(TestActionPass, "", time.Since(c.start).Seconds())
+}
+
+func (c *TestEventConverter) event(action, output string, elapsed float64) {
+	c.emit(&TestEvent{
+		Time:    time.Now(),
+		Action:  action,
+		Package: c.pkg,
+		Test:    c.test,
+		Elapsed: elapsed,
+		Output:  output,
+	})
+}
+
+// ReadTestEvents - read test events stored as JSON lines, like go test -json output.
+func ReadTestEvents(fileName string) ([]*TestEvent, error) {
+	content, err := ioutil.ReadFile(filepath.Clean(fileName))
+	if err != nil {
+		return nil, err
+	}
+	events := []*TestEvent{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		e := &TestEvent{}
+		if err = json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// WriteTestEvents - store test events as JSON lines.
+func WriteTestEvents(fileName string, events []*TestEvent) error {
+	content := bytes.Buffer{}
+	encoder := json.NewEncoder(&content)
+	for _, e := range events {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(fileName, content.Bytes(), 0600)
+}
+
+// TestCase - a result of one test.
+type TestCase struct {
+	Name    string   `json:"name"`
+	Status  string   `json:"status"`
+	Elapsed float64  `json:"elapsed"`
+	Output  []string `json:"output,omitempty"`
+}
+
+// TestPackage - results of all tests of package executed by test binary.
+type TestPackage struct {
+	Package string      `json:"package"`
+	Binary  string      `json:"binary"`
+	Status  string      `json:"status"`
+	Start   time.Time   `json:"start"`
+	Elapsed float64     `json:"elapsed"`
+	Tests   []*TestCase `json:"tests"`
+	// Output - output printed outside of tests, like package panic.
+	Output []string `json:"output,omitempty"`
+}
+
+// TestReport - results of all test binaries.
+type TestReport struct {
+	Packages []*TestPackage `json:"packages"`
+	Passed   int            `json:"passed"`
+	Failed   int            `json:"failed"`
+	Skipped  int            `json:"skipped"`
+	Flaky    int            `json:"flaky"`
+}
+
+// ReadTestReport - read a JSON test report.
+func ReadTestReport(fileName string) (*TestReport, error) {
+	content, err := ioutil.ReadFile(filepath.Clean(fileName))
+	if err != nil {
+		return nil, err
+	}
+	r := &TestReport{}
+	if err = json.Unmarshal(content, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Add - add results of test binary from its test events, events could contain results of several executions of binary,
+// like ones with different tests selected or retries of failed tests. Tests which are started, but have no result,
+// like ones interrupted by panic or timeout, are failed. Tests which are failed by one execution and passed by a later
+// one are flaky. Package is failed if any test is failed, or if its execution is failed without any failed test.
+func (r *TestReport) Add(binary string, events []*TestEvent) *TestPackage {
+	pkg := &TestPackage{Binary: binary, Tests: []*TestCase{}}
+	tests := map[string]*TestCase{}
+	running := map[string]bool{}
+	failed := map[string]bool{}
+	exitFailed := false
+	for _, e := range events {
+		if pkg.Start.IsZero() {
+			pkg.Start = e.Time
+		}
+		pkg.Package = e.Package
+		if e.Test == "" {
+			switch e.Action {
+			case TestActionOutput:
+				pkg.Output = append(pkg.Output, strings.TrimSuffix(e.Output, "\n"))
+			case TestActionPass, TestActionFail, TestActionSkip:
+				// Execution is complete, so tests without result are interrupted.
+				for name := range running {
+					tests[name].Status = TestActionFail
+					failed[name] = true
+				}
+				running = map[string]bool{}
+				if e.Action == TestActionFail {
+					exitFailed = true
+				} else if pkg.Status != TestActionPass {
+					pkg.Status = e.Action
+				}
+				pkg.Elapsed += e.Elapsed
+			}
+			continue
+		}
+		test, ok := tests[e.Test]
+		if !ok {
+			test = &TestCase{Name: e.Test, Status: TestActionFail}
+			tests[e.Test] = test
+			pkg.Tests = append(pkg.Tests, test)
+		}
+		switch e.Action {
+		case TestActionRun:
+			running[e.Test] = true
+		case TestActionOutput:
+			test.Output = append(test.Output, strings.TrimSuffix(e.Output, "\n"))
+		case TestActionPass, TestActionFail, TestActionSkip:
+			delete(running, e.Test)
+			test.Status = e.Action
+			test.Elapsed = e.Elapsed
+			if e.Action == TestActionFail {
+				failed[e.Test] = true
+			}
+		}
+	}
+	for name := range running {
+		// Test binary is not exited, like container is killed.
+		failed[name] = true
+	}
+	testFailed := false
+	for _, t := range pkg.Tests {
+		switch {
+		case t.Status == TestActionPass && failed[t.Name]:
+			t.Status = TestStatusFlaky
+			r.Flaky++
+		case t.Status == TestActionPass:
+			r.Passed++
+		case t.Status == TestActionSkip:
+			r.Skipped++
+		default:
+			r.Failed++
+			testFailed = true
+		}
+	}
+	switch {
+	case testFailed, pkg.Status == "", exitFailed && len(failed) == 0:
+		// Package is failed by its tests, it is not exited or it is failed outside of tests, like panic in TestMain.
+		pkg.Status = TestActionFail
+	case exitFailed:
+		// Failed executions are caused by flaky tests only.
+		pkg.Status = TestActionPass
+	}
+	r.Packages = append(r.Packages, pkg)
+	sort.Slice(r.Packages, func(i, j int) bool { return r.Packages[i].Binary < r.Packages[j].Binary })
+	return pkg
+}
+
+// WriteJSON - store report as JSON.
+func (r *TestReport) WriteJSON(fileName string) error {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, content, 0600)
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitFailure `xml:"skipped,omitempty"`
+	// Flaky - a failure of test passed by a later execution, like surefire flakyFailure.
+	Flaky     *junitFailure `xml:"flakyFailure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Errors    int              `xml:"errors,attr"`
+	Skipped   int              `xml:"skipped,attr"`
+	Time      string           `xml:"time,attr"`
+	Timestamp string           `xml:"timestamp,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+	SystemOut string           `xml:"system-out,omitempty"`
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+// WriteJUnit - store report as JUnit XML, every test binary is a test suite.
+func (r *TestReport) WriteJUnit(fileName string) error {
+	suites := &junitTestSuites{Tests: r.Passed + r.Failed + r.Skipped + r.Flaky, Failures: r.Failed, Skipped: r.Skipped}
+	for _, p := range r.Packages {
+		name := p.Package
+		if name == "" {
+			name = p.Binary
+		}
+		suite := &junitTestSuite{
+			Name:      name,
+			Time:      junitTime(p.Elapsed),
+			Timestamp: p.Start.UTC().Format("2006-01-02T15:04:05"),
+			SystemOut: strings.Join(p.Output, "\n"),
+		}
+		for _, t := range p.Tests {
+			c := &junitTestCase{ClassName: name, Name: t.Name, Time: junitTime(t.Elapsed)}
+			output := strings.Join(t.Output, "\n")
+			switch t.Status {
+			case TestActionPass:
+				c.SystemOut = output
+			case TestStatusFlaky:
+				c.Flaky = &junitFailure{Message: "Flaky", Content: output}
+			case TestActionSkip:
+				c.Skipped = &junitFailure{Message: "Skipped", Content: output}
+				suite.Skipped++
+			default:
+				c.Failure = &junitFailure{Message: "Failed", Content: output}
+				suite.Failures++
+			}
+			suite.Tests++
+			suite.TestCases = append(suite.TestCases, c)
+		}
+		if p.Status == TestActionFail && suite.Failures == 0 {
+			// Package is failed without failed tests, like panic in init or TestMain.
+			suite.Errors++
+		}
+		suites.Suites = append(suites.Suites, suite)
+	}
+	content, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, append([]byte(xml.Header), content...), 0600)
+}
+
+func junitTime(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
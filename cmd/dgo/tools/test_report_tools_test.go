@@ -0,0 +1,237 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTestEventConverter(t *testing.T) {
+	type event struct {
+		action string
+		test   string
+		output string
+	}
+	tests := []struct {
+		name   string
+		lines  []string
+		exit   error
+		events []event
+	}{
+		{
+			name:  "passed test",
+			lines: []string{"\x16=== RUN   TestA", "hello", "\x16--- PASS: TestA (0.01s)", "\x16PASS"},
+			events: []event{
+				{TestActionRun, "TestA", ""},
+				{TestActionOutput, "TestA", "=== RUN   TestA\n"},
+				{TestActionOutput, "TestA", "hello\n"},
+				{TestActionOutput, "TestA", "--- PASS: TestA (0.01s)\n"},
+				{TestActionPass, "TestA", ""},
+				{TestActionOutput, "", "PASS\n"},
+				{TestActionPass, "", ""},
+			},
+		},
+		{
+			name: "subtests",
+			lines: []string{
+				"\x16=== RUN   TestA",
+				"\x16=== RUN   TestA/sub",
+				"    \x16--- FAIL: TestA/sub (0.00s)",
+				"\x16--- FAIL: TestA (0.00s)",
+			},
+			exit: errors.New("exit status 1"),
+			events: []event{
+				{TestActionRun, "TestA", ""},
+				{TestActionOutput, "TestA", "=== RUN   TestA\n"},
+				{TestActionRun, "TestA/sub", ""},
+				{TestActionOutput, "TestA/sub", "=== RUN   TestA/sub\n"},
+				{TestActionOutput, "TestA/sub", "    --- FAIL: TestA/sub (0.00s)\n"},
+				{TestActionFail, "TestA/sub", ""},
+				{TestActionOutput, "TestA", "--- FAIL: TestA (0.00s)\n"},
+				{TestActionFail, "TestA", ""},
+				{TestActionOutput, "", "exit status 1\n"},
+				{TestActionFail, "", ""},
+			},
+		},
+		{
+			name: "parallel tests",
+			lines: []string{
+				"\x16=== RUN   TestA",
+				"\x16=== PAUSE TestA",
+				"\x16=== CONT  TestA",
+				"\x16=== NAME  TestA",
+				"\x0eerror\x0f",
+				"\x16--- SKIP: TestA (0.00s)",
+			},
+			events: []event{
+				{TestActionRun, "TestA", ""},
+				{TestActionOutput, "TestA", "=== RUN   TestA\n"},
+				{TestActionPause, "TestA", ""},
+				{TestActionOutput, "TestA", "=== PAUSE TestA\n"},
+				{TestActionCont, "TestA", ""},
+				{TestActionOutput, "TestA", "=== CONT  TestA\n"},
+				{TestActionOutput, "TestA", "error\n"},
+				{TestActionOutput, "TestA", "--- SKIP: TestA (0.00s)\n"},
+				{TestActionSkip, "TestA", ""},
+				{TestActionPass, "", ""},
+			},
+		},
+		{
+			name:  "frame without marker is output",
+			lines: []string{"=== RUN   TestA"},
+			events: []event{
+				{TestActionOutput, "", "=== RUN   TestA\n"},
+				{TestActionPass, "", ""},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []event
+			c := NewTestEventConverter("example.com/app", func(e *TestEvent) {
+				if e.Package != "example.com/app" {
+					t.Errorf("unexpected package %v", e.Package)
+				}
+				events = append(events, event{e.Action, e.Test, e.Output})
+			})
+			for _, line := range tt.lines {
+				c.Line(line)
+			}
+			c.Exit(tt.exit)
+			if !reflect.DeepEqual(events, tt.events) {
+				t.Errorf("events = %q\nwant %q", events, tt.events)
+			}
+		})
+	}
+}
+
+func TestTestReportAdd(t *testing.T) {
+	run := func(test string) *TestEvent { return &TestEvent{Action: TestActionRun, Test: test} }
+	result := func(action, test string) *TestEvent { return &TestEvent{Action: action, Test: test, Elapsed: 1} }
+	tests := []struct {
+		name    string
+		events  []*TestEvent
+		status  string
+		tests   map[string]string
+		passed  int
+		failed  int
+		skipped int
+		flaky   int
+	}{
+		{
+			name: "passed",
+			events: []*TestEvent{
+				run("TestA"), result(TestActionPass, "TestA"),
+				run("TestB"), result(TestActionSkip, "TestB"),
+				result(TestActionPass, ""),
+			},
+			status:  TestActionPass,
+			tests:   map[string]string{"TestA": TestActionPass, "TestB": TestActionSkip},
+			passed:  1,
+			skipped: 1,
+		},
+		{
+			name: "failed",
+			events: []*TestEvent{
+				run("TestA"), result(TestActionFail, "TestA"),
+				run("TestB"), result(TestActionPass, "TestB"),
+				result(TestActionFail, ""),
+			},
+			status: TestActionFail,
+			tests:  map[string]string{"TestA": TestActionFail, "TestB": TestActionPass},
+			passed: 1,
+			failed: 1,
+		},
+		{
+			name: "flaky across retries",
+			events: []*TestEvent{
+				run("TestA"), result(TestActionFail, "TestA"),
+				run("TestB"), result(TestActionPass, "TestB"),
+				result(TestActionFail, ""),
+				run("TestA"), result(TestActionPass, "TestA"),
+				result(TestActionPass, ""),
+			},
+			status: TestActionPass,
+			tests:  map[string]string{"TestA": TestStatusFlaky, "TestB": TestActionPass},
+			passed: 1,
+			flaky:  1,
+		},
+		{
+			name: "failed by every retry",
+			events: []*TestEvent{
+				run("TestA"), result(TestActionFail, "TestA"), result(TestActionFail, ""),
+				run("TestA"), result(TestActionFail, "TestA"), result(TestActionFail, ""),
+			},
+			status: TestActionFail,
+			tests:  map[string]string{"TestA": TestActionFail},
+			failed: 1,
+		},
+		{
+			name: "interrupted by panic then passed",
+			events: []*TestEvent{
+				run("TestA"), result(TestActionFail, ""),
+				run("TestA"), result(TestActionPass, "TestA"), result(TestActionPass, ""),
+			},
+			status: TestActionPass,
+			tests:  map[string]string{"TestA": TestStatusFlaky},
+			flaky:  1,
+		},
+		{
+			name:   "not exited",
+			events: []*TestEvent{run("TestA")},
+			status: TestActionFail,
+			tests:  map[string]string{"TestA": TestActionFail},
+			failed: 1,
+		},
+		{
+			name: "failed outside of tests",
+			events: []*TestEvent{
+				run("TestA"), result(TestActionPass, "TestA"),
+				{Action: TestActionOutput, Output: "panic in TestMain\n"},
+				result(TestActionFail, ""),
+			},
+			status: TestActionFail,
+			tests:  map[string]string{"TestA": TestActionPass},
+			passed: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &TestReport{}
+			pkg := r.Add("app.test", tt.events)
+			if pkg.Status != tt.status {
+				t.Errorf("package status = %v, want %v", pkg.Status, tt.status)
+			}
+			got := map[string]string{}
+			for _, test := range pkg.Tests {
+				got[test.Name] = test.Status
+			}
+			if !reflect.DeepEqual(got, tt.tests) {
+				t.Errorf("tests = %v, want %v", got, tt.tests)
+			}
+			if r.Passed != tt.passed || r.Failed != tt.failed || r.Skipped != tt.skipped || r.Flaky != tt.flaky {
+				t.Errorf("counts = %v/%v/%v/%v, want %v/%v/%v/%v", r.Passed, r.Failed, r.Skipped, r.Flaky,
+					tt.passed, tt.failed, tt.skipped, tt.flaky)
+			}
+			if len(r.Packages) != 1 || r.Packages[0] != pkg {
+				t.Errorf("package is not added to report")
+			}
+		})
+	}
+}
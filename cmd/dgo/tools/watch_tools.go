@@ -0,0 +1,99 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// FileWatcher - detect changes of go sources, go.mod, go.sum and testdata files by polling their
+// modification time and size.
+type FileWatcher struct {
+	root     string
+	skipDirs map[string]bool
+	state    map[string]fileState
+}
+
+// NewFileWatcher - construct a watcher for all files inside root, skipDirs and hidden folders are ignored.
+func NewFileWatcher(root string, skipDirs ...string) *FileWatcher {
+	w := &FileWatcher{
+		root:     filepath.Clean(root),
+		skipDirs: map[string]bool{},
+		state:    map[string]fileState{},
+	}
+	for _, d := range skipDirs {
+		if abs, err := filepath.Abs(d); err == nil {
+			w.skipDirs[abs] = true
+		}
+	}
+	return w
+}
+
+// Scan - scan all files and return a sorted list of files changed, added or removed since previous scan.
+func (w *FileWatcher) Scan() ([]string, error) {
+	newState := map[string]fileState{}
+	err := filepath.Walk(w.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// File could be removed during walk.
+			return nil
+		}
+		if info.IsDir() {
+			if p != w.root && (strings.HasPrefix(info.Name(), ".") || w.skipDirs[p]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isWatchedFile(p) {
+			newState[p] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	changed := []string{}
+	for p, s := range newState {
+		if old, ok := w.state[p]; !ok || old != s {
+			changed = append(changed, p)
+		}
+	}
+	for p := range w.state {
+		if _, ok := newState[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	w.state = newState
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func isWatchedFile(p string) bool {
+	name := filepath.Base(p)
+	if strings.HasSuffix(name, ".go") || name == "go.mod" || name == "go.sum" {
+		return true
+	}
+	return strings.Contains(filepath.ToSlash(p), "/testdata/")
+}
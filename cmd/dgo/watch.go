@@ -0,0 +1,310 @@
+// Copyright (c) 2020 Andrey Sobolev.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dgo
+
+import (
+	"context"
+	"fmt"
+	"github.com/haiodo/dgo/cmd/dgo/spire"
+	"github.com/haiodo/dgo/cmd/dgo/tools"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+type watchOptions struct {
+	outputFolder string
+	cgoEnabled   bool
+	interval     time.Duration
+
+	spire       bool
+	trustDomain string
+	spirePort   int
+
+	build *BuildCmdArguments
+}
+
+var watchArguments = struct {
+	watchOptions
+	build BuildCmdArguments
+}{}
+
+func init() {
+	cmd := watchCmd
+	rootCmd.AddCommand(cmd)
+
+	watchCmd.Flags().StringVarP(&watchArguments.outputFolder,
+		"output", "o", "./dist", "Output folder, binaries are stored into ${output}/watch")
+
+	watchCmd.Flags().BoolVarP(&watchArguments.cgoEnabled,
+		"cgo", "", false, "If disabled will pass CGO_ENABLED=0 env variable to go compiler")
+
+	watchCmd.Flags().BoolVarP(&watchArguments.spire,
+		"spire", "s", true, "If enabled will run spire once and reuse it for all test runs")
+
+	watchCmd.Flags().StringVarP(&watchArguments.trustDomain,
+		"trust-domain", "", spire.DefaultTrustDomain, "Spire trust domain")
+
+	watchCmd.Flags().IntVarP(&watchArguments.spirePort,
+		"spire-port", "", spire.DefaultServerPort, "Spire server port")
+
+	addWatchIntervalFlag(watchCmd, &watchArguments.interval)
+	addBuildPoolFlags(watchCmd, &watchArguments.build)
+	addCompileFlags(watchCmd, &watchArguments.build)
+	addSelectFlags(watchCmd, &watchArguments.build.selection)
+}
+
+func addWatchIntervalFlag(cmd *cobra.Command, interval *time.Duration) {
+	cmd.Flags().DurationVarP(interval,
+		"interval", "", time.Second, "An interval to check sources for changes")
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch sources, rebuild and re-test affected packages on every change",
+	Long: `Watch go sources of current module, on every change affected applications and tests are rebuilt
+for current host and affected test binaries are executed. Spire is started once and reused for all runs.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logrus.Infof("dgo.watch target...")
+		options := watchArguments.watchOptions
+		options.build = &watchArguments.build
+		return runWatch(cmd, args, &options)
+	},
+}
+
+type watcher struct {
+	options    *watchOptions
+	curDir     string
+	outDir     string
+	roots      []string
+	modules    []*buildModule
+	selected   *selection
+	env        []string
+	cache      *tools.BuildCache
+	spireCtx   spire.SpireContext
+	agentID    string
+	registered map[string]bool
+}
+
+// runWatch - perform an initial build and test run, and repeat it for affected packages on every source change.
+func runWatch(cmd *cobra.Command, args []string, options *watchOptions) error {
+	curDir, err := os.Getwd()
+	if err != nil {
+		logrus.Errorf("Failed to receive current dir %v", err)
+		return err
+	}
+	if err = validatePoolFlags(options.build); err != nil {
+		return err
+	}
+	outDir, err := filepath.Abs(path.Join(options.outputFolder, "watch"))
+	if err != nil {
+		return err
+	}
+	env, _ := tools.RetrieveGoEnv(options.cgoEnabled, runtime.GOOS, runtime.GOARCH)
+	modules, err := findBuildModules(cmd.Context(), curDir, outDir, options.build.replaces, env)
+	if err != nil {
+		return err
+	}
+	selected, err := newSelection(&options.build.selection)
+	if err != nil {
+		return err
+	}
+	w := &watcher{
+		options:    options,
+		curDir:     curDir,
+		outDir:     outDir,
+		modules:    modules,
+		selected:   selected,
+		env:        env,
+		cache:      tools.LoadBuildCache(outDir),
+		registered: map[string]bool{},
+	}
+	for _, a := range args {
+		root, err := filepath.Abs(a)
+		if err != nil {
+			return err
+		}
+		w.roots = append(w.roots, root)
+	}
+
+	if options.spire {
+		if err = w.startSpire(cmd.Context()); err != nil {
+			return err
+		}
+	}
+
+	output, err := filepath.Abs(options.outputFolder)
+	if err != nil {
+		return err
+	}
+	files := tools.NewFileWatcher(curDir, output)
+	if _, err = files.Scan(); err != nil {
+		return err
+	}
+	w.iteration(cmd.Context(), nil)
+
+	ticker := time.NewTicker(options.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cmd.Context().Done():
+			return nil
+		case <-ticker.C:
+			changed, err := files.Scan()
+			if err != nil {
+				logrus.Errorf("Failed to scan sources %v", err)
+				continue
+			}
+			if len(changed) > 0 {
+				logrus.Infof("Changed files: %v", changed)
+				w.iteration(cmd.Context(), changed)
+			}
+		}
+	}
+}
+
+func (w *watcher) startSpire(ctx context.Context) error {
+	w.agentID = fmt.Sprintf("spiffe://%s/myagent", w.options.trustDomain)
+	var err error
+	w.spireCtx, err = spire.New("", w.agentID, spire.WithTrustDomain(w.options.trustDomain), spire.WithServerPort(w.options.spirePort))
+	if err != nil {
+		return err
+	}
+	if err = w.spireCtx.Start(ctx); err != nil {
+		return errors.Wrap(err, "failed to run spire")
+	}
+	curUserID, err := tools.ExecRead(ctx, "", []string{"id", "-u"}, nil, false)
+	if err != nil || len(curUserID) == 0 {
+		return errors.Wrap(err, "failed to retrieve current user id")
+	}
+	return w.spireCtx.AddEntry(w.agentID, fmt.Sprintf("spiffe://%s/any-test", w.options.trustDomain), fmt.Sprintf("unix:uid:%s", curUserID[0]))
+}
+
+// iteration - rebuild and re-test all packages affected by changed files, if changed is nil all packages are used.
+func (w *watcher) iteration(ctx context.Context, changed []string) {
+	graph, err := loadModulesGraph(ctx, w.modules, w.env)
+	if err != nil {
+		logrus.Errorf("Failed to load packages %v", err)
+		return
+	}
+
+	var affected *tools.AffectedSet
+	if changed != nil {
+		affected = graph.AffectedBy(changed)
+	}
+
+	flagArgs, err := w.options.build.flags.Args(tools.GitVersionInfo(ctx, w.curDir, time.Now()))
+	if err != nil {
+		logrus.Errorf("Failed to prepare compiler flags %v", err)
+		return
+	}
+	testFlagArgs, _ := w.options.build.flags.Args(nil)
+	keyArgs, _ := w.options.build.flags.KeyArgs()
+
+	ids := []string{}
+	for id := range graph.Packages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	pool := tools.NewWorkerPool(ctx, w.options.build.jobs, w.options.build.failFast)
+	tests := map[string]*tools.GraphPackage{}
+	for _, id := range ids {
+		pkg := graph.Packages[id]
+		m := moduleOf(w.modules, pkg.Dir)
+		if m == nil || !w.isSelected(pkg.Dir) {
+			continue
+		}
+		env := m.goEnv(w.env)
+		// Applications passed explicitly are always built.
+		if pkg.Name == "main" && affected.App(id) && (len(w.roots) > 0 || w.selected.app(w.curDir, path.Base(id), pkg.Dir)) {
+			outPath := path.Join(w.outDir, path.Base(id))
+			pool.Go(outPath, func(ctx context.Context) (string, []string, error) {
+				return compile(ctx, m.Dir, w.cache, append([]string{"go", "build"}, flagArgs...), append([]string{"go", "build"}, keyArgs...), pkg.Dir, outPath, false, env)
+			})
+		}
+		if pkg.HasTests && affected.Test(id) && w.selected.test(id, tools.SafeName(id)+".test") {
+			outPath := path.Join(w.outDir, tools.SafeName(id)+".test")
+			tests[outPath] = pkg
+			pool.Go(outPath, func(ctx context.Context) (string, []string, error) {
+				testCmd := append([]string{"go", "test", "-c"}, testFlagArgs...)
+				return compile(ctx, m.Dir, w.cache, testCmd, testCmd, pkg.Dir, outPath, true, env)
+			})
+		}
+	}
+	results := pool.Wait()
+	printBuildSummary(results)
+	if err = w.cache.Save(); err != nil {
+		logrus.Warnf("Failed to store build cache %v", err)
+	}
+
+	passed, failed := []string{}, []string{}
+	for _, r := range results {
+		pkg, ok := tests[r.Name]
+		if !ok || r.Err != nil || r.Status == tools.StatusSkipped {
+			continue
+		}
+		if err = w.runTest(ctx, r.Name, pkg); err != nil {
+			logrus.Errorf("Tests of %v are failed: %v", pkg.ImportPath, err)
+			failed = append(failed, pkg.ImportPath)
+			continue
+		}
+		passed = append(passed, pkg.ImportPath)
+	}
+	logrus.Infof("Tests complete: %v passed, %v failed %v. Waiting for changes...", len(passed), len(failed), failed)
+}
+
+func (w *watcher) runTest(ctx context.Context, testExecName string, pkg *tools.GraphPackage) error {
+	lines, err := tools.ExecRead(ctx, pkg.Dir, []string{testExecName, "-test.list", ".*"}, nil, false)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list tests of %v", testExecName)
+	}
+	if len(strings.TrimSpace(strings.Join(lines, ""))) == 0 {
+		logrus.Infof("No tests found in %v", pkg.ImportPath)
+		return nil
+	}
+	if w.spireCtx != nil && !w.registered[testExecName] {
+		if err = w.spireCtx.AddEntry(w.agentID, fmt.Sprintf("spiffe://%s/%s", w.options.trustDomain, path.Base(testExecName)),
+			fmt.Sprintf("unix:path:%s", testExecName)); err != nil {
+			logrus.Errorf("Failed to add entry to spire %v", err)
+		} else {
+			w.registered[testExecName] = true
+		}
+	}
+	logrus.Infof("Running tests for %v", pkg.ImportPath)
+	return tools.Exec(ctx, pkg.Dir, []string{testExecName}, nil)
+}
+
+// isSelected - tells if package dir is inside one of roots passed as arguments.
+func (w *watcher) isSelected(dir string) bool {
+	if len(w.roots) == 0 {
+		return true
+	}
+	for _, root := range w.roots {
+		if rel, err := filepath.Rel(root, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			return true
+		}
+	}
+	return false
+}